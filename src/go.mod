@@ -1,3 +1,5 @@
 module github.com/grantfbarnes/ground
 
 go 1.25.5
+
+require golang.org/x/crypto v0.9.0
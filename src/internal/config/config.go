@@ -0,0 +1,151 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// reads a toml or json file into run flag names and values, a section or nested object prefixes its keys with "<section>-"
+func Load(filePath string) (map[string]string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read config file"), err)
+	}
+
+	values := make(map[string]string)
+	if strings.EqualFold(filepath.Ext(filePath), ".json") {
+		err = parseJson(content, values)
+	} else {
+		err = parseToml(content, values)
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to parse config file"), err)
+	}
+
+	return values, nil
+}
+
+func parseJson(content []byte, values map[string]string) error {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	object := make(map[string]any)
+	err := decoder.Decode(&object)
+	if err != nil {
+		return err
+	}
+
+	return flattenJson("", object, values)
+}
+
+func flattenJson(prefix string, object map[string]any, values map[string]string) error {
+	for key, value := range object {
+		key = prefix + key
+		switch value := value.(type) {
+		case map[string]any:
+			err := flattenJson(key+"-", value, values)
+			if err != nil {
+				return err
+			}
+		case string:
+			values[key] = value
+		case json.Number, bool:
+			values[key] = fmt.Sprint(value)
+		default:
+			return fmt.Errorf("value of '%s' must be a string, number or boolean", key)
+		}
+	}
+	return nil
+}
+
+// only the flat subset of toml is needed: sections, comments and string, number and boolean values
+func parseToml(content []byte, values map[string]string) error {
+	prefix := ""
+	for lineNumber, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			section, rest, ok := strings.Cut(line[1:], "]")
+			rest = strings.TrimSpace(rest)
+			if !ok || strings.TrimSpace(section) == "" || (rest != "" && !strings.HasPrefix(rest, "#")) {
+				return fmt.Errorf("line %d: section is not valid", lineNumber+1)
+			}
+			prefix = strings.TrimSpace(section) + "-"
+			continue
+		}
+
+		key, rawValue, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("line %d: expected key = value", lineNumber+1)
+		}
+
+		value, err := parseTomlValue(strings.TrimSpace(rawValue))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber+1, err)
+		}
+
+		values[prefix+key] = value
+	}
+	return nil
+}
+
+func parseTomlValue(rawValue string) (string, error) {
+	var value, rest string
+	switch {
+	case strings.HasPrefix(rawValue, `"`):
+		end := 1
+		for end < len(rawValue) && rawValue[end] != '"' {
+			if rawValue[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rawValue) {
+			return "", errors.New("string is not terminated")
+		}
+
+		var err error
+		value, err = strconv.Unquote(rawValue[:end+1])
+		if err != nil {
+			return "", errors.Join(errors.New("string is not valid"), err)
+		}
+		rest = rawValue[end+1:]
+	case strings.HasPrefix(rawValue, "'"):
+		end := strings.Index(rawValue[1:], "'")
+		if end < 0 {
+			return "", errors.New("string is not terminated")
+		}
+		value = rawValue[1 : end+1]
+		rest = rawValue[end+2:]
+	default:
+		value, _, _ = strings.Cut(rawValue, "#")
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return "", errors.New("value not provided")
+		}
+		if strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{") {
+			return "", errors.New("arrays and tables are not supported")
+		}
+		// toml allows underscores between digits
+		if _, err := strconv.ParseFloat(strings.ReplaceAll(value, "_", ""), 64); err == nil {
+			value = strings.ReplaceAll(value, "_", "")
+		}
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", errors.New("unexpected content after value")
+	}
+
+	return value, nil
+}
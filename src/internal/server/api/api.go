@@ -1,71 +1,321 @@
 package api
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"slices"
+	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/grantfbarnes/ground/internal/server/common"
 	"github.com/grantfbarnes/ground/internal/server/cookie"
+	"github.com/grantfbarnes/ground/internal/server/logs"
+	"github.com/grantfbarnes/ground/internal/server/metrics"
+	"github.com/grantfbarnes/ground/internal/system/audit"
+	"github.com/grantfbarnes/ground/internal/system/auth"
 	"github.com/grantfbarnes/ground/internal/system/execute"
 	"github.com/grantfbarnes/ground/internal/system/filesystem"
 	"github.com/grantfbarnes/ground/internal/system/monitor"
+	"github.com/grantfbarnes/ground/internal/system/services"
 	"github.com/grantfbarnes/ground/internal/system/users"
 )
 
-var loginAttemptMutex sync.Mutex
-var loginAttempts map[string][]time.Time = make(map[string][]time.Time)
+const maxFormMemory int64 = 32 << 20
+const csrfTokenHeader string = "X-CSRF-Token"
+const logRecordsShown int = 500
+const logRecordsMax int = 5000
+const logStreamHeartbeat time.Duration = 30 * time.Second
+const moveStatusMoved string = "moved"
+const moveStatusConflict string = "conflict"
+const moveStatusError string = "error"
+
+// 0 for no limit
+var uploadMaxSize atomic.Int64
+
+type moveResult struct {
+	Source      string               `json:"source"`
+	Destination string               `json:"destination"`
+	Status      string               `json:"status"`
+	Conflict    *filesystem.Conflict `json:"conflict,omitempty"`
+}
+
+func SetupUploadMaxSize(maxSize int64) {
+	uploadMaxSize.Store(maxSize)
+}
 
 func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		username, err := cookie.GetUsername(r)
 		if err != nil {
-			cookie.RemoveUsername(w)
+			cookie.RemoveUsername(w, r)
 			http.Error(w, "No login credentials found.", http.StatusUnauthorized)
 			return
 		}
 
+		if !requestIsSameOrigin(r) {
+			slog.Warn("cross-site request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", username, "origin", r.Header.Get("Origin"))
+			http.Error(w, "Cross-site requests are not allowed.", http.StatusForbidden)
+			return
+		}
+
+		if requestChangesState(r) && !cookie.CsrfTokenIsValid(r, r.Header.Get(csrfTokenHeader)) {
+			slog.Warn("csrf token is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", username)
+			http.Error(w, "Request token is not valid, reload the page and try again.", http.StatusForbidden)
+			return
+		}
+
+		metrics.RecordSession(username)
 		next.ServeHTTP(w, common.GetRequestWithRequestor(r, username))
 	})
 }
 
+// login and logout happen without a session to tie a token to, so only the origin is checked
+func OriginMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requestIsSameOrigin(r) {
+			slog.Warn("cross-site request", "ip", common.GetClientIp(r), "request", r.URL.Path, "origin", r.Header.Get("Origin"))
+			http.Error(w, "Cross-site requests are not allowed.", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func Login(w http.ResponseWriter, r *http.Request) {
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 
-	if tooManyLoginAttempts(r) {
-		slog.Warn("too many login attempts", "ip", r.RemoteAddr, "request", r.URL.Path, "username", username)
-		http.Error(w, "Too many login attempts.", http.StatusTooManyRequests)
+	if loginIsThrottled(w, r, username) {
 		return
 	}
 
 	if !users.UserIsValid(username) {
-		slog.Warn("username is not valid", "ip", r.RemoteAddr, "request", r.URL.Path, "username", username)
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username)
+		recordLoginFailure(r, "")
 		http.Error(w, "Username is not valid.", http.StatusBadRequest)
 		return
 	}
 
 	if password == "" {
-		slog.Warn("password not provided", "ip", r.RemoteAddr, "request", r.URL.Path, "username", username)
+		slog.Warn("password not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username)
 		http.Error(w, "Password not provided.", http.StatusBadRequest)
 		return
 	}
 
 	if !users.CredentialsAreValid(username, password) {
-		slog.Warn("credentials are not valid", "ip", r.RemoteAddr, "request", r.URL.Path, "username", username)
+		slog.Warn("credentials are not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username)
+		recordLoginFailure(r, username)
 		http.Error(w, "Credentials are not valid.", http.StatusBadRequest)
 		return
 	}
 
-	login(w, username)
+	totpEnrolled, err := auth.TotpIsEnrolled(username)
+	if err != nil {
+		slog.Error("failed to check totp enrollment", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username, "error", err)
+		http.Error(w, "Failed to check two-factor authentication.", http.StatusInternalServerError)
+		return
+	}
+
+	if totpEnrolled {
+		pendLogin(w, r, cookie.PENDING_STEP_TOTP, username)
+		return
+	}
+
+	completeLogin(w, r, username)
+}
+
+func LoginTotp(w http.ResponseWriter, r *http.Request) {
+	code := r.FormValue("code")
+
+	username, err := cookie.GetPendingUsername(r, cookie.PENDING_STEP_TOTP)
+	if err != nil {
+		slog.Warn("login not pending", "ip", common.GetClientIp(r), "request", r.URL.Path, "error", err)
+		http.Error(w, "Login has expired, enter your password again.", http.StatusUnauthorized)
+		return
+	}
+
+	if loginIsThrottled(w, r, username) {
+		return
+	}
+
+	err = auth.VerifySecondFactor(username, code)
+	if err != nil {
+		slog.Warn("second factor is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username, "error", err)
+		recordLoginFailure(r, username)
+		http.Error(w, "Code is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	cookie.RemovePendingUsername(w, r)
+	completeLogin(w, r, username)
+}
+
+func LoginPasswordChange(w http.ResponseWriter, r *http.Request) {
+	newPassword := r.FormValue("newPassword")
+	newPasswordConfirm := r.FormValue("newPasswordConfirm")
+
+	username, err := cookie.GetPendingUsername(r, cookie.PENDING_STEP_PASSWORD_CHANGE)
+	if err != nil {
+		slog.Warn("login not pending", "ip", common.GetClientIp(r), "request", r.URL.Path, "error", err)
+		http.Error(w, "Login has expired, enter your password again.", http.StatusUnauthorized)
+		return
+	}
+
+	if loginIsThrottled(w, r, username) {
+		return
+	}
+
+	if newPassword == "" {
+		slog.Warn("password not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username)
+		http.Error(w, "Password not provided.", http.StatusBadRequest)
+		return
+	}
+
+	if newPassword != newPasswordConfirm {
+		slog.Warn("password confirm does not match", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username)
+		http.Error(w, "Password confirm does not match.", http.StatusBadRequest)
+		return
+	}
+
+	if users.CredentialsAreValid(username, newPassword) {
+		slog.Warn("password not changed", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username)
+		http.Error(w, "New password must be different from the temporary password.", http.StatusBadRequest)
+		return
+	}
+
+	var policyErr *auth.PasswordPolicyError
+	err = users.SetUserPassword(username, newPassword)
+	if errors.As(err, &policyErr) {
+		slog.Warn("password does not meet policy", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username)
+		writePasswordViolations(w, policyErr.Violations)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to change password", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username, "error", err)
+		http.Error(w, "Failed to change password.", http.StatusInternalServerError)
+		return
+	}
+
+	cookie.RemovePendingUsername(w, r)
+	login(w, r, username)
+}
+
+func BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	username := r.FormValue("username")
+
+	if username != "" && !users.UserIsValid(username) {
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username)
+		http.Error(w, "Username is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	if loginIsThrottled(w, r, username) {
+		return
+	}
+
+	_, rpId := getOrigin(r)
+	options, err := auth.BeginPasskeyLogin(common.GetClientIp(r), username, rpId)
+	if errors.Is(err, auth.ErrPasskeyChallengeLimit) {
+		slog.Warn("too many passkey challenges", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username)
+		http.Error(w, "Too many passkey logins in progress, try again later.", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to begin passkey login", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username, "error", err)
+		http.Error(w, "Failed to start passkey login.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(options)
+}
+
+func LoginPasskey(w http.ResponseWriter, r *http.Request) {
+	username := r.FormValue("username")
+
+	if loginIsThrottled(w, r, "") {
+		return
+	}
+
+	var assertion auth.PasskeyAssertion
+	var userHandle []byte
+	var err error
+	for name, value := range map[string]*[]byte{
+		"credentialId":      &assertion.CredentialId,
+		"clientDataJSON":    &assertion.ClientDataJson,
+		"authenticatorData": &assertion.AuthenticatorData,
+		"signature":         &assertion.Signature,
+		"userHandle":        &userHandle,
+	} {
+		*value, err = base64.RawURLEncoding.DecodeString(r.FormValue(name))
+		if err != nil {
+			slog.Warn("passkey assertion is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username, "error", err)
+			recordLoginFailure(r, "")
+			http.Error(w, "Passkey response is not valid.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// discoverable credentials return the user handle, which is the username given at registration
+	if len(userHandle) > 0 {
+		username = string(userHandle)
+	}
+
+	if !users.UserIsValid(username) {
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username)
+		recordLoginFailure(r, "")
+		http.Error(w, "Username is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	if loginIsThrottled(w, r, username) {
+		return
+	}
+
+	// a passkey cannot be guessed, so failures only count against the address
+	origin, rpId := getOrigin(r)
+	userVerified, err := auth.FinishPasskeyLogin(username, origin, rpId, assertion)
+	if err != nil {
+		slog.Warn("passkey is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username, "error", err)
+		recordLoginFailure(r, "")
+		http.Error(w, "Passkey is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	// a passkey without user verification is only one factor
+	if !userVerified {
+		totpEnrolled, err := auth.TotpIsEnrolled(username)
+		if err != nil {
+			slog.Error("failed to check totp enrollment", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username, "error", err)
+			http.Error(w, "Failed to check two-factor authentication.", http.StatusInternalServerError)
+			return
+		}
+
+		if totpEnrolled {
+			pendLogin(w, r, cookie.PENDING_STEP_TOTP, username)
+			return
+		}
+	}
+
+	completeLogin(w, r, username)
 }
 
 func Logout(w http.ResponseWriter, r *http.Request) {
-	cookie.RemoveUsername(w)
+	cookie.RemoveUsername(w, r)
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -73,32 +323,58 @@ func UploadFiles(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 	urlRelativePath := strings.TrimPrefix(r.URL.Path, "/api/upload")
 
-	homePath := path.Join("/home", requestor)
-	urlRootPath := path.Join(homePath, urlRelativePath)
-	urlRootPath = path.Clean(urlRootPath)
+	resolver, username, ok := getRootResolver(r, requestor, true)
+	if !ok {
+		slog.Warn("root not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", r.URL.Query().Get("space"), "share", r.URL.Query().Get("share"))
+		http.Error(w, "Shared directory is not accessible.", http.StatusUnauthorized)
+		return
+	}
 
-	if !strings.HasPrefix(urlRootPath, homePath) {
-		slog.Warn("path outside of home", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
-		http.Error(w, "Path is outside of your home directory.", http.StatusBadRequest)
+	urlRootPath, err := resolver.Resolve(urlRelativePath)
+	if err != nil {
+		slog.Warn("path outside of root", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Path is outside of the root directory.", http.StatusBadRequest)
 		return
 	}
 
 	urlPathInfo, err := os.Stat(urlRootPath)
 	if err != nil {
-		slog.Warn("path not found", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Warn("path not found", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		http.Error(w, "Path not found.", http.StatusBadRequest)
 		return
 	}
 
 	if !urlPathInfo.IsDir() {
-		slog.Warn("path is not a directory", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("path is not a directory", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Path is not a directory.", http.StatusBadRequest)
 		return
 	}
 
-	err = filesystem.UploadFile(r, urlRootPath, requestor)
+	maxSize := uploadMaxSize.Load()
+	if maxSize > 0 {
+		if r.ContentLength > maxSize {
+			slog.Warn("upload too large", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "size", r.ContentLength)
+			http.Error(w, fmt.Sprintf("Upload is larger than the %d MB limit.", maxSize/1000000), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	}
+	r.Body = metrics.CountUpload(r.Body)
+
+	jobDone := metrics.StartJob("upload")
+	defer jobDone()
+
+	// versions are kept in the home directory, so only home uploads can overwrite
+	overwrite := r.URL.Query().Get("overwrite") == "true" && resolver.RootPath() == execute.GetHomePath(requestor)
+	err = filesystem.UploadFile(r, resolver, urlRelativePath, username, overwrite)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		slog.Warn("upload too large", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, fmt.Sprintf("Upload is larger than the %d MB limit.", maxSize/1000000), http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
-		slog.Error("failed to upload file", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to upload file", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		http.Error(w, "Failed to upload file.", http.StatusInternalServerError)
 		return
 	}
@@ -110,34 +386,142 @@ func DownloadFile(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 	urlRelativePath := strings.TrimPrefix(r.URL.Path, "/api/download")
 
-	homePath := path.Join("/home", requestor)
-	urlRootPath := path.Join(homePath, urlRelativePath)
-	urlRootPath = path.Clean(urlRootPath)
+	resolver, username, ok := getRootResolver(r, requestor, false)
+	if !ok {
+		slog.Warn("root not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", r.URL.Query().Get("space"), "share", r.URL.Query().Get("share"))
+		http.Error(w, "Shared directory is not accessible.", http.StatusUnauthorized)
+		return
+	}
 
-	if !strings.HasPrefix(urlRootPath, homePath) {
-		slog.Warn("path outside of home", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
-		http.Error(w, "Path is outside of your home directory.", http.StatusBadRequest)
+	urlRootPath, err := resolver.Resolve(urlRelativePath)
+	if err != nil {
+		slog.Warn("path outside of root", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Path is outside of the root directory.", http.StatusBadRequest)
 		return
 	}
 
 	urlPathInfo, err := os.Stat(urlRootPath)
 	if err != nil {
-		slog.Warn("path not found", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Warn("path not found", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		http.Error(w, "Path not found.", http.StatusBadRequest)
 		return
 	}
 
 	if urlPathInfo.IsDir() {
-		slog.Warn("path is a directory", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("path is a directory", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Path is a directory.", http.StatusBadRequest)
 		return
 	}
 
 	_, fileName := path.Split(urlRootPath)
-	w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+	filesystem.SetAttachmentHeader(w, fileName)
 	w.Header().Set("Content-Type", "application/octet-stream")
 
-	http.ServeFile(w, r, urlRootPath)
+	err = filesystem.ServeFile(metrics.CountDownload(w), r, username, urlRootPath)
+	if err != nil {
+		slog.Error("failed to serve file", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Failed to serve file.", http.StatusInternalServerError)
+	}
+}
+
+func FileVersion(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	urlRelativePath := strings.TrimPrefix(r.URL.Path, "/api/version")
+	versionName := r.FormValue("versionName")
+	download := r.FormValue("download") == "true"
+
+	urlRootPath, err := resolveHomePath(requestor, urlRelativePath)
+	if err != nil {
+		slog.Warn("path outside of home", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Path is outside of your home directory.", http.StatusBadRequest)
+		return
+	}
+
+	versionFilePath, err := filesystem.GetVersionFilePath(requestor, urlRelativePath, versionName)
+	if err != nil {
+		slog.Warn("version not found", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "version", versionName, "error", err)
+		http.Error(w, "Version not found.", http.StatusBadRequest)
+		return
+	}
+
+	_, fileName := path.Split(urlRootPath)
+	if download {
+		filesystem.SetAttachmentHeader(w, fileName)
+		w.Header().Set("Content-Type", "application/octet-stream")
+	} else if contentType := mime.TypeByExtension(path.Ext(fileName)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	err = filesystem.ServeFile(metrics.CountDownload(w), r, requestor, versionFilePath)
+	if err != nil {
+		slog.Error("failed to serve file", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Failed to serve file.", http.StatusInternalServerError)
+	}
+}
+
+func RestoreVersion(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	relHomePath := r.FormValue("relHomePath")
+	versionName := r.FormValue("versionName")
+
+	if relHomePath == "" {
+		slog.Warn("path not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Path not provided.", http.StatusBadRequest)
+		return
+	}
+
+	if versionName == "" {
+		slog.Warn("version name not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Version name not provided.", http.StatusBadRequest)
+		return
+	}
+
+	_, err := resolveHomePath(requestor, relHomePath)
+	if err != nil {
+		slog.Warn("path outside of home", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Path is outside of your home directory.", http.StatusBadRequest)
+		return
+	}
+
+	err = filesystem.RestoreVersion(requestor, relHomePath, versionName)
+	if err != nil {
+		slog.Error("failed to restore version", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "path", relHomePath, "version", versionName, "error", err)
+		http.Error(w, "Failed to restore version.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func DirectoryTree(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	urlRelativePath := strings.TrimPrefix(r.URL.Path, "/api/directory-tree")
+	showDotfiles := r.URL.Query().Get("showDotfiles")
+
+	resolver, username, ok := getRootResolver(r, requestor, false)
+	if !ok {
+		slog.Warn("root not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", r.URL.Query().Get("space"), "share", r.URL.Query().Get("share"))
+		http.Error(w, "Shared directory is not accessible.", http.StatusUnauthorized)
+		return
+	}
+
+	_, err := resolver.Resolve(urlRelativePath)
+	if err != nil {
+		slog.Warn("path outside of root", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Path is outside of the root directory.", http.StatusBadRequest)
+		return
+	}
+
+	treeItems, err := filesystem.GetDirectoryTreeItems(username, resolver, urlRelativePath, showDotfiles)
+	if err != nil {
+		slog.Error("failed to get directory tree", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Failed to get directory tree.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(treeItems)
 }
 
 func DiskUsage(w http.ResponseWriter, r *http.Request) {
@@ -145,18 +529,19 @@ func DiskUsage(w http.ResponseWriter, r *http.Request) {
 	dirPath := strings.TrimPrefix(r.URL.Path, "/api/disk-usage")
 	dirPath = path.Clean(dirPath)
 
-	homePath := path.Join("/home", requestor)
-	if !strings.HasPrefix(dirPath, homePath) {
+	resolver, username, ok := getRootResolver(r, requestor, false)
+	if !ok || !resolver.Contains(dirPath) {
 		if !users.IsAdmin(requestor) {
-			slog.Warn("non-admin request", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+			slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 			http.Error(w, "Must be admin to get disk usage outside your home directory.", http.StatusUnauthorized)
 			return
 		}
+		username = ""
 	}
 
-	dirDiskUsage, err := monitor.GetDirectoryDiskUsage(dirPath)
+	dirDiskUsage, err := monitor.GetDirectoryDiskUsage(username, dirPath)
 	if err != nil {
-		slog.Error("failed to get disk usage", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to get disk usage", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		http.Error(w, "Failed to get disk usage.", http.StatusInternalServerError)
 		return
 	}
@@ -171,29 +556,34 @@ func CreateDirectory(w http.ResponseWriter, r *http.Request) {
 	dirName := r.FormValue("dirName")
 
 	if relHomePath == "" {
-		slog.Warn("path not provided", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("path not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Path not provided.", http.StatusBadRequest)
 		return
 	}
 
 	if dirName == "" {
-		slog.Warn("directory name not provided", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("directory name not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Directory name not provided.", http.StatusBadRequest)
 		return
 	}
 
-	homePath := path.Join("/home", requestor)
-	dirPath := path.Join(homePath, relHomePath, dirName)
-	dirPath = path.Clean(dirPath)
-	if !strings.HasPrefix(dirPath, homePath) {
-		slog.Warn("path outside of home", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
-		http.Error(w, "Path is outside of your home directory.", http.StatusBadRequest)
+	resolver, username, ok := getRootResolver(r, requestor, true)
+	if !ok {
+		slog.Warn("root not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", r.URL.Query().Get("space"), "share", r.URL.Query().Get("share"))
+		http.Error(w, "Shared directory is not accessible.", http.StatusUnauthorized)
+		return
+	}
+
+	_, err := resolver.Resolve(path.Join(relHomePath, dirName))
+	if err != nil {
+		slog.Warn("path outside of root", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Path is outside of the root directory.", http.StatusBadRequest)
 		return
 	}
 
-	err := filesystem.CreateDirectory(requestor, relHomePath, dirName)
+	err = filesystem.CreateDirectory(username, resolver, relHomePath, dirName)
 	if err != nil {
-		slog.Error("failed to create directory", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to create directory", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		http.Error(w, "Failed to create directory.", http.StatusInternalServerError)
 		return
 	}
@@ -205,23 +595,31 @@ func CompressDirectory(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 	relHomePath := r.FormValue("relHomePath")
 	if relHomePath == "" {
-		slog.Warn("path not provided", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("path not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Path not provided.", http.StatusBadRequest)
 		return
 	}
 
-	homePath := path.Join("/home", requestor)
-	fullPath := path.Join(homePath, relHomePath)
-	fullPath = path.Clean(fullPath)
-	if !strings.HasPrefix(fullPath, homePath) {
-		slog.Warn("path outside of home", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
-		http.Error(w, "Path is outside of your home directory.", http.StatusBadRequest)
+	resolver, username, ok := getRootResolver(r, requestor, true)
+	if !ok {
+		slog.Warn("root not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", r.URL.Query().Get("space"), "share", r.URL.Query().Get("share"))
+		http.Error(w, "Shared directory is not accessible.", http.StatusUnauthorized)
+		return
+	}
+
+	_, err := resolver.Resolve(relHomePath)
+	if err != nil {
+		slog.Warn("path outside of root", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Path is outside of the root directory.", http.StatusBadRequest)
 		return
 	}
 
-	err := filesystem.CompressDirectory(requestor, relHomePath)
+	jobDone := metrics.StartJob("compress")
+	defer jobDone()
+
+	err = filesystem.CompressDirectory(username, resolver, relHomePath)
 	if err != nil {
-		slog.Error("failed to compress directory", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to compress directory", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		http.Error(w, "Failed to compress directory.", http.StatusInternalServerError)
 		return
 	}
@@ -233,23 +631,31 @@ func ExtractFile(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 	relHomePath := r.FormValue("relHomePath")
 	if relHomePath == "" {
-		slog.Warn("path not provided", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("path not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Path not provided.", http.StatusBadRequest)
 		return
 	}
 
-	homePath := path.Join("/home", requestor)
-	fullPath := path.Join(homePath, relHomePath)
-	fullPath = path.Clean(fullPath)
-	if !strings.HasPrefix(fullPath, homePath) {
-		slog.Warn("path outside of home", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
-		http.Error(w, "Path is outside of your home directory.", http.StatusBadRequest)
+	resolver, username, ok := getRootResolver(r, requestor, true)
+	if !ok {
+		slog.Warn("root not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", r.URL.Query().Get("space"), "share", r.URL.Query().Get("share"))
+		http.Error(w, "Shared directory is not accessible.", http.StatusUnauthorized)
 		return
 	}
 
-	err := filesystem.ExtractFile(requestor, relHomePath)
+	_, err := resolver.Resolve(relHomePath)
 	if err != nil {
-		slog.Error("failed to extract file", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Warn("path outside of root", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Path is outside of the root directory.", http.StatusBadRequest)
+		return
+	}
+
+	jobDone := metrics.StartJob("extract")
+	defer jobDone()
+
+	err = filesystem.ExtractFile(username, resolver, relHomePath)
+	if err != nil {
+		slog.Error("failed to extract file", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		http.Error(w, "Failed to extract file.", http.StatusInternalServerError)
 		return
 	}
@@ -259,47 +665,77 @@ func ExtractFile(w http.ResponseWriter, r *http.Request) {
 
 func MoveFiles(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
-	sourceRelHomePath := r.FormValue("sourceRelHomePath")
-	destinationRelHomePath := r.FormValue("destinationRelHomePath")
 
-	if sourceRelHomePath == "" {
-		slog.Warn("source path not provided", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+	err := r.ParseMultipartForm(maxFormMemory)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		slog.Warn("failed to parse form", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Failed to parse form.", http.StatusBadRequest)
+		return
+	}
+
+	sourceRelHomePaths := r.Form["sourceRelHomePath"]
+	destinationRelHomePaths := r.Form["destinationRelHomePath"]
+	conflictResolutions := r.Form["conflictResolution"]
+
+	if len(sourceRelHomePaths) == 0 || slices.Contains(sourceRelHomePaths, "") {
+		slog.Warn("source path not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Source path not provided.", http.StatusBadRequest)
 		return
 	}
 
-	if destinationRelHomePath == "" {
-		slog.Warn("destination path not provided", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+	if len(destinationRelHomePaths) != len(sourceRelHomePaths) || slices.Contains(destinationRelHomePaths, "") {
+		slog.Warn("destination path not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Destination path not provided.", http.StatusBadRequest)
 		return
 	}
 
-	homePath := path.Join("/home", requestor)
-
-	fullSourcePath := path.Join(homePath, sourceRelHomePath)
-	fullSourcePath = path.Clean(fullSourcePath)
-	if !strings.HasPrefix(fullSourcePath, homePath) {
-		slog.Warn("source path outside of home", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
-		http.Error(w, "Source path is outside of your home directory.", http.StatusBadRequest)
+	if len(conflictResolutions) > 1 && len(conflictResolutions) != len(sourceRelHomePaths) {
+		slog.Warn("conflict resolutions do not match sources", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Conflict resolutions do not match sources.", http.StatusBadRequest)
 		return
 	}
 
-	fullDestinationPath := path.Join(homePath, destinationRelHomePath)
-	fullDestinationPath = path.Clean(fullDestinationPath)
-	if !strings.HasPrefix(fullDestinationPath, homePath) {
-		slog.Warn("destination path outside of home", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
-		http.Error(w, "Destination path is outside of your home directory.", http.StatusBadRequest)
-		return
+	for _, conflictResolution := range conflictResolutions {
+		if !filesystem.ConflictResolutionIsValid(conflictResolution) {
+			slog.Warn("conflict resolution is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "resolution", conflictResolution)
+			http.Error(w, "Conflict resolution is not valid.", http.StatusBadRequest)
+			return
+		}
 	}
 
-	err := filesystem.Move(requestor, sourceRelHomePath, destinationRelHomePath)
-	if err != nil {
-		slog.Error("failed to move files", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "source", sourceRelHomePath, "destination", destinationRelHomePath, "error", err)
-		http.Error(w, "Failed to move files.", http.StatusInternalServerError)
+	resolver, username, ok := getRootResolver(r, requestor, true)
+	if !ok {
+		slog.Warn("root not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", r.URL.Query().Get("space"), "share", r.URL.Query().Get("share"))
+		http.Error(w, "Shared directory is not accessible.", http.StatusUnauthorized)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	for i := range sourceRelHomePaths {
+		_, err = resolver.ResolveLink(sourceRelHomePaths[i])
+		if err != nil {
+			slog.Warn("source path outside of root", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+			http.Error(w, "Source path is outside of the root directory.", http.StatusBadRequest)
+			return
+		}
+
+		_, err = resolver.ResolveLink(destinationRelHomePaths[i])
+		if err != nil {
+			slog.Warn("destination path outside of root", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+			http.Error(w, "Destination path is outside of the root directory.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	results := moveEach(sourceRelHomePaths, destinationRelHomePaths, conflictResolutions, func(source string, destination string, conflictResolution string) error {
+		err := filesystem.Move(username, resolver, source, destination, conflictResolution)
+		var conflictErr *filesystem.ConflictError
+		if err != nil && !errors.As(err, &conflictErr) {
+			slog.Error("failed to move files", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "source", source, "destination", destination, "error", err)
+		}
+		return err
+	})
+
+	writeMoveResults(w, results)
 }
 
 func RenameFile(w http.ResponseWriter, r *http.Request) {
@@ -309,26 +745,46 @@ func RenameFile(w http.ResponseWriter, r *http.Request) {
 	newName := r.FormValue("newName")
 
 	if relHomePath == "" {
-		slog.Warn("directory not provided", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("directory not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Directory not provided.", http.StatusBadRequest)
 		return
 	}
 
 	if oldName == "" {
-		slog.Warn("old name not provided", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("old name not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Old name not provided.", http.StatusBadRequest)
 		return
 	}
 
 	if newName == "" {
-		slog.Warn("new name not provided", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("new name not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "New name not provided.", http.StatusBadRequest)
 		return
 	}
 
-	err := filesystem.Rename(requestor, relHomePath, oldName, newName)
+	conflictResolution := r.FormValue("conflictResolution")
+	if !filesystem.ConflictResolutionIsValid(conflictResolution) {
+		slog.Warn("conflict resolution is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "resolution", conflictResolution)
+		http.Error(w, "Conflict resolution is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	resolver, username, ok := getRootResolver(r, requestor, true)
+	if !ok {
+		slog.Warn("root not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", r.URL.Query().Get("space"), "share", r.URL.Query().Get("share"))
+		http.Error(w, "Shared directory is not accessible.", http.StatusUnauthorized)
+		return
+	}
+
+	err := filesystem.Rename(username, resolver, relHomePath, oldName, newName, conflictResolution)
 	if err != nil {
-		slog.Error("failed to rename file", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "path", relHomePath, "old", oldName, "new", newName, "error", err)
+		var conflictErr *filesystem.ConflictError
+		if errors.As(err, &conflictErr) {
+			writeConflicts(w, []filesystem.Conflict{conflictErr.Conflict})
+			return
+		}
+
+		slog.Error("failed to rename file", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "path", relHomePath, "old", oldName, "new", newName, "error", err)
 		http.Error(w, "Failed to rename file.", http.StatusInternalServerError)
 		return
 	}
@@ -340,23 +796,28 @@ func Trash(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 	relHomePath := r.FormValue("relHomePath")
 	if relHomePath == "" {
-		slog.Warn("path not provided", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("path not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Path not provided.", http.StatusBadRequest)
 		return
 	}
 
-	homePath := path.Join("/home", requestor)
-	fullPath := path.Join(homePath, relHomePath)
-	fullPath = path.Clean(fullPath)
-	if !strings.HasPrefix(fullPath, homePath) {
-		slog.Warn("path outside of home", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
-		http.Error(w, "Path is outside of your home directory.", http.StatusBadRequest)
+	resolver, username, ok := getRootResolver(r, requestor, true)
+	if !ok {
+		slog.Warn("root not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", r.URL.Query().Get("space"), "share", r.URL.Query().Get("share"))
+		http.Error(w, "Shared directory is not accessible.", http.StatusUnauthorized)
+		return
+	}
+
+	_, err := resolver.ResolveLink(relHomePath)
+	if err != nil {
+		slog.Warn("path outside of root", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Path is outside of the root directory.", http.StatusBadRequest)
 		return
 	}
 
-	err := filesystem.Trash(requestor, relHomePath)
+	err = filesystem.Trash(username, resolver, relHomePath)
 	if err != nil {
-		slog.Error("failed to trash", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to trash", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		http.Error(w, "Failed to move files to the trash.", http.StatusInternalServerError)
 		return
 	}
@@ -368,26 +829,77 @@ func Restore(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 	trashDirName := r.FormValue("trashDirName")
 	if trashDirName == "" {
-		slog.Warn("trash dir name not provided", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("trash dir name not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Trash directory name not provided.", http.StatusBadRequest)
 		return
 	}
 
-	err := filesystem.Restore(requestor, trashDirName)
-	if err != nil {
-		slog.Error("failed restore trash dir", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
-		http.Error(w, "Failed restore the trash directory.", http.StatusInternalServerError)
+	resolver, ok := getTrashResolver(r, requestor)
+	if !ok {
+		slog.Warn("root not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", r.URL.Query().Get("space"), "share", r.URL.Query().Get("share"))
+		http.Error(w, "Shared directory is not accessible.", http.StatusUnauthorized)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-}
-
-func EmptyTrash(w http.ResponseWriter, r *http.Request) {
+	destinationRelHomePath := r.FormValue("destinationRelHomePath")
+	if destinationRelHomePath != "" {
+		_, err := resolver.Resolve(destinationRelHomePath)
+		if err != nil {
+			slog.Warn("destination path outside of root", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+			http.Error(w, "Destination path is outside of the root directory.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := filesystem.Restore(requestor, resolver, trashDirName, destinationRelHomePath)
+	if err != nil {
+		slog.Error("failed restore trash dir", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Failed restore the trash directory.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func DeleteTrash(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
-	err := filesystem.EmptyTrash(requestor)
+	trashDirName := r.PathValue("trashDirName")
+	if trashDirName == "" {
+		slog.Warn("trash dir name not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Trash directory name not provided.", http.StatusBadRequest)
+		return
+	}
+
+	resolver, ok := getTrashResolver(r, requestor)
+	if !ok {
+		slog.Warn("root not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", r.URL.Query().Get("space"), "share", r.URL.Query().Get("share"))
+		http.Error(w, "Shared directory is not accessible.", http.StatusUnauthorized)
+		return
+	}
+
+	err := filesystem.DeleteTrash(requestor, resolver, trashDirName)
 	if err != nil {
-		slog.Error("failed to emtpy trash", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to delete trash dir", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Failed to delete the trash directory.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func EmptyTrash(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+
+	resolver, ok := getTrashResolver(r, requestor)
+	if !ok {
+		slog.Warn("root not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", r.URL.Query().Get("space"), "share", r.URL.Query().Get("share"))
+		http.Error(w, "Shared directory is not accessible.", http.StatusUnauthorized)
+		return
+	}
+
+	err := filesystem.EmptyTrash(requestor, resolver)
+	if err != nil {
+		slog.Error("failed to emtpy trash", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		http.Error(w, "Failed to emtpy the trash.", http.StatusInternalServerError)
 		return
 	}
@@ -398,15 +910,27 @@ func EmptyTrash(w http.ResponseWriter, r *http.Request) {
 func SystemReboot(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 
+	if !common.GetFeatures().SystemPower {
+		slog.Warn("system power disabled", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "System power control is disabled.", http.StatusForbidden)
+		return
+	}
+
 	if !users.IsAdmin(requestor) {
-		slog.Warn("non-admin request", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Must be admin to reboot.", http.StatusUnauthorized)
 		return
 	}
 
 	err := execute.Reboot()
+
+	auditErr := audit.Record(requestor, common.GetClientIp(r), "system-reboot", "", err)
+	if auditErr != nil {
+		slog.Error("failed to record audit entry", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", auditErr)
+	}
+
 	if err != nil {
-		slog.Error("failed to reboot", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to reboot", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		http.Error(w, "Failed to reboot.", http.StatusInternalServerError)
 		return
 	}
@@ -417,15 +941,27 @@ func SystemReboot(w http.ResponseWriter, r *http.Request) {
 func SystemPoweroff(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 
+	if !common.GetFeatures().SystemPower {
+		slog.Warn("system power disabled", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "System power control is disabled.", http.StatusForbidden)
+		return
+	}
+
 	if !users.IsAdmin(requestor) {
-		slog.Warn("non-admin request", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		http.Error(w, "Must be admin to poweroff.", http.StatusUnauthorized)
 		return
 	}
 
 	err := execute.Poweroff()
+
+	auditErr := audit.Record(requestor, common.GetClientIp(r), "system-poweroff", "", err)
+	if auditErr != nil {
+		slog.Error("failed to record audit entry", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", auditErr)
+	}
+
 	if err != nil {
-		slog.Error("failed to poweroff", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to poweroff", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		http.Error(w, "Failed to poweroff.", http.StatusInternalServerError)
 		return
 	}
@@ -433,37 +969,66 @@ func SystemPoweroff(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func SystemStats(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+
+	if !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Must be admin to get system stats.", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		Samples     []monitor.Sample     `json:"samples"`
+		Filesystems []monitor.Filesystem `json:"filesystems"`
+	}{
+		Samples:     monitor.GetHistory(),
+		Filesystems: monitor.GetLatestFilesystems(),
+	})
+}
+
 func CreateUser(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 	username := r.FormValue("username")
+	password := r.FormValue("password")
 
 	if !users.IsAdmin(requestor) {
-		slog.Warn("non-admin request", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Must be admin to create users.", http.StatusUnauthorized)
 		return
 	}
 
 	if !users.UsernameIsValid(username) {
-		slog.Warn("username is not valid", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Username is not valid.", http.StatusBadRequest)
 		return
 	}
 
-	err := users.CreateUser(username)
+	var policyErr *auth.PasswordPolicyError
+	password, err := users.CreateUser(username, password)
+	if errors.As(err, &policyErr) {
+		slog.Warn("password does not meet policy", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
+		writePasswordViolations(w, policyErr.Violations)
+		return
+	}
 	if err != nil {
-		slog.Error("failed to create user", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
+		slog.Error("failed to create user", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
 		http.Error(w, "Failed to create user.", http.StatusInternalServerError)
 		return
 	}
 
 	err = filesystem.CreateRequiredFiles(username)
 	if err != nil {
-		slog.Error("failed to create required files", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
+		slog.Error("failed to create required files", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
 		http.Error(w, "Failed to create required files for user.", http.StatusInternalServerError)
 		return
 	}
 
+	// the temporary password is only ever shown here
 	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(password))
 }
 
 func DeleteUser(w http.ResponseWriter, r *http.Request) {
@@ -471,20 +1036,20 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	username := r.FormValue("username")
 
 	if requestor != username && !users.IsAdmin(requestor) {
-		slog.Warn("non-admin request", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Must be admin to delete other users.", http.StatusUnauthorized)
 		return
 	}
 
 	if !users.UserIsValid(username) {
-		slog.Warn("username is not valid", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Username is not valid.", http.StatusBadRequest)
 		return
 	}
 
 	err := users.DeleteUser(username)
 	if err != nil {
-		slog.Error("failed to delete user", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
+		slog.Error("failed to delete user", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
 		http.Error(w, "Failed to delete user.", http.StatusInternalServerError)
 		return
 	}
@@ -497,20 +1062,20 @@ func ToggleAdmin(w http.ResponseWriter, r *http.Request) {
 	username := r.FormValue("username")
 
 	if !users.IsAdmin(requestor) {
-		slog.Warn("non-admin request", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Must be admin to change admin status.", http.StatusUnauthorized)
 		return
 	}
 
 	if !users.UserIsValid(username) {
-		slog.Warn("username is not valid", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Username is not valid.", http.StatusBadRequest)
 		return
 	}
 
 	err := users.ToggleAdmin(username)
 	if err != nil {
-		slog.Error("failed to change admin status", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
+		slog.Error("failed to change admin status", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
 		http.Error(w, "Failed to change admin status.", http.StatusInternalServerError)
 		return
 	}
@@ -522,50 +1087,90 @@ func Impersonate(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 	username := r.FormValue("username")
 
+	if !common.GetFeatures().Impersonation {
+		slog.Warn("impersonation disabled", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
+		http.Error(w, "Impersonation is disabled.", http.StatusForbidden)
+		return
+	}
+
 	if !users.IsAdmin(requestor) {
-		slog.Warn("non-admin request", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Must be admin to impersonate.", http.StatusUnauthorized)
 		return
 	}
 
 	if !users.UserIsValid(username) {
-		slog.Warn("username is not valid", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Username is not valid.", http.StatusBadRequest)
 		return
 	}
 
 	if requestor == username {
-		slog.Warn("cannot impersonate yourself", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("cannot impersonate yourself", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Cannot impersonate yourself.", http.StatusBadRequest)
 		return
 	}
 
-	login(w, username)
+	login(w, r, username)
 }
 
 func ResetUserPassword(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 	username := r.FormValue("username")
 
-	if requestor != username && !users.IsAdmin(requestor) {
-		slog.Warn("non-admin request", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
-		http.Error(w, "Must be admin to reset passwords for other users.", http.StatusUnauthorized)
+	// a reset skips the current password, so a stolen session must not be able to take over the account with it
+	if !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
+		http.Error(w, "Must be admin to reset passwords.", http.StatusUnauthorized)
 		return
 	}
 
 	if !users.UserIsValid(username) {
-		slog.Warn("username is not valid", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Username is not valid.", http.StatusBadRequest)
 		return
 	}
 
-	err := users.ResetUserPassword(username)
+	password, err := users.ResetUserPassword(username)
+	if errors.Is(err, auth.ErrPasswordNotSettable) {
+		slog.Warn("password not settable", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
+		http.Error(w, "Passwords are managed outside of ground.", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		slog.Error("failed to reset password", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
+		slog.Error("failed to reset password", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
 		http.Error(w, "Failed to reset password.", http.StatusInternalServerError)
 		return
 	}
 
+	// the temporary password is only ever shown here
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(password))
+}
+
+func UnlockUser(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	username := r.FormValue("username")
+
+	if !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
+		http.Error(w, "Must be admin to unlock users.", http.StatusUnauthorized)
+		return
+	}
+
+	if !users.UserIsValid(username) {
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
+		http.Error(w, "Username is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	err := auth.UnlockAccount(username)
+	if err != nil {
+		slog.Error("failed to unlock user", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
+		http.Error(w, "Failed to unlock user.", http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -577,38 +1182,49 @@ func ChangeUserPassword(w http.ResponseWriter, r *http.Request) {
 	newPasswordConfirm := r.FormValue("newPasswordConfirm")
 
 	if requestor != username && !users.IsAdmin(requestor) {
-		slog.Warn("non-admin request", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Must be admin to change passwords for other users.", http.StatusUnauthorized)
 		return
 	}
 
 	if !users.UserIsValid(username) {
-		slog.Warn("username is not valid", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Username is not valid.", http.StatusBadRequest)
 		return
 	}
 
 	if newPassword == "" {
-		slog.Warn("password not provided", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("password not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Password not provided.", http.StatusBadRequest)
 		return
 	}
 
 	if newPassword != newPasswordConfirm {
-		slog.Warn("password confirm does not match", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("password confirm does not match", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Password confirm does not match.", http.StatusBadRequest)
 		return
 	}
 
 	if !users.CredentialsAreValid(username, currentPassword) {
-		slog.Warn("credentials are not valid", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("credentials are not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Credentials are not valid.", http.StatusBadRequest)
 		return
 	}
 
+	var policyErr *auth.PasswordPolicyError
 	err := users.SetUserPassword(username, newPassword)
+	if errors.As(err, &policyErr) {
+		slog.Warn("password does not meet policy", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
+		writePasswordViolations(w, policyErr.Violations)
+		return
+	}
+	if errors.Is(err, auth.ErrPasswordNotSettable) {
+		slog.Warn("password not settable", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
+		http.Error(w, "Passwords are managed outside of ground.", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		slog.Error("failed to change password", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
+		slog.Error("failed to change password", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
 		http.Error(w, "Failed to change password.", http.StatusInternalServerError)
 		return
 	}
@@ -622,20 +1238,20 @@ func AddUserSshKey(w http.ResponseWriter, r *http.Request) {
 	sshKey := r.FormValue("sshKey")
 
 	if requestor != username && !users.IsAdmin(requestor) {
-		slog.Warn("non-admin request", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Must be admin to add SSH keys for other users.", http.StatusUnauthorized)
 		return
 	}
 
 	if !users.UserIsValid(username) {
-		slog.Warn("username is not valid", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Username is not valid.", http.StatusBadRequest)
 		return
 	}
 
 	err := filesystem.AddUserSshKey(username, sshKey)
 	if err != nil {
-		slog.Error("failed to add ssh key", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
+		slog.Error("failed to add ssh key", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
 		http.Error(w, "Failed to add SSH key.", http.StatusInternalServerError)
 		return
 	}
@@ -649,20 +1265,20 @@ func DeleteUserSshKey(w http.ResponseWriter, r *http.Request) {
 	index := r.FormValue("index")
 
 	if requestor != username && !users.IsAdmin(requestor) {
-		slog.Warn("non-admin request", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Must be admin to delete SSH keys for other users.", http.StatusUnauthorized)
 		return
 	}
 
 	if !users.UserIsValid(username) {
-		slog.Warn("username is not valid", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username)
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
 		http.Error(w, "Username is not valid.", http.StatusBadRequest)
 		return
 	}
 
 	err := filesystem.DeleteUserSshKey(username, index)
 	if err != nil {
-		slog.Error("failed to delete ssh key", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
+		slog.Error("failed to delete ssh key", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
 		http.Error(w, "Failed to delete SSH key.", http.StatusInternalServerError)
 		return
 	}
@@ -670,42 +1286,847 @@ func DeleteUserSshKey(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func tooManyLoginAttempts(r *http.Request) bool {
-	loginAttemptMutex.Lock()
-	defer loginAttemptMutex.Unlock()
+func SetupUserTotp(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+
+	setup, err := auth.GenerateTotpSetup(requestor)
+	if err != nil {
+		slog.Error("failed to generate totp setup", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Failed to set up two-factor authentication.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(setup)
+}
+
+func EnrollUserTotp(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	secret := r.FormValue("secret")
+	code := r.FormValue("code")
+
+	recoveryCodes, err := auth.EnrollTotp(requestor, secret, code)
+	if errors.Is(err, auth.ErrTotpCodeNotValid) {
+		slog.Warn("totp code is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Code is not valid.", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to enroll totp", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Failed to enable two-factor authentication.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+func DisableUserTotp(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	username := r.FormValue("username")
+	code := r.FormValue("code")
+
+	if requestor != username && !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
+		http.Error(w, "Must be admin to disable two-factor authentication for other users.", http.StatusUnauthorized)
+		return
+	}
+
+	if !users.UserIsValid(username) {
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
+		http.Error(w, "Username is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	// admins disable it for users who lost their device, users have to prove they still have theirs
+	if requestor == username {
+		err := auth.VerifySecondFactor(username, code)
+		if err != nil {
+			slog.Warn("second factor is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
+			http.Error(w, "Code is not valid.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := auth.DisableTotp(username)
+	if err != nil {
+		slog.Error("failed to disable totp", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
+		http.Error(w, "Failed to disable two-factor authentication.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func ServiceAction(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	unit := r.FormValue("unit")
+	action := r.FormValue("action")
+
+	if !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Must be admin to manage services.", http.StatusUnauthorized)
+		return
+	}
+
+	if !services.UnitIsManaged(unit) {
+		slog.Warn("unit not managed", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "unit", unit)
+		http.Error(w, "Service is not in the list of managed services.", http.StatusBadRequest)
+		return
+	}
+
+	if !services.UnitActionIsValid(action) {
+		slog.Warn("service action not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "unit", unit, "action", action)
+		http.Error(w, "Service action is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	actionErr := services.RunUnitAction(unit, action)
 
-	cleanUpLoginAttempts()
+	err := audit.Record(requestor, common.GetClientIp(r), services.GetAuditAction(action), unit, actionErr)
+	if err != nil {
+		slog.Error("failed to record audit entry", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "unit", unit, "action", action, "error", err)
+	}
 
-	if _, ok := loginAttempts[r.RemoteAddr]; !ok {
-		loginAttempts[r.RemoteAddr] = make([]time.Time, 0)
+	if actionErr != nil {
+		slog.Error("failed to run service action", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "unit", unit, "action", action, "error", actionErr)
+		http.Error(w, fmt.Sprintf("Failed to %s service.", action), http.StatusInternalServerError)
+		return
 	}
-	loginAttempts[r.RemoteAddr] = append(loginAttempts[r.RemoteAddr], time.Now())
 
-	return len(loginAttempts[r.RemoteAddr]) > 10
+	slog.Info("ran service action", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "unit", unit, "action", action)
+	w.WriteHeader(http.StatusOK)
 }
 
-func cleanUpLoginAttempts() {
-	expiry := time.Now().Add(-time.Hour)
+func ServiceJournal(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	unit := r.URL.Query().Get("unit")
+
+	if !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Must be admin to view service logs.", http.StatusUnauthorized)
+		return
+	}
+
+	lines, err := strconv.ParseUint(r.URL.Query().Get("lines"), 10, 0)
+	if err != nil || lines == 0 {
+		lines = 100
+	}
+
+	journal, err := services.GetJournal(unit, uint(lines))
+	if errors.Is(err, services.ErrUnitNotAllowed) {
+		slog.Warn("unit not managed", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "unit", unit)
+		http.Error(w, "Service is not in the list of managed services.", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to get service journal", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "unit", unit, "error", err)
+		http.Error(w, "Failed to get service logs.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(journal))
+}
+
+func Logs(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+
+	if !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Must be admin to view server logs.", http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := getLogFilter(r)
+	if err != nil {
+		slog.Warn("log filter not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Log level is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = logRecordsShown
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		Records []logs.Record `json:"records"`
+	}{
+		Records: logs.GetRecords(filter, 0, min(limit, logRecordsMax)),
+	})
+}
+
+// server-sent events of new records matching the filter, until the client goes away or the server stops
+func LogStream(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+
+	if !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Must be admin to view server logs.", http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := getLogFilter(r)
+	if err != nil {
+		slog.Warn("log filter not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Log level is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	// a write timeout meant for downloads would cut the stream off
+	controller := http.NewResponseController(w)
+	err = controller.SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.Error("failed to clear write deadline", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+	}
+
+	// a reconnecting browser says where it left off, a new stream starts after the records the page already has
+	afterId, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	if err != nil {
+		afterId, _ = strconv.ParseUint(r.URL.Query().Get("after"), 10, 64)
+	}
+
+	subscriber, unsubscribe := logs.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	if afterId > 0 {
+		for _, record := range logs.GetRecords(filter, afterId, logRecordsMax) {
+			err = writeLogEvent(w, record)
+			if err != nil {
+				return
+			}
+			afterId = record.Id
+		}
+	}
+	controller.Flush()
+
+	heartbeat := time.NewTicker(logStreamHeartbeat)
+	defer heartbeat.Stop()
 
-	newLoginAttempts := make(map[string][]time.Time)
-	for ip, times := range loginAttempts {
-		newTimes := make([]time.Time, 0)
-		for _, t := range times {
-			if t.After(expiry) {
-				newTimes = append(newTimes, t)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			// keeps proxies from closing a quiet stream
+			_, err = io.WriteString(w, ": heartbeat\n\n")
+		case record, ok := <-subscriber:
+			if !ok {
+				return
+			}
+			if record.Id <= afterId || !filter.Matches(record) {
+				continue
 			}
+			err = writeLogEvent(w, record)
 		}
-		if len(newTimes) > 0 {
-			newLoginAttempts[ip] = newTimes
+		if err != nil {
+			return
 		}
+		controller.Flush()
+	}
+}
+
+func SetAdminTotpRequired(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	required := r.FormValue("required") == "true"
+
+	if !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Must be admin to require two-factor authentication.", http.StatusUnauthorized)
+		return
+	}
+
+	if required {
+		enrolled, err := auth.TotpIsEnrolled(requestor)
+		if err != nil || !enrolled {
+			slog.Warn("requestor not enrolled in totp", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+			http.Error(w, "Enable two-factor authentication for yourself first.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := auth.SetAdminTotpRequired(required)
+	if err != nil {
+		slog.Error("failed to set admin totp requirement", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Failed to change two-factor authentication requirement.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+
+	_, rpId := getOrigin(r)
+	options, err := auth.BeginPasskeyRegistration(common.GetClientIp(r), requestor, rpId)
+	if errors.Is(err, auth.ErrPasskeyChallengeLimit) {
+		slog.Warn("too many passkey challenges", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Too many passkey registrations in progress, try again later.", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to begin passkey registration", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Failed to start passkey registration.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(options)
+}
+
+func RegisterPasskey(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	name := r.FormValue("name")
+
+	clientDataJson, err := base64.RawURLEncoding.DecodeString(r.FormValue("clientDataJSON"))
+	if err != nil {
+		slog.Warn("passkey attestation is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Passkey response is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	attestationObject, err := base64.RawURLEncoding.DecodeString(r.FormValue("attestationObject"))
+	if err != nil {
+		slog.Warn("passkey attestation is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Passkey response is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	origin, rpId := getOrigin(r)
+	err = auth.FinishPasskeyRegistration(requestor, origin, rpId, name, clientDataJson, attestationObject)
+	if err != nil {
+		slog.Warn("failed to register passkey", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Failed to register passkey.", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	username := r.FormValue("username")
+	id := r.FormValue("id")
+
+	if requestor != username && !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
+		http.Error(w, "Must be admin to delete passkeys for other users.", http.StatusUnauthorized)
+		return
+	}
+
+	if !users.UserIsValid(username) {
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username)
+		http.Error(w, "Username is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	err := auth.DeletePasskey(username, id)
+	if err != nil {
+		slog.Error("failed to delete passkey", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "username", username, "error", err)
+		http.Error(w, "Failed to delete passkey.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func CreateSpace(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	name := r.FormValue("name")
+	groupname := r.FormValue("group")
+	writable := r.FormValue("writable") == "true"
+
+	if !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name)
+		http.Error(w, "Must be admin to create shared spaces.", http.StatusUnauthorized)
+		return
+	}
+
+	if !filesystem.SpaceNameIsValid(name) {
+		slog.Warn("space name is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name)
+		http.Error(w, "Space name is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	if groupname != "" && !users.UsernameIsValid(groupname) {
+		slog.Warn("group name is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "group", groupname)
+		http.Error(w, "Group name is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	// members would be granted admin by being added to the space
+	if users.IsAdminGroup(groupname) {
+		slog.Warn("admin group cannot back a space", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "group", groupname)
+		http.Error(w, "The admin group cannot be used for a shared space.", http.StatusBadRequest)
+		return
+	}
+
+	err := filesystem.CreateSpace(name, groupname, writable)
+	if errors.Is(err, filesystem.ErrSpaceGroupReserved) {
+		slog.Warn("reserved group cannot back a space", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "group", groupname)
+		http.Error(w, "System groups and primary groups of users cannot be used for a shared space.", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to create space", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "error", err)
+		http.Error(w, "Failed to create shared space.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func DeleteSpace(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	name := r.FormValue("name")
+
+	if !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name)
+		http.Error(w, "Must be admin to delete shared spaces.", http.StatusUnauthorized)
+		return
+	}
+
+	err := filesystem.DeleteSpace(name)
+	if err != nil {
+		slog.Error("failed to delete space", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "error", err)
+		http.Error(w, "Failed to delete shared space. Only empty spaces can be deleted.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func SetSpaceAccess(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	name := r.FormValue("name")
+	writable := r.FormValue("writable") == "true"
+
+	if !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name)
+		http.Error(w, "Must be admin to change shared space access.", http.StatusUnauthorized)
+		return
+	}
+
+	err := filesystem.SetSpaceWritable(name, writable)
+	if err != nil {
+		slog.Error("failed to set space access", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "error", err)
+		http.Error(w, "Failed to change shared space access.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func AddSpaceMember(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	name := r.FormValue("name")
+	username := r.FormValue("username")
+
+	if !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "username", username)
+		http.Error(w, "Must be admin to change shared space members.", http.StatusUnauthorized)
+		return
+	}
+
+	if !users.UserIsValid(username) {
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "username", username)
+		http.Error(w, "Username is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	space, err := filesystem.GetSpace(name)
+	if err != nil {
+		slog.Warn("space not found", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "error", err)
+		http.Error(w, "Shared space not found.", http.StatusBadRequest)
+		return
+	}
+
+	if users.IsAdminGroup(space.Group) {
+		slog.Warn("admin group cannot back a space", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "group", space.Group)
+		http.Error(w, "The admin group cannot be used for a shared space.", http.StatusBadRequest)
+		return
+	}
+
+	err = filesystem.AddSpaceMember(name, username)
+	if err != nil {
+		slog.Error("failed to add space member", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "username", username, "error", err)
+		http.Error(w, "Failed to add shared space member.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func RemoveSpaceMember(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	name := r.FormValue("name")
+	username := r.FormValue("username")
+
+	if !users.IsAdmin(requestor) {
+		slog.Warn("non-admin request", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "username", username)
+		http.Error(w, "Must be admin to change shared space members.", http.StatusUnauthorized)
+		return
+	}
+
+	if !users.UserIsValid(username) {
+		slog.Warn("username is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "username", username)
+		http.Error(w, "Username is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	err := filesystem.RemoveSpaceMember(name, username)
+	if err != nil {
+		slog.Error("failed to remove space member", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", name, "username", username, "error", err)
+		http.Error(w, "Failed to remove shared space member.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func CreateShare(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	relHomePath := r.FormValue("relHomePath")
+	recipient := r.FormValue("recipient")
+	writable := r.FormValue("writable") == "true"
+
+	if !common.GetFeatures().Shares {
+		slog.Warn("shares disabled", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Sharing is disabled.", http.StatusForbidden)
+		return
+	}
+
+	if relHomePath == "" {
+		slog.Warn("path not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Path not provided.", http.StatusBadRequest)
+		return
+	}
+
+	if !users.UserIsValid(recipient) {
+		slog.Warn("recipient is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "recipient", recipient)
+		http.Error(w, "User is not valid.", http.StatusBadRequest)
+		return
+	}
+
+	if recipient == requestor {
+		slog.Warn("cannot share with yourself", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Cannot share with yourself.", http.StatusBadRequest)
+		return
+	}
+
+	_, err := resolveHomePath(requestor, relHomePath)
+	if err != nil {
+		slog.Warn("path outside of home", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		http.Error(w, "Path is outside of your home directory.", http.StatusBadRequest)
+		return
+	}
+
+	err = filesystem.CreateShare(requestor, relHomePath, recipient, writable)
+	if errors.Is(err, filesystem.ErrSharePathProtected) {
+		slog.Warn("share path is protected", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "path", relHomePath, "recipient", recipient)
+		http.Error(w, "Directories holding login files cannot be shared.", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to create share", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "path", relHomePath, "recipient", recipient, "error", err)
+		http.Error(w, "Failed to share directory.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func DeleteShare(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	shareId := r.FormValue("id")
+
+	if shareId == "" {
+		slog.Warn("share id not provided", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
+		http.Error(w, "Share id not provided.", http.StatusBadRequest)
+		return
+	}
+
+	err := filesystem.DeleteShare(requestor, shareId)
+	if err != nil {
+		slog.Error("failed to delete share", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "share", shareId, "error", err)
+		http.Error(w, "Failed to stop sharing directory.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeLogEvent(w http.ResponseWriter, record logs.Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", record.Id, data)
+	return err
+}
+
+func getLogFilter(r *http.Request) (logs.Filter, error) {
+	filter := logs.Filter{
+		Level:  slog.LevelDebug,
+		User:   strings.TrimSpace(r.URL.Query().Get("user")),
+		Ip:     strings.TrimSpace(r.URL.Query().Get("ip")),
+		Search: strings.TrimSpace(r.URL.Query().Get("search")),
+	}
+
+	level := r.URL.Query().Get("level")
+	if level != "" {
+		err := filter.Level.UnmarshalText([]byte(level))
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
+
+// failed attempts slow down both the address and the user, enough of them lock the user out for a while
+func loginIsThrottled(w http.ResponseWriter, r *http.Request, username string) bool {
+	retryAfter, throttled := auth.LoginRetryAfter(common.GetClientIp(r), username)
+	if !throttled {
+		return false
+	}
+
+	metrics.CountRateLimitedLogin()
+	retryAfter = retryAfter.Truncate(time.Second) + time.Second
+	slog.Warn("too many login attempts", "ip", common.GetClientIp(r), "request", r.URL.Path, "username", username, "retryAfter", retryAfter)
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	http.Error(w, fmt.Sprintf("Too many failed login attempts, try again in %s.", retryAfter), http.StatusTooManyRequests)
+	return true
+}
+
+func recordLoginFailure(r *http.Request, username string) {
+	metrics.CountFailedLogin()
+	auth.RecordLoginFailure(common.GetClientIp(r), username)
+}
+
+// returns the resolver for the root directory and the user whose credentials are used inside of it
+func getRootResolver(r *http.Request, requestor string, write bool) (filesystem.PathResolver, string, bool) {
+	spaceName := r.URL.Query().Get("space")
+	shareKey := r.URL.Query().Get("share")
+
+	var rootPath, username string
+	var canRead, canWrite bool
+	if spaceName != "" {
+		rootPath, canRead, canWrite = filesystem.GetSpaceAccess(requestor, spaceName)
+		username = requestor
+	} else if shareKey != "" {
+		if !common.GetFeatures().Shares {
+			return filesystem.PathResolver{}, "", false
+		}
+		owner, shareId, _ := strings.Cut(shareKey, "/")
+		rootPath, canRead, canWrite = filesystem.GetShareAccess(requestor, owner, shareId)
+		username = owner
+	} else {
+		rootPath = execute.GetHomePath(requestor)
+		username = requestor
+		canRead = true
+		canWrite = true
+	}
+
+	if !canRead || (write && !canWrite) {
+		return filesystem.PathResolver{}, "", false
+	}
+
+	var resolver filesystem.PathResolver
+	var err error
+	if spaceName != "" {
+		resolver, err = filesystem.NewPathResolver(rootPath)
+	} else if shareKey != "" {
+		resolver, err = filesystem.NewSharePathResolver(username, rootPath)
+	} else {
+		resolver, err = filesystem.NewHomePathResolver(username)
+	}
+	if err != nil {
+		return filesystem.PathResolver{}, "", false
+	}
+
+	return resolver, username, true
+}
+
+// trash is kept in the home or in a space, items trashed in a share go to the owner's home
+func getTrashResolver(r *http.Request, requestor string) (filesystem.PathResolver, bool) {
+	if r.URL.Query().Get("share") != "" {
+		return filesystem.PathResolver{}, false
+	}
+
+	resolver, _, ok := getRootResolver(r, requestor, true)
+	return resolver, ok
+}
+
+func resolveHomePath(username string, relHomePath string) (string, error) {
+	resolver, err := filesystem.NewHomePathResolver(username)
+	if err != nil {
+		return "", err
+	}
+
+	return resolver.Resolve(relHomePath)
+}
+
+// returns the origin the browser used and its host name, which passkeys are bound to
+func getOrigin(r *http.Request) (string, string) {
+	scheme := "http"
+	if common.RequestIsHttps(r) {
+		scheme = "https"
+	}
+
+	rpId, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		rpId = r.Host
+	}
+
+	return scheme + "://" + r.Host, rpId
+}
+
+func requestChangesState(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// browsers say where a request came from, requests without any of the headers are not from another site's page
+func requestIsSameOrigin(r *http.Request) bool {
+	if !requestChangesState(r) {
+		return true
+	}
+
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return false
+	}
+
+	origin, _ := getOrigin(r)
+	if requestOrigin := r.Header.Get("Origin"); requestOrigin != "" {
+		return requestOrigin == origin
+	}
+
+	if referer := r.Header.Get("Referer"); referer != "" {
+		refererUrl, err := url.Parse(referer)
+		if err != nil {
+			return false
+		}
+		return refererUrl.Scheme+"://"+refererUrl.Host == origin
+	}
+
+	return true
+}
+
+func writeConflicts(w http.ResponseWriter, conflicts []filesystem.Conflict) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(struct {
+		Conflicts []filesystem.Conflict `json:"conflicts"`
+	}{
+		Conflicts: conflicts,
+	})
+}
+
+// moves every item even after one fails, so the results show what already happened to the rest
+func moveEach(sources []string, destinations []string, conflictResolutions []string, move func(source string, destination string, conflictResolution string) error) []moveResult {
+	results := []moveResult{}
+	for i := range sources {
+		conflictResolution := ""
+		if len(conflictResolutions) == 1 {
+			conflictResolution = conflictResolutions[0]
+		} else if len(conflictResolutions) > 1 {
+			conflictResolution = conflictResolutions[i]
+		}
+
+		result := moveResult{Source: sources[i], Destination: destinations[i], Status: moveStatusMoved}
+
+		err := move(sources[i], destinations[i], conflictResolution)
+		if err != nil {
+			var conflictErr *filesystem.ConflictError
+			if errors.As(err, &conflictErr) {
+				result.Status = moveStatusConflict
+				result.Conflict = &conflictErr.Conflict
+			} else {
+				result.Status = moveStatusError
+			}
+		}
+
+		results = append(results, result)
+	}
+	return results
+}
+
+// errors outrank conflicts, a conflict can be resolved and retried but an error needs a look first
+func writeMoveResults(w http.ResponseWriter, results []moveResult) {
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Status == moveStatusError {
+			status = http.StatusInternalServerError
+			break
+		}
+		if result.Status == moveStatusConflict {
+			status = http.StatusConflict
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Results []moveResult `json:"results"`
+	}{
+		Results: results,
+	})
+}
+
+func writePasswordViolations(w http.ResponseWriter, violations []string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(struct {
+		Violations []string `json:"violations"`
+	}{
+		Violations: violations,
+	})
+}
+
+// the password or passkey was accepted, the user still has to complete the step before getting a session
+func pendLogin(w http.ResponseWriter, r *http.Request, step string, username string) {
+	cookie.SetPendingUsername(w, r, step, username)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(step))
+}
+
+// every factor was accepted, a temporary password still has to be replaced before getting a session
+func completeLogin(w http.ResponseWriter, r *http.Request, username string) {
+	auth.RecordLoginSuccess(username)
+
+	if users.PasswordChangeRequired(username) {
+		pendLogin(w, r, cookie.PENDING_STEP_PASSWORD_CHANGE, username)
+		return
 	}
 
-	loginAttempts = newLoginAttempts
+	login(w, r, username)
 }
 
-func login(w http.ResponseWriter, username string) {
+func login(w http.ResponseWriter, r *http.Request, username string) {
 	filesystem.CreateRequiredFiles(username)
-	cookie.RemoveUsername(w)
-	cookie.SetUsername(w, username)
+	cookie.RemoveUsername(w, r)
+	cookie.SetUsername(w, r, username)
 	w.WriteHeader(http.StatusOK)
 }
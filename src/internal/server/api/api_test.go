@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grantfbarnes/ground/internal/system/filesystem"
+)
+
+func TestMoveEachMixedBatch(t *testing.T) {
+	conflict := filesystem.Conflict{
+		Source:      filesystem.ConflictItem{Name: "b", Path: "b"},
+		Destination: filesystem.ConflictItem{Name: "b", Path: "dir/b"},
+	}
+
+	moved := []string{}
+	results := moveEach([]string{"a", "b", "c", "d"}, []string{"dir/a", "dir/b", "dir/c", "dir/d"}, []string{}, func(source string, destination string, conflictResolution string) error {
+		switch source {
+		case "b":
+			return &filesystem.ConflictError{Conflict: conflict}
+		case "c":
+			return errors.New("failed to move files")
+		}
+		moved = append(moved, source)
+		return nil
+	})
+
+	// the items after the conflict and the error are still moved
+	if len(moved) != 2 || moved[0] != "a" || moved[1] != "d" {
+		t.Fatalf("moved %v instead of [a d]", moved)
+	}
+
+	expected := []string{moveStatusMoved, moveStatusConflict, moveStatusError, moveStatusMoved}
+	for i, result := range results {
+		if result.Status != expected[i] {
+			t.Errorf("%s has status %q instead of %q", result.Source, result.Status, expected[i])
+		}
+	}
+
+	if results[1].Conflict == nil || *results[1].Conflict != conflict {
+		t.Errorf("conflict of b is %v instead of %v", results[1].Conflict, conflict)
+	}
+
+	recorder := httptest.NewRecorder()
+	writeMoveResults(recorder, results)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("status is %d instead of %d", recorder.Code, http.StatusInternalServerError)
+	}
+
+	var body struct {
+		Results []moveResult `json:"results"`
+	}
+	err := json.NewDecoder(recorder.Body).Decode(&body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.Results) != len(results) {
+		t.Errorf("body has %d results instead of %d", len(body.Results), len(results))
+	}
+}
+
+func TestMoveEachConflictResolutions(t *testing.T) {
+	tests := []struct {
+		name        string
+		resolutions []string
+		expected    []string
+	}{
+		{name: "none", resolutions: []string{}, expected: []string{"", ""}},
+		{name: "one for all", resolutions: []string{filesystem.CONFLICT_SKIP}, expected: []string{filesystem.CONFLICT_SKIP, filesystem.CONFLICT_SKIP}},
+		{name: "one each", resolutions: []string{filesystem.CONFLICT_OVERWRITE, filesystem.CONFLICT_KEEP_BOTH}, expected: []string{filesystem.CONFLICT_OVERWRITE, filesystem.CONFLICT_KEEP_BOTH}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			used := []string{}
+			moveEach([]string{"a", "b"}, []string{"dir/a", "dir/b"}, test.resolutions, func(source string, destination string, conflictResolution string) error {
+				used = append(used, conflictResolution)
+				return nil
+			})
+
+			if len(used) != len(test.expected) || used[0] != test.expected[0] || used[1] != test.expected[1] {
+				t.Errorf("used %v instead of %v", used, test.expected)
+			}
+		})
+	}
+}
+
+func TestWriteMoveResultsStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		expected int
+	}{
+		{name: "all moved", statuses: []string{moveStatusMoved, moveStatusMoved}, expected: http.StatusOK},
+		{name: "conflict", statuses: []string{moveStatusMoved, moveStatusConflict}, expected: http.StatusConflict},
+		{name: "error", statuses: []string{moveStatusConflict, moveStatusError}, expected: http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results := []moveResult{}
+			for _, status := range test.statuses {
+				results = append(results, moveResult{Status: status})
+			}
+
+			recorder := httptest.NewRecorder()
+			writeMoveResults(recorder, results)
+
+			if recorder.Code != test.expected {
+				t.Errorf("status is %d instead of %d", recorder.Code, test.expected)
+			}
+		})
+	}
+}
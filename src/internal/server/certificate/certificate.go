@@ -0,0 +1,442 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+const TLS_AUTO string = "auto"
+
+const autoDirPath string = "/etc/ground/tls"
+const caValidity time.Duration = 10 * 365 * 24 * time.Hour
+const serverValidity time.Duration = 365 * 24 * time.Hour
+
+// the server certificate is replaced this long before it expires
+const serverRenewBefore time.Duration = 30 * 24 * time.Hour
+
+var caPermittedIpRanges []string = []string{"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7"}
+
+var caCertFilePath string = path.Join(autoDirPath, "ca.crt")
+var caKeyFilePath string = path.Join(autoDirPath, "ca.key")
+
+var tlsEnabled bool
+var certFilePath string
+var keyFilePath string
+var autoCertificate bool
+
+var certificateMutex sync.Mutex
+var certificate *tls.Certificate
+var certificateModTime time.Time
+
+// an empty mode uses the certificate files when they are given and plain http otherwise
+func SetupTls(mode string, certFile string, keyFile string) error {
+	switch mode {
+	case TLS_AUTO:
+		if certFile != "" || keyFile != "" {
+			return errors.New("cert file and key file are generated in auto mode")
+		}
+		tlsEnabled = true
+		return setupAutoCertificate()
+	case "":
+		if certFile == "" && keyFile == "" {
+			tlsEnabled = false
+			return nil
+		}
+		if certFile == "" || keyFile == "" {
+			return errors.New("cert file and key file must be given together")
+		}
+		tlsEnabled = true
+		return setupCertificateFiles(certFile, keyFile)
+	default:
+		return errors.New("tls mode must be auto or empty")
+	}
+}
+
+func TlsIsEnabled() bool {
+	return tlsEnabled
+}
+
+// uses certificate files managed outside of ground, they are reloaded when they change
+func setupCertificateFiles(certFile string, keyFile string) error {
+	certFilePath = certFile
+	keyFilePath = keyFile
+	autoCertificate = false
+
+	_, err := loadCertificate()
+	if err != nil {
+		return errors.Join(errors.New("failed to load certificate"), err)
+	}
+
+	return nil
+}
+
+// creates a certificate authority and a server certificate for this host if they do not exist yet
+func setupAutoCertificate() error {
+	certFilePath = path.Join(autoDirPath, "server.crt")
+	keyFilePath = path.Join(autoDirPath, "server.key")
+	autoCertificate = true
+
+	err := RenewAutoCertificate()
+	if err != nil {
+		return err
+	}
+
+	_, err = loadCertificate()
+	if err != nil {
+		return errors.Join(errors.New("failed to load certificate"), err)
+	}
+
+	return nil
+}
+
+func CaIsAvailable() bool {
+	return autoCertificate
+}
+
+// the authority users install so browsers trust the generated server certificate
+func GetCaCertificate() ([]byte, error) {
+	if !autoCertificate {
+		return nil, errors.New("certificate authority is only generated in auto mode")
+	}
+	return os.ReadFile(caCertFilePath)
+}
+
+// for tls.Config, so certificates can be replaced without a restart
+func GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return loadCertificate()
+}
+
+// replaces the server certificate when it is close to expiring or the host names and addresses changed
+func RenewAutoCertificate() error {
+	if !autoCertificate {
+		return nil
+	}
+
+	err := os.MkdirAll(autoDirPath, 0700)
+	if err != nil {
+		return errors.Join(errors.New("failed to create tls directory"), err)
+	}
+
+	caCert, caKey, err := getCa()
+	if err != nil {
+		return errors.Join(errors.New("failed to get certificate authority"), err)
+	}
+
+	dnsNames, ipAddresses, err := getHostNames()
+	if err != nil {
+		return errors.Join(errors.New("failed to get host names"), err)
+	}
+
+	if serverCertificateIsCurrent(dnsNames, ipAddresses) {
+		return nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return errors.Join(errors.New("failed to generate server key"), err)
+	}
+
+	serialNumber, err := getSerialNumber()
+	if err != nil {
+		return err
+	}
+
+	hostname := "localhost"
+	if len(dnsNames) > 0 {
+		hostname = dnsNames[0]
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: hostname},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(serverValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  ipAddresses,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return errors.Join(errors.New("failed to create server certificate"), err)
+	}
+
+	// the key is written first, so a reload never pairs the new certificate with the old key
+	err = writePemKey(keyFilePath, key)
+	if err != nil {
+		return errors.Join(errors.New("failed to write server key"), err)
+	}
+
+	err = writePem(certFilePath, "CERTIFICATE", der, 0644)
+	if err != nil {
+		return errors.Join(errors.New("failed to write server certificate"), err)
+	}
+
+	slog.Info("generated server certificate", "dns", dnsNames, "ip", ipAddresses, "expires", template.NotAfter)
+	return nil
+}
+
+// reads the files again only when the certificate file changed since the last load
+func loadCertificate() (*tls.Certificate, error) {
+	certificateMutex.Lock()
+	defer certificateMutex.Unlock()
+
+	info, err := os.Stat(certFilePath)
+	if err != nil {
+		if certificate != nil {
+			return certificate, nil
+		}
+		return nil, errors.Join(errors.New("failed to stat certificate"), err)
+	}
+
+	if certificate != nil && info.ModTime().Equal(certificateModTime) {
+		return certificate, nil
+	}
+
+	loaded, err := tls.LoadX509KeyPair(certFilePath, keyFilePath)
+	if err != nil {
+		// a renewal in progress may have only written one of the files, keep serving the old pair
+		if certificate != nil {
+			slog.Warn("failed to reload certificate, keeping previous one", "error", err)
+			return certificate, nil
+		}
+		return nil, err
+	}
+
+	if certificate != nil {
+		slog.Info("reloaded certificate", "file", certFilePath)
+	}
+
+	certificate = &loaded
+	certificateModTime = info.ModTime()
+	return certificate, nil
+}
+
+func getCa() (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	caCert, caKey, err := readCa()
+	if err == nil {
+		return caCert, caKey, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("failed to generate ca key"), err)
+	}
+
+	serialNumber, err := getSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("failed to get hostname"), err)
+	}
+
+	permittedDnsDomains := []string{hostname}
+	if hostname != "localhost" {
+		permittedDnsDomains = append(permittedDnsDomains, "localhost")
+	}
+
+	permittedIpRanges := []*net.IPNet{}
+	for _, ipRange := range caPermittedIpRanges {
+		_, ipNet, err := net.ParseCIDR(ipRange)
+		if err != nil {
+			return nil, nil, errors.Join(errors.New("failed to parse permitted ip range"), err)
+		}
+		permittedIpRanges = append(permittedIpRanges, ipNet)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:                serialNumber,
+		Subject:                     pkix.Name{CommonName: "Ground CA " + hostname, Organization: []string{"Ground"}},
+		NotBefore:                   now.Add(-time.Hour),
+		NotAfter:                    now.Add(caValidity),
+		KeyUsage:                    x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid:       true,
+		IsCA:                        true,
+		MaxPathLenZero:              true,
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         permittedDnsDomains,
+		PermittedIPRanges:           permittedIpRanges,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("failed to create ca certificate"), err)
+	}
+
+	caCert, err = x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("failed to parse ca certificate"), err)
+	}
+
+	err = writePemKey(caKeyFilePath, caKey)
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("failed to write ca key"), err)
+	}
+
+	err = writePem(caCertFilePath, "CERTIFICATE", der, 0644)
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("failed to write ca certificate"), err)
+	}
+
+	slog.Info("generated certificate authority", "expires", template.NotAfter)
+	return caCert, caKey, nil
+}
+
+func readCa() (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPem, err := os.ReadFile(caCertFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPem, err := os.ReadFile(caKeyFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPem)
+	if certBlock == nil {
+		return nil, nil, errors.New("ca certificate is not pem encoded")
+	}
+
+	caCert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("failed to parse ca certificate"), err)
+	}
+
+	keyBlock, _ := pem.Decode(keyPem)
+	if keyBlock == nil {
+		return nil, nil, errors.New("ca key is not pem encoded")
+	}
+
+	caKey, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("failed to parse ca key"), err)
+	}
+
+	return caCert, caKey, nil
+}
+
+func serverCertificateIsCurrent(dnsNames []string, ipAddresses []net.IP) bool {
+	certPem, err := os.ReadFile(certFilePath)
+	if err != nil {
+		return false
+	}
+
+	if _, err = os.Stat(keyFilePath); err != nil {
+		return false
+	}
+
+	block, _ := pem.Decode(certPem)
+	if block == nil {
+		return false
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+
+	if time.Until(cert.NotAfter) < serverRenewBefore {
+		return false
+	}
+
+	for _, dnsName := range dnsNames {
+		if !slices.Contains(cert.DNSNames, dnsName) {
+			return false
+		}
+	}
+
+	for _, ipAddress := range ipAddresses {
+		if !slices.ContainsFunc(cert.IPAddresses, ipAddress.Equal) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// every name and address a browser on the network might use to reach this host
+func getHostNames() ([]string, []net.IP, error) {
+	dnsNames := []string{}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("failed to get hostname"), err)
+	}
+	dnsNames = append(dnsNames, hostname)
+	if hostname != "localhost" {
+		dnsNames = append(dnsNames, "localhost")
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("failed to get interface addresses"), err)
+	}
+
+	ipAddresses := []net.IP{}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !(ipNet.IP.IsLoopback() || ipNet.IP.IsPrivate()) {
+			continue
+		}
+		ipAddresses = append(ipAddresses, ipNet.IP)
+	}
+
+	return dnsNames, ipAddresses, nil
+}
+
+func getSerialNumber() (*big.Int, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to generate serial number"), err)
+	}
+	return serialNumber, nil
+}
+
+func writePemKey(filePath string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return errors.Join(errors.New("failed to encode key"), err)
+	}
+	return writePem(filePath, "EC PRIVATE KEY", der, 0600)
+}
+
+// writes to a temporary file first, so a reader never sees a partial file
+func writePem(filePath string, blockType string, der []byte, mode os.FileMode) error {
+	var content bytes.Buffer
+	err := pem.Encode(&content, &pem.Block{Type: blockType, Bytes: der})
+	if err != nil {
+		return err
+	}
+
+	tempFilePath := filePath + ".tmp"
+	err = os.WriteFile(tempFilePath, content.Bytes(), mode)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempFilePath, filePath)
+}
@@ -0,0 +1,39 @@
+package common
+
+import (
+	"errors"
+	"strings"
+)
+
+// empty when mounted at the root, otherwise starts with a slash and has none at the end
+var basePath string
+
+func SetupBasePath(path string) error {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		basePath = ""
+		return nil
+	}
+
+	for segment := range strings.SplitSeq(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return errors.New("base path is not a clean path")
+		}
+	}
+
+	if strings.ContainsAny(path, "?#%\"'<>\\ ") {
+		return errors.New("base path contains characters that are not allowed")
+	}
+
+	basePath = "/" + path
+	return nil
+}
+
+func GetBasePath() string {
+	return basePath
+}
+
+// turns a path within ground into one the browser can use
+func GetUrl(urlPath string) string {
+	return basePath + urlPath
+}
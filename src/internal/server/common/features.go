@@ -0,0 +1,24 @@
+package common
+
+import "sync/atomic"
+
+// optional functionality an admin can turn off
+type Features struct {
+	Impersonation bool
+	Shares        bool
+	SystemPower   bool
+}
+
+var features atomic.Pointer[Features]
+
+func SetupFeatures(enabled Features) {
+	features.Store(&enabled)
+}
+
+func GetFeatures() Features {
+	enabled := features.Load()
+	if enabled == nil {
+		return Features{}
+	}
+	return *enabled
+}
@@ -0,0 +1,146 @@
+package common
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// stands for every client connecting through a unix socket, which only a local proxy can reach
+const TRUSTED_PROXY_UNIX string = "unix"
+
+var trustedProxies atomic.Pointer[proxyList]
+
+type proxyList struct {
+	prefixes []netip.Prefix
+	unix     bool
+}
+
+// takes a comma separated list of addresses or networks allowed to set forwarded headers
+func ValidateTrustedProxies(proxies string) error {
+	_, err := parseTrustedProxies(proxies)
+	return err
+}
+
+func SetupTrustedProxies(proxies string) error {
+	list, err := parseTrustedProxies(proxies)
+	if err != nil {
+		return err
+	}
+
+	trustedProxies.Store(list)
+	return nil
+}
+
+func parseTrustedProxies(proxies string) (*proxyList, error) {
+	list := proxyList{prefixes: []netip.Prefix{}}
+	for proxy := range strings.SplitSeq(proxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if proxy == TRUSTED_PROXY_UNIX {
+			list.unix = true
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, errors.Join(errors.New("trusted proxy is not valid"), err)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+
+		list.prefixes = append(list.prefixes, prefix.Masked())
+	}
+
+	return &list, nil
+}
+
+// returns the address of the client without the port, walking back through trusted proxies
+func GetClientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !peerIsTrustedProxy(r) {
+		return host
+	}
+
+	// each proxy appends the address it received from, so the first untrusted one from the right is the client
+	forwardedFor := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		forwarded := strings.TrimSpace(forwardedFor[i])
+		if forwarded == "" {
+			continue
+		}
+
+		if _, err := netip.ParseAddr(forwarded); err != nil {
+			break
+		}
+
+		host = forwarded
+		if !ipIsTrustedProxy(host) {
+			break
+		}
+	}
+
+	return host
+}
+
+// only believed from a trusted proxy, the first value is the one set where the client connected
+func RequestIsHttps(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+
+	if !peerIsTrustedProxy(r) {
+		return false
+	}
+
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+func peerIsTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	// unix socket peers have no address
+	if _, err := netip.ParseAddr(host); err != nil {
+		list := trustedProxies.Load()
+		return list != nil && list.unix
+	}
+
+	return ipIsTrustedProxy(host)
+}
+
+func ipIsTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	list := trustedProxies.Load()
+	if list == nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range list.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
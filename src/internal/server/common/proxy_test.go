@@ -0,0 +1,109 @@
+package common
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+)
+
+func setupTestTrustedProxies(t *testing.T, proxies string) {
+	t.Helper()
+	previous := trustedProxies.Load()
+	t.Cleanup(func() { trustedProxies.Store(previous) })
+
+	err := SetupTrustedProxies(proxies)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetClientIp(t *testing.T) {
+	setupTestTrustedProxies(t, "10.0.0.0/8, 192.168.1.1, unix")
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expected     string
+	}{
+		{name: "no proxy", remoteAddr: "203.0.113.7:5000", expected: "203.0.113.7"},
+		{name: "untrusted peer is not believed", remoteAddr: "203.0.113.7:5000", forwardedFor: []string{"198.51.100.1"}, expected: "203.0.113.7"},
+		{name: "trusted peer", remoteAddr: "10.0.0.2:5000", forwardedFor: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "trusted hops are walked back", remoteAddr: "10.0.0.2:5000", forwardedFor: []string{"198.51.100.1, 192.168.1.1, 10.0.0.3"}, expected: "198.51.100.1"},
+		{name: "header lines are joined", remoteAddr: "10.0.0.2:5000", forwardedFor: []string{"198.51.100.1", "10.0.0.3"}, expected: "198.51.100.1"},
+		{name: "stops at the first untrusted hop", remoteAddr: "10.0.0.2:5000", forwardedFor: []string{"1.1.1.1, 198.51.100.1, 10.0.0.3"}, expected: "198.51.100.1"},
+		{name: "spoofed value before an untrusted hop is ignored", remoteAddr: "10.0.0.2:5000", forwardedFor: []string{"10.0.0.9, 198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "invalid hop stops the walk", remoteAddr: "10.0.0.2:5000", forwardedFor: []string{"198.51.100.1, garbage, 10.0.0.3"}, expected: "10.0.0.3"},
+		{name: "only trusted hops", remoteAddr: "10.0.0.2:5000", forwardedFor: []string{"10.0.0.4, 10.0.0.3"}, expected: "10.0.0.4"},
+		{name: "mapped ipv4 peer", remoteAddr: "[::ffff:10.0.0.2]:5000", forwardedFor: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "unix socket peer", remoteAddr: "@", forwardedFor: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "unix socket peer without address", remoteAddr: "", forwardedFor: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			for _, forwardedFor := range test.forwardedFor {
+				r.Header.Add("X-Forwarded-For", forwardedFor)
+			}
+
+			clientIp := GetClientIp(r)
+			if clientIp != test.expected {
+				t.Errorf("client ip is %q instead of %q", clientIp, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetClientIpUnixNotTrusted(t *testing.T) {
+	setupTestTrustedProxies(t, "10.0.0.0/8")
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "@"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	clientIp := GetClientIp(r)
+	if clientIp != "@" {
+		t.Errorf("client ip is %q instead of %q", clientIp, "@")
+	}
+}
+
+func TestRequestIsHttps(t *testing.T) {
+	setupTestTrustedProxies(t, "10.0.0.0/8, unix")
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		tls            bool
+		forwardedProto string
+		expected       bool
+	}{
+		{name: "tls", remoteAddr: "203.0.113.7:5000", tls: true, expected: true},
+		{name: "plain", remoteAddr: "203.0.113.7:5000", expected: false},
+		{name: "untrusted peer is not believed", remoteAddr: "203.0.113.7:5000", forwardedProto: "https", expected: false},
+		{name: "trusted peer", remoteAddr: "10.0.0.2:5000", forwardedProto: "https", expected: true},
+		{name: "trusted peer with http", remoteAddr: "10.0.0.2:5000", forwardedProto: "http", expected: false},
+		{name: "first value wins", remoteAddr: "10.0.0.2:5000", forwardedProto: "http, https", expected: false},
+		{name: "case insensitive", remoteAddr: "10.0.0.2:5000", forwardedProto: " HTTPS ", expected: true},
+		{name: "unix socket peer", remoteAddr: "@", forwardedProto: "https", expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			if test.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if test.forwardedProto != "" {
+				r.Header.Set("X-Forwarded-Proto", test.forwardedProto)
+			}
+
+			isHttps := RequestIsHttps(r)
+			if isHttps != test.expected {
+				t.Errorf("https is %t instead of %t", isHttps, test.expected)
+			}
+		})
+	}
+}
@@ -10,14 +10,29 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/grantfbarnes/ground/internal/server/common"
 )
 
 const cookieNameUserToken string = "GROUND-USER-TOKEN"
 const cookieNameRedirectURL string = "GROUND-REDIRECT-URL"
+const cookieNamePendingToken string = "GROUND-PENDING-TOKEN"
+
+// login steps that come after the password, each signs its own tokens
+const PENDING_STEP_TOTP string = "totp"
+const PENDING_STEP_PASSWORD_CHANGE string = "password-change"
+
+// signed into each token so one kind can never be accepted as another
+const tokenPurposeUser string = "user"
+const tokenPurposePending string = "pending-"
+const tokenPurposeCsrf string = "csrf"
 
 var hashSecret []byte
 
+var sessionLength atomic.Int64
+
 func SetupHashSecret() error {
 	bytes := make([]byte, 32)
 	_, err := rand.Read(bytes)
@@ -28,13 +43,30 @@ func SetupHashSecret() error {
 	return nil
 }
 
+func ValidateSessionLength(length time.Duration) error {
+	if length < time.Minute {
+		return errors.New("session length must be at least a minute")
+	}
+	return nil
+}
+
+func SetupSessionLength(length time.Duration) error {
+	err := ValidateSessionLength(length)
+	if err != nil {
+		return err
+	}
+
+	sessionLength.Store(int64(length))
+	return nil
+}
+
 func GetUsername(r *http.Request) (string, error) {
 	token, err := getCookieValue(r, cookieNameUserToken)
 	if err != nil {
 		return "", errors.Join(errors.New("cookie not found"), err)
 	}
 
-	username, err := getUsernameFromToken(token)
+	username, err := getUsernameFromToken(tokenPurposeUser, token)
 	if err != nil {
 		return "", errors.Join(errors.New("user not logged in"), err)
 	}
@@ -42,23 +74,52 @@ func GetUsername(r *http.Request) (string, error) {
 	return username, nil
 }
 
-func SetUsername(w http.ResponseWriter, username string) {
-	token, expiry := getTokenFromUsername(username)
-	http.SetCookie(w, &http.Cookie{
-		Name:    cookieNameUserToken,
-		Value:   token,
-		Path:    "/",
-		Expires: expiry,
-	})
+func SetUsername(w http.ResponseWriter, r *http.Request, username string) {
+	token, expiry := getTokenFromUsername(tokenPurposeUser, username, getExpiry())
+	http.SetCookie(w, newCookie(r, cookieNameUserToken, token, common.GetUrl("/"), expiry))
+}
+
+func RemoveUsername(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, newCookie(r, cookieNameUserToken, "", common.GetUrl("/"), time.Unix(0, 0)))
 }
 
-func RemoveUsername(w http.ResponseWriter) {
-	http.SetCookie(w, &http.Cookie{
-		Name:    cookieNameUserToken,
-		Value:   "",
-		Path:    "/",
-		Expires: time.Unix(0, 0),
-	})
+// tied to the session, pages include it and state changing requests have to send it back
+func GetCsrfToken(r *http.Request) string {
+	token, err := getCookieValue(r, cookieNameUserToken)
+	if err != nil {
+		return ""
+	}
+
+	return base64.URLEncoding.EncodeToString(getHashedBytes(tokenPurposeCsrf, []byte(token)))
+}
+
+func CsrfTokenIsValid(r *http.Request, csrfToken string) bool {
+	expected := GetCsrfToken(r)
+	return expected != "" && hmac.Equal([]byte(expected), []byte(csrfToken))
+}
+
+// the user passed the password check and still has to complete the given step
+func GetPendingUsername(r *http.Request, step string) (string, error) {
+	token, err := getCookieValue(r, cookieNamePendingToken)
+	if err != nil {
+		return "", errors.Join(errors.New("cookie not found"), err)
+	}
+
+	username, err := getUsernameFromToken(tokenPurposePending+step, token)
+	if err != nil {
+		return "", errors.Join(errors.New("login not pending"), err)
+	}
+
+	return username, nil
+}
+
+func SetPendingUsername(w http.ResponseWriter, r *http.Request, step string, username string) {
+	token, expiry := getTokenFromUsername(tokenPurposePending+step, username, time.Now().Add(5*time.Minute))
+	http.SetCookie(w, newCookie(r, cookieNamePendingToken, token, common.GetUrl("/api/login"), expiry))
+}
+
+func RemovePendingUsername(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, newCookie(r, cookieNamePendingToken, "", common.GetUrl("/api/login"), time.Unix(0, 0)))
 }
 
 func GetRedirectUrl(r *http.Request) string {
@@ -69,13 +130,21 @@ func GetRedirectUrl(r *http.Request) string {
 	return redirectPath
 }
 
-func SetRedirectUrl(w http.ResponseWriter, url string) {
-	http.SetCookie(w, &http.Cookie{
-		Name:    cookieNameRedirectURL,
-		Value:   url,
-		Path:    "/",
-		Expires: getExpiry(),
-	})
+func SetRedirectUrl(w http.ResponseWriter, r *http.Request, url string) {
+	http.SetCookie(w, newCookie(r, cookieNameRedirectURL, url, common.GetUrl("/"), getExpiry()))
+}
+
+// scripts never read the cookies, and lax keeps them off requests started by other sites except top level links
+func newCookie(r *http.Request, name string, value string, path string, expiry time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Expires:  expiry,
+		Secure:   common.RequestIsHttps(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
 }
 
 func getCookieValue(r *http.Request, cookieName string) (string, error) {
@@ -97,18 +166,17 @@ func getCookieValue(r *http.Request, cookieName string) (string, error) {
 	return cookieValue, nil
 }
 
-func getTokenFromUsername(username string) (string, time.Time) {
-	expiry := getExpiry()
+func getTokenFromUsername(purpose string, username string, expiry time.Time) (string, time.Time) {
 	value := fmt.Sprintf("%s %d", username, expiry.Unix())
 	valueBytes := []byte(value)
 	valueBytesEncoded := base64.URLEncoding.EncodeToString(valueBytes)
-	valueBytesHashed := getHashedBytes(valueBytes)
+	valueBytesHashed := getHashedBytes(purpose, valueBytes)
 	valueBytesHashedEncoded := base64.URLEncoding.EncodeToString(valueBytesHashed)
 	token := fmt.Sprintf("%s|%s", valueBytesEncoded, valueBytesHashedEncoded)
 	return token, expiry
 }
 
-func getUsernameFromToken(token string) (string, error) {
+func getUsernameFromToken(purpose string, token string) (string, error) {
 	split := strings.Split(token, "|")
 	if len(split) != 2 {
 		return "", errors.New("token is not valid")
@@ -126,7 +194,7 @@ func getUsernameFromToken(token string) (string, error) {
 		return "", errors.Join(errors.New("failed to decode token"), err)
 	}
 
-	if !hmac.Equal(getHashedBytes(valueBytes), valueBytesHashed) {
+	if !hmac.Equal(getHashedBytes(purpose, valueBytes), valueBytesHashed) {
 		return "", errors.New("hash is not valid")
 	}
 
@@ -144,12 +212,13 @@ func getUsernameFromToken(token string) (string, error) {
 	return split[0], nil
 }
 
-func getHashedBytes(bytes []byte) []byte {
+func getHashedBytes(purpose string, bytes []byte) []byte {
 	hash := hmac.New(sha256.New, hashSecret)
+	hash.Write([]byte(purpose + "\x00"))
 	hash.Write(bytes)
 	return hash.Sum(nil)
 }
 
 func getExpiry() time.Time {
-	return time.Now().Add(12 * time.Hour)
+	return time.Now().Add(time.Duration(sessionLength.Load()))
 }
@@ -0,0 +1,71 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// returns a request carrying the session cookie of the user
+func newSessionRequest(t *testing.T, username string) *http.Request {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	SetUsername(recorder, httptest.NewRequest("GET", "/", nil), username)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range recorder.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func TestCsrfTokenIsValid(t *testing.T) {
+	err := SetupHashSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = SetupSessionLength(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliceRequest := newSessionRequest(t, "alice")
+	bobRequest := newSessionRequest(t, "bob")
+	aliceCookie, err := aliceRequest.Cookie(cookieNameUserToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		request   *http.Request
+		csrfToken string
+		expected  bool
+	}{
+		{name: "matching token", request: aliceRequest, csrfToken: GetCsrfToken(aliceRequest), expected: true},
+		{name: "token of another session", request: aliceRequest, csrfToken: GetCsrfToken(bobRequest), expected: false},
+		{name: "session token instead of csrf token", request: aliceRequest, csrfToken: aliceCookie.Value, expected: false},
+		{name: "truncated token", request: aliceRequest, csrfToken: GetCsrfToken(aliceRequest)[1:], expected: false},
+		{name: "empty token", request: aliceRequest, csrfToken: "", expected: false},
+		{name: "missing session", request: httptest.NewRequest("GET", "/", nil), csrfToken: GetCsrfToken(aliceRequest), expected: false},
+		{name: "missing session and token", request: httptest.NewRequest("GET", "/", nil), csrfToken: "", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			valid := CsrfTokenIsValid(test.request, test.csrfToken)
+			if valid != test.expected {
+				t.Errorf("valid is %t instead of %t", valid, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetCsrfTokenMissingSession(t *testing.T) {
+	csrfToken := GetCsrfToken(httptest.NewRequest("GET", "/", nil))
+	if csrfToken != "" {
+		t.Errorf("token is %q without a session", csrfToken)
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/grantfbarnes/ground/internal/server/certificate"
+	"github.com/grantfbarnes/ground/internal/system/auth"
+	"github.com/grantfbarnes/ground/internal/system/filesystem"
+	"github.com/grantfbarnes/ground/internal/system/users"
+)
+
+const janitorInterval time.Duration = time.Hour
+
+func runJanitor() {
+	for {
+		cleanUpUserFiles()
+		cleanUpLoginFailures()
+		renewCertificate()
+		time.Sleep(janitorInterval)
+	}
+}
+
+func cleanUpLoginFailures() {
+	err := auth.PruneLoginFailures()
+	if err != nil {
+		slog.Error("janitor failed to prune login failures", "error", err)
+	}
+}
+
+func renewCertificate() {
+	err := certificate.RenewAutoCertificate()
+	if err != nil {
+		slog.Error("janitor failed to renew certificate", "error", err)
+	}
+}
+
+func cleanUpUserFiles() {
+	defer func() {
+		if err := recover(); err != nil {
+			slog.Error("panic occured in janitor", "error", err)
+		}
+	}()
+
+	usernames, err := users.GetUsernames()
+	if err != nil {
+		slog.Error("janitor failed to get usernames", "error", err)
+		return
+	}
+
+	for _, username := range usernames {
+		err = filesystem.PurgeTrash(username)
+		if err != nil {
+			slog.Error("janitor failed to purge trash", "username", username, "error", err)
+		}
+
+		err = filesystem.PruneVersions(username)
+		if err != nil {
+			slog.Error("janitor failed to prune versions", "username", username, "error", err)
+		}
+	}
+
+	spaces, err := filesystem.GetSpaces()
+	if err != nil {
+		slog.Error("janitor failed to get spaces", "error", err)
+		return
+	}
+
+	for _, space := range spaces {
+		err = filesystem.PurgeSpaceTrash(space)
+		if err != nil {
+			slog.Error("janitor failed to purge space trash", "space", space.Name, "error", err)
+		}
+	}
+}
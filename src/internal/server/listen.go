@@ -0,0 +1,225 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const unixSocketPrefix string = "unix:"
+
+// systemd passes activated sockets as consecutive file descriptors starting after stderr
+const systemdListenFdsStart int = 3
+
+type Options struct {
+	Address           string
+	Port              uint
+	RedirectPort      uint
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderSize     uint
+	ShutdownTimeout   time.Duration
+	MetricsAddress    string
+	SocketGroup       string
+}
+
+// sockets handed over by systemd replace the configured addresses
+func getListeners(addresses string, port uint, socketGroup string) ([]net.Listener, error) {
+	listeners, err := getSystemdListeners()
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to get systemd sockets"), err)
+	}
+	if len(listeners) > 0 {
+		return listeners, nil
+	}
+
+	for _, address := range splitAddresses(addresses) {
+		var listener net.Listener
+		if socketPath, ok := strings.CutPrefix(address, unixSocketPrefix); ok {
+			listener, err = listenUnix(socketPath, socketGroup)
+		} else {
+			listener, err = net.Listen("tcp", getTcpAddress(address, port))
+		}
+		if err != nil {
+			closeListeners(listeners)
+			return nil, errors.Join(fmt.Errorf("failed to listen on '%s'", address), err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
+// unix sockets are left out, they are only reached through a local proxy that handles https itself
+func getRedirectListeners(addresses string, port uint) ([]net.Listener, error) {
+	listeners := []net.Listener{}
+	for _, address := range splitAddresses(addresses) {
+		if strings.HasPrefix(address, unixSocketPrefix) {
+			continue
+		}
+
+		listener, err := net.Listen("tcp", getTcpAddress(address, port))
+		if err != nil {
+			closeListeners(listeners)
+			return nil, errors.Join(fmt.Errorf("failed to listen on '%s'", address), err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// metrics get their own addresses, usually loopback or a private interface, each with its own port
+func getMetricsListeners(addresses string, socketGroup string) ([]net.Listener, error) {
+	listeners := []net.Listener{}
+	for _, address := range splitAddresses(addresses) {
+		var listener net.Listener
+		var err error
+		if socketPath, ok := strings.CutPrefix(address, unixSocketPrefix); ok {
+			listener, err = listenUnix(socketPath, socketGroup)
+		} else {
+			listener, err = net.Listen("tcp", address)
+		}
+		if err != nil {
+			closeListeners(listeners)
+			return nil, errors.Join(fmt.Errorf("failed to listen on '%s'", address), err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// an empty list listens on all interfaces
+func splitAddresses(addresses string) []string {
+	split := []string{}
+	for address := range strings.SplitSeq(addresses, ",") {
+		address = strings.TrimSpace(address)
+		if address != "" {
+			split = append(split, address)
+		}
+	}
+
+	if len(split) == 0 {
+		split = append(split, "")
+	}
+	return split
+}
+
+// takes a host, a bracketed or bare ipv6 address, or a host with its own port
+func getTcpAddress(address string, port uint) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(strings.Trim(address, "[]"), strconv.FormatUint(uint64(port), 10))
+}
+
+func listenUnix(socketPath string, socketGroup string) (net.Listener, error) {
+	// a socket left behind by an unclean exit would make listening fail
+	info, err := os.Lstat(socketPath)
+	if err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New("path exists and is not a socket")
+		}
+		err = os.Remove(socketPath)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to remove stale socket"), err)
+		}
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if socketGroup != "" {
+		group, err := user.LookupGroup(socketGroup)
+		if err != nil {
+			listener.Close()
+			return nil, errors.Join(errors.New("failed to lookup socket group"), err)
+		}
+
+		gid, err := strconv.Atoi(group.Gid)
+		if err != nil {
+			listener.Close()
+			return nil, errors.Join(errors.New("failed to parse socket group id"), err)
+		}
+
+		err = os.Chown(socketPath, -1, gid)
+		if err != nil {
+			listener.Close()
+			return nil, errors.Join(errors.New("failed to set socket group"), err)
+		}
+	}
+
+	err = os.Chmod(socketPath, 0660)
+	if err != nil {
+		listener.Close()
+		return nil, errors.Join(errors.New("failed to set socket permissions"), err)
+	}
+
+	return listener, nil
+}
+
+func getSystemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+
+	// children must not think the sockets were meant for them
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := []net.Listener{}
+	for fd := systemdListenFdsStart; fd < systemdListenFdsStart+count; fd++ {
+		file := os.NewFile(uintptr(fd), "systemd-socket-"+strconv.Itoa(fd))
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			closeListeners(listeners)
+			return nil, errors.Join(fmt.Errorf("file descriptor %d is not a listening socket", fd), err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
+
+// a link to print at startup, the machine's address stands in for all interfaces
+func getListenerUrl(listener net.Listener, scheme string) string {
+	if listener.Addr().Network() == "unix" {
+		return unixSocketPrefix + listener.Addr().String()
+	}
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		return listener.Addr().String()
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		localIp, err := getLocalIPv4()
+		if err == nil {
+			host = localIp.String()
+		}
+	}
+
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
@@ -0,0 +1,338 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const logDirPath string = "/etc/ground/logs"
+const memoryRecordsMax int = 10000
+
+// the file is moved aside once it grows past this, so at most two files are kept on disk
+const logFileMaxSize int64 = 5 * 1000 * 1000
+
+const subscriberBuffer int = 256
+
+var logFilePath string = path.Join(logDirPath, "ground.log")
+var previousLogFilePath string = logFilePath + ".1"
+
+var recordsMutex sync.Mutex
+var records [memoryRecordsMax]Record
+var recordsNext int
+var recordsCount int
+var lastRecordId uint64
+
+var logFile *os.File
+var logFileSize int64
+var logFileFailed bool
+
+var subscribers map[chan Record]bool = make(map[chan Record]bool)
+
+// attributes keep the order they were logged in, error values keep the newlines errors.Join puts between them
+type Record struct {
+	Id      uint64    `json:"id"`
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	Attrs   []Attr    `json:"attrs"`
+}
+
+type Attr struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type Filter struct {
+	Level  slog.Level
+	User   string
+	Ip     string
+	Search string
+}
+
+// records still go to stderr as text, a copy is kept in memory for the viewer and on disk to survive restarts
+func Setup() error {
+	slog.SetDefault(slog.New(&handler{next: slog.NewTextHandler(os.Stderr, nil)}))
+
+	err := os.MkdirAll(logDirPath, 0700)
+	if err != nil {
+		return errors.Join(errors.New("failed to create log directory"), err)
+	}
+
+	recordsMutex.Lock()
+	defer recordsMutex.Unlock()
+
+	for _, filePath := range []string{previousLogFilePath, logFilePath} {
+		err = loadLogFile(filePath)
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to load '%s'", filePath), err)
+		}
+	}
+
+	return openLogFile()
+}
+
+// oldest first, at most limit of the newest records that match and come after the given id
+func GetRecords(filter Filter, afterId uint64, limit int) []Record {
+	recordsMutex.Lock()
+	defer recordsMutex.Unlock()
+
+	matching := []Record{}
+	for i := range recordsCount {
+		record := records[(recordsNext-1-i+memoryRecordsMax)%memoryRecordsMax]
+		if record.Id <= afterId {
+			break
+		}
+		if !filter.Matches(record) {
+			continue
+		}
+		matching = append(matching, record)
+		if len(matching) >= limit {
+			break
+		}
+	}
+
+	slices.Reverse(matching)
+	return matching
+}
+
+// new records are sent until the returned function is called or streams are stopped, a reader that falls behind misses records
+func Subscribe() (chan Record, func()) {
+	recordsMutex.Lock()
+	defer recordsMutex.Unlock()
+
+	subscriber := make(chan Record, subscriberBuffer)
+	subscribers[subscriber] = true
+
+	return subscriber, func() {
+		recordsMutex.Lock()
+		defer recordsMutex.Unlock()
+		if subscribers[subscriber] {
+			delete(subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// live streams would otherwise keep a graceful shutdown waiting until its timeout
+func StopStreams() {
+	recordsMutex.Lock()
+	defer recordsMutex.Unlock()
+
+	for subscriber := range subscribers {
+		delete(subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+func (filter Filter) Matches(record Record) bool {
+	level := slog.LevelInfo
+	err := level.UnmarshalText([]byte(record.Level))
+	if err == nil && level < filter.Level {
+		return false
+	}
+
+	if filter.User != "" && !record.hasAttr(filter.User, "requestor", "username", "owner") {
+		return false
+	}
+
+	if filter.Ip != "" && !record.hasAttr(filter.Ip, "ip") {
+		return false
+	}
+
+	if filter.Search != "" {
+		search := strings.ToLower(filter.Search)
+		if strings.Contains(strings.ToLower(record.Message), search) {
+			return true
+		}
+		for _, attr := range record.Attrs {
+			if strings.Contains(strings.ToLower(attr.Value), search) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func (record Record) hasAttr(value string, keys ...string) bool {
+	for _, attr := range record.Attrs {
+		if attr.Value == value && slices.Contains(keys, attr.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// called with the records mutex held
+func storeRecord(record Record) {
+	lastRecordId++
+	record.Id = lastRecordId
+	addToMemory(record)
+	writeToFile(record)
+
+	for subscriber := range subscribers {
+		select {
+		case subscriber <- record:
+		default:
+		}
+	}
+}
+
+func addToMemory(record Record) {
+	records[recordsNext] = record
+	recordsNext = (recordsNext + 1) % memoryRecordsMax
+	recordsCount = min(recordsCount+1, memoryRecordsMax)
+	lastRecordId = max(lastRecordId, record.Id)
+}
+
+// failures are reported once on stderr, logging them through slog would come straight back here
+func writeToFile(record Record) {
+	if logFile == nil {
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err == nil {
+		line = append(line, '\n')
+		if logFileSize+int64(len(line)) > logFileMaxSize {
+			err = rotateLogFile()
+		}
+	}
+	if err == nil {
+		var n int
+		n, err = logFile.Write(line)
+		logFileSize += int64(n)
+	}
+
+	if err != nil && !logFileFailed {
+		logFileFailed = true
+		fmt.Fprintln(os.Stderr, "failed to write log file, later failures are not reported:", err)
+	}
+}
+
+func rotateLogFile() error {
+	logFile.Close()
+	logFile = nil
+
+	err := os.Rename(logFilePath, previousLogFilePath)
+	if err != nil {
+		return errors.Join(errors.New("failed to rotate log file"), err)
+	}
+
+	return openLogFile()
+}
+
+func openLogFile() error {
+	file, err := os.OpenFile(logFilePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Join(errors.New("failed to open log file"), err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Join(errors.New("failed to stat log file"), err)
+	}
+
+	logFile = file
+	logFileSize = info.Size()
+	return nil
+}
+
+func loadLogFile(filePath string) error {
+	file, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), int(logFileMaxSize))
+	for scanner.Scan() {
+		record := Record{}
+		// a line cut short by a crash is skipped
+		if json.Unmarshal(scanner.Bytes(), &record) == nil {
+			addToMemory(record)
+		}
+	}
+	return scanner.Err()
+}
+
+type handler struct {
+	next   slog.Handler
+	attrs  []Attr
+	prefix string
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	record := Record{
+		Time:    r.Time,
+		Level:   r.Level.String(),
+		Message: r.Message,
+		Attrs:   slices.Clone(h.attrs),
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		record.Attrs = appendAttr(record.Attrs, h.prefix, attr)
+		return true
+	})
+
+	recordsMutex.Lock()
+	storeRecord(record)
+	recordsMutex.Unlock()
+
+	return h.next.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	newAttrs := slices.Clone(h.attrs)
+	for _, attr := range attrs {
+		newAttrs = appendAttr(newAttrs, h.prefix, attr)
+	}
+	return &handler{next: h.next.WithAttrs(attrs), attrs: newAttrs, prefix: h.prefix}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &handler{next: h.next.WithGroup(name), attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+// groups are flattened into dotted keys, the same way the text handler writes them
+func appendAttr(attrs []Attr, prefix string, attr slog.Attr) []Attr {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return attrs
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix += attr.Key + "."
+		}
+		for _, groupAttr := range attr.Value.Group() {
+			attrs = appendAttr(attrs, groupPrefix, groupAttr)
+		}
+		return attrs
+	}
+
+	return append(attrs, Attr{Key: prefix + attr.Key, Value: attr.Value.String()})
+}
@@ -0,0 +1,351 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grantfbarnes/ground/internal/server/common"
+	"github.com/grantfbarnes/ground/internal/system/monitor"
+)
+
+// sessions are signed cookies without server side state, so a session counts as active while its user keeps making requests
+const activeSessionWindow time.Duration = 15 * time.Minute
+
+var durationBuckets []float64 = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+var knownMethods []string = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+
+var token atomic.Pointer[string]
+
+var requestMutex sync.Mutex
+var requestCounts map[requestKey]uint64 = make(map[requestKey]uint64)
+var requestDurations map[string]*histogram = make(map[string]*histogram)
+
+var uploadBytes atomic.Uint64
+var downloadBytes atomic.Uint64
+var failedLogins atomic.Uint64
+var rateLimitedLogins atomic.Uint64
+
+var sessionMutex sync.Mutex
+var sessionLastSeen map[string]time.Time = make(map[string]time.Time)
+
+var jobMutex sync.Mutex
+
+// listed up front so each series exists before its first job runs
+var runningJobs map[string]int = map[string]int{"upload": 0, "compress": 0, "extract": 0}
+
+type requestKey struct {
+	route  string
+	method string
+	code   int
+}
+
+type histogram struct {
+	bucketCounts []uint64
+	count        uint64
+	sum          float64
+}
+
+func SetupToken(metricsToken string) {
+	token.Store(&metricsToken)
+}
+
+// counts requests by the route pattern they matched, so it has to wrap the mux itself
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		defer func() {
+			status := recorder.status
+			err := recover()
+			if err != nil {
+				status = http.StatusInternalServerError
+			}
+
+			recordRequest(r, status, time.Since(start))
+
+			if err != nil {
+				panic(err)
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// the main listener only serves metrics to scrapers that know the token
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if getToken() == "" {
+		http.NotFound(w, r)
+		return
+	}
+	serveMetrics(w, r)
+}
+
+// a dedicated listener is restricted by the address it listens on, a token is still checked when one is set
+func ListenerHandler(w http.ResponseWriter, r *http.Request) {
+	serveMetrics(w, r)
+}
+
+func CountUpload(body io.ReadCloser) io.ReadCloser {
+	return &countingReader{ReadCloser: body}
+}
+
+func CountDownload(w http.ResponseWriter) http.ResponseWriter {
+	return &countingWriter{ResponseWriter: w}
+}
+
+func CountFailedLogin() {
+	failedLogins.Add(1)
+}
+
+func CountRateLimitedLogin() {
+	rateLimitedLogins.Add(1)
+}
+
+func RecordSession(username string) {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+	sessionLastSeen[username] = time.Now()
+}
+
+// marks a long running operation as started, the returned function marks it as finished
+func StartJob(job string) func() {
+	jobMutex.Lock()
+	runningJobs[job]++
+	jobMutex.Unlock()
+
+	return func() {
+		jobMutex.Lock()
+		runningJobs[job]--
+		jobMutex.Unlock()
+	}
+}
+
+func getToken() string {
+	metricsToken := token.Load()
+	if metricsToken == nil {
+		return ""
+	}
+	return *metricsToken
+}
+
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	metricsToken := getToken()
+	if metricsToken != "" {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(metricsToken)) != 1 {
+			slog.Warn("metrics token is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Metrics token is not valid.", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var b strings.Builder
+	writeRequestMetrics(&b)
+	writeCounter(&b, "ground_upload_bytes_total", "Bytes received in file uploads.", uploadBytes.Load())
+	writeCounter(&b, "ground_download_bytes_total", "Bytes of file content sent, including files viewed in the browser.", downloadBytes.Load())
+	writeCounter(&b, "ground_login_failures_total", "Failed login attempts.", failedLogins.Load())
+	writeCounter(&b, "ground_login_rate_limited_total", "Login attempts rejected because the address or user is throttled.", rateLimitedLogins.Load())
+	writeSessionMetrics(&b)
+	writeJobMetrics(&b)
+	writeDiskMetrics(&b)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = io.WriteString(w, b.String())
+}
+
+func recordRequest(r *http.Request, status int, duration time.Duration) {
+	// patterns are a fixed set, unlike paths, so they are safe to use as a label
+	route := "unmatched"
+	if r.Pattern != "" {
+		_, patternPath, found := strings.Cut(r.Pattern, " ")
+		if !found {
+			patternPath = r.Pattern
+		}
+		route = patternPath
+	}
+
+	method := r.Method
+	if !slices.Contains(knownMethods, method) {
+		method = "other"
+	}
+
+	requestMutex.Lock()
+	defer requestMutex.Unlock()
+
+	requestCounts[requestKey{route: route, method: method, code: status}]++
+
+	routeHistogram, ok := requestDurations[route]
+	if !ok {
+		routeHistogram = &histogram{bucketCounts: make([]uint64, len(durationBuckets))}
+		requestDurations[route] = routeHistogram
+	}
+
+	seconds := duration.Seconds()
+	for i, bucket := range durationBuckets {
+		if seconds <= bucket {
+			routeHistogram.bucketCounts[i]++
+		}
+	}
+	routeHistogram.count++
+	routeHistogram.sum += seconds
+}
+
+func writeRequestMetrics(b *strings.Builder) {
+	requestMutex.Lock()
+	defer requestMutex.Unlock()
+
+	keys := make([]requestKey, 0, len(requestCounts))
+	for key := range requestCounts {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b requestKey) int {
+		return strings.Compare(fmt.Sprintf("%s %s %d", a.route, a.method, a.code), fmt.Sprintf("%s %s %d", b.route, b.method, b.code))
+	})
+
+	writeHeader(b, "ground_http_requests_total", "counter", "HTTP requests by route, method and status code.")
+	for _, key := range keys {
+		fmt.Fprintf(b, "ground_http_requests_total{route=\"%s\",method=\"%s\",code=\"%d\"} %d\n", escapeLabel(key.route), key.method, key.code, requestCounts[key])
+	}
+
+	routes := make([]string, 0, len(requestDurations))
+	for route := range requestDurations {
+		routes = append(routes, route)
+	}
+	slices.Sort(routes)
+
+	writeHeader(b, "ground_http_request_duration_seconds", "histogram", "Time taken to handle HTTP requests by route.")
+	for _, route := range routes {
+		routeHistogram := requestDurations[route]
+		label := escapeLabel(route)
+		for i, bucket := range durationBuckets {
+			fmt.Fprintf(b, "ground_http_request_duration_seconds_bucket{route=\"%s\",le=\"%g\"} %d\n", label, bucket, routeHistogram.bucketCounts[i])
+		}
+		fmt.Fprintf(b, "ground_http_request_duration_seconds_bucket{route=\"%s\",le=\"+Inf\"} %d\n", label, routeHistogram.count)
+		fmt.Fprintf(b, "ground_http_request_duration_seconds_sum{route=\"%s\"} %g\n", label, routeHistogram.sum)
+		fmt.Fprintf(b, "ground_http_request_duration_seconds_count{route=\"%s\"} %d\n", label, routeHistogram.count)
+	}
+}
+
+func writeSessionMetrics(b *strings.Builder) {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	expiry := time.Now().Add(-activeSessionWindow)
+	for username, lastSeen := range sessionLastSeen {
+		if lastSeen.Before(expiry) {
+			delete(sessionLastSeen, username)
+		}
+	}
+
+	writeHeader(b, "ground_active_sessions", "gauge", fmt.Sprintf("Users with a valid session that made a request in the last %s.", activeSessionWindow))
+	fmt.Fprintf(b, "ground_active_sessions %d\n", len(sessionLastSeen))
+}
+
+func writeJobMetrics(b *strings.Builder) {
+	jobMutex.Lock()
+	defer jobMutex.Unlock()
+
+	jobs := make([]string, 0, len(runningJobs))
+	for job := range runningJobs {
+		jobs = append(jobs, job)
+	}
+	slices.Sort(jobs)
+
+	writeHeader(b, "ground_jobs_running", "gauge", "Long running operations in progress, such as uploads, compressing and extracting.")
+	for _, job := range jobs {
+		fmt.Fprintf(b, "ground_jobs_running{job=\"%s\"} %d\n", escapeLabel(job), runningJobs[job])
+	}
+}
+
+func writeDiskMetrics(b *strings.Builder) {
+	usedBytes, sizeBytes, err := monitor.GetHomeDiskUsage()
+	if err != nil {
+		slog.Error("failed to get home disk usage", "error", err)
+		return
+	}
+
+	writeHeader(b, "ground_home_disk_size_bytes", "gauge", "Size of the filesystem holding the home directories.")
+	fmt.Fprintf(b, "ground_home_disk_size_bytes %d\n", sizeBytes)
+	writeHeader(b, "ground_home_disk_used_bytes", "gauge", "Used space on the filesystem holding the home directories.")
+	fmt.Fprintf(b, "ground_home_disk_used_bytes %d\n", usedBytes)
+}
+
+func writeCounter(b *strings.Builder, name string, help string, value uint64) {
+	writeHeader(b, name, "counter", help)
+	fmt.Fprintf(b, "%s %d\n", name, value)
+}
+
+func writeHeader(b *strings.Builder, name string, metricType string, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if !recorder.wroteHeader {
+		recorder.status = status
+		recorder.wroteHeader = true
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(b []byte) (int, error) {
+	recorder.wroteHeader = true
+	return recorder.ResponseWriter.Write(b)
+}
+
+// streamed responses still need to reach the client before the handler returns
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+type countingReader struct {
+	io.ReadCloser
+}
+
+func (reader *countingReader) Read(b []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(b)
+	uploadBytes.Add(uint64(n))
+	return n, err
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+}
+
+func (writer *countingWriter) Write(b []byte) (int, error) {
+	n, err := writer.ResponseWriter.Write(b)
+	downloadBytes.Add(uint64(n))
+	return n, err
+}
+
+func (writer *countingWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
@@ -9,35 +9,63 @@ import (
 	"path"
 	"strings"
 
+	"github.com/grantfbarnes/ground/internal/server/certificate"
 	"github.com/grantfbarnes/ground/internal/server/common"
 	"github.com/grantfbarnes/ground/internal/server/cookie"
+	"github.com/grantfbarnes/ground/internal/server/metrics"
+	"github.com/grantfbarnes/ground/internal/system/audit"
+	"github.com/grantfbarnes/ground/internal/system/auth"
+	"github.com/grantfbarnes/ground/internal/system/execute"
 	"github.com/grantfbarnes/ground/internal/system/filesystem"
 	"github.com/grantfbarnes/ground/internal/system/monitor"
+	"github.com/grantfbarnes/ground/internal/system/services"
 	"github.com/grantfbarnes/ground/internal/system/users"
 )
 
 //go:embed templates
 var templates embed.FS
 
+const serviceActionsShown int = 10
+
+type filesPage struct {
+	PageTitle           string
+	Username            string
+	IsAdmin             bool
+	Path                string
+	RootPath            string
+	FilesUrl            string
+	RootName            string
+	Space               string
+	Share               string
+	IsHome              bool
+	CanWrite            bool
+	FilePathBreadcrumbs []filesystem.FilePathBreadcrumb
+	DirectoryEntries    []filesystem.DirectoryEntryData
+}
+
 func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		username, err := cookie.GetUsername(r)
 		loggedIn := err == nil
 		if !loggedIn {
-			cookie.RemoveUsername(w)
+			cookie.RemoveUsername(w, r)
 		}
 
 		if r.URL.Path == "/login" {
 			if loggedIn {
-				http.Redirect(w, r, cookie.GetRedirectUrl(r), http.StatusSeeOther)
+				http.Redirect(w, r, common.GetUrl(cookie.GetRedirectUrl(r)), http.StatusSeeOther)
 				return
 			}
 		} else if !loggedIn {
-			cookie.SetRedirectUrl(w, r.URL.Path)
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			cookie.SetRedirectUrl(w, r, r.URL.Path)
+			http.Redirect(w, r, common.GetUrl("/login"), http.StatusSeeOther)
 			return
 		}
 
+		if loggedIn {
+			metrics.RecordSession(username)
+		}
+
 		next.ServeHTTP(w, common.GetRequestWithRequestor(r, username))
 	})
 }
@@ -45,13 +73,13 @@ func Middleware(next http.Handler) http.Handler {
 func Home(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 
-	tmpl, err := template.ParseFS(
+	tmpl, err := template.New("").Funcs(getTemplateFuncs(r)).ParseFS(
 		templates,
 		"templates/pages/base.html",
 		"templates/pages/bodies/home.html",
 	)
 	if err != nil {
-		slog.Error("failed to generate html", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to generate html", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "There was a problem generating the HTML for the requested page.")
 		return
 	}
@@ -68,25 +96,29 @@ func Home(w http.ResponseWriter, r *http.Request) {
 }
 
 func Login(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFS(
+	tmpl, err := template.New("").Funcs(getTemplateFuncs(r)).ParseFS(
 		templates,
 		"templates/pages/base.html",
 		"templates/pages/bodies/login.html",
 	)
 	if err != nil {
-		slog.Error("failed to generate html", "ip", r.RemoteAddr, "request", r.URL.Path, "error", err)
+		slog.Error("failed to generate html", "ip", common.GetClientIp(r), "request", r.URL.Path, "error", err)
 		getProblemPage(w, r, "There was a problem generating the HTML for the requested page.")
 		return
 	}
 
 	_ = tmpl.ExecuteTemplate(w, "base", struct {
-		PageTitle string
-		Username  string
-		IsAdmin   bool
+		PageTitle              string
+		Username               string
+		IsAdmin                bool
+		PasswordRequirements   []string
+		CaCertificateAvailable bool
 	}{
-		PageTitle: "Ground - Login",
-		Username:  "",
-		IsAdmin:   false,
+		PageTitle:              "Ground - Login",
+		Username:               "",
+		IsAdmin:                false,
+		PasswordRequirements:   auth.PasswordPolicyRequirements(),
+		CaCertificateAvailable: certificate.CaIsAvailable(),
 	})
 }
 
@@ -98,66 +130,265 @@ func Files(w http.ResponseWriter, r *http.Request) {
 	sortBy := r.URL.Query().Get("sortBy")
 	sortOrder := r.URL.Query().Get("sortOrder")
 
-	homePath := path.Join("/home", requestor)
-	urlRootPath := path.Join(homePath, urlRelativePath)
-	urlRootPath = path.Clean(urlRootPath)
+	resolver, err := filesystem.NewHomePathResolver(requestor)
+	if err != nil {
+		slog.Error("failed to resolve home", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem finding your home directory.")
+		return
+	}
 
-	if !strings.HasPrefix(urlRootPath, homePath) {
-		slog.Warn("path outside of home", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+	urlRootPath, err := resolver.Resolve(urlRelativePath)
+	if err != nil {
+		slog.Warn("path outside of home", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "The requested file path is not in your home directory.")
 		return
 	}
 
 	urlPathInfo, err := os.Stat(urlRootPath)
 	if err != nil {
-		slog.Warn("failed to find path", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Warn("failed to find path", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "The requested file path could not be found in your home directory.")
 		return
 	}
 
 	if !urlPathInfo.IsDir() {
-		http.Redirect(w, r, path.Join("/file", urlRelativePath), http.StatusSeeOther)
+		http.Redirect(w, r, common.GetUrl(path.Join("/file", urlRelativePath)), http.StatusSeeOther)
 		return
 	}
 
 	if urlTrashPath, ok := strings.CutPrefix(urlRelativePath, "/"+filesystem.TRASH_HOME_PATH); ok {
-		http.Redirect(w, r, path.Join("/trash", urlTrashPath), http.StatusSeeOther)
+		http.Redirect(w, r, common.GetUrl(path.Join("/trash", urlTrashPath)), http.StatusSeeOther)
 		return
 	}
 
-	directoryEntries, err := filesystem.GetDirectoryEntries(urlRelativePath, urlRootPath, searchFilter, showDotfiles, sortBy, sortOrder)
+	directoryEntries, err := filesystem.GetDirectoryEntries(requestor, resolver, "/files", "/file", urlRelativePath, searchFilter, showDotfiles, sortBy, sortOrder)
 	if err != nil {
-		slog.Error("failed to get directory entries", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to get directory entries", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "There was a problem getting the directory entries for this requested file path.")
 		return
 	}
 
-	tmpl, err := template.ParseFS(
+	getFilesPage(w, r, filesPage{
+		PageTitle:           "Ground - Files",
+		Username:            requestor,
+		IsAdmin:             users.IsAdmin(requestor),
+		Path:                urlRelativePath,
+		RootPath:            urlRootPath,
+		FilesUrl:            "/files",
+		RootName:            "home",
+		Space:               "",
+		Share:               "",
+		IsHome:              true,
+		CanWrite:            true,
+		FilePathBreadcrumbs: filesystem.GetFileBreadcrumbs(urlRelativePath),
+		DirectoryEntries:    directoryEntries,
+	})
+}
+
+func Spaces(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+
+	spaces, err := filesystem.GetUserSpaces(requestor)
+	if err != nil {
+		slog.Error("failed to get spaces", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem getting the list of shared spaces.")
+		return
+	}
+
+	usernames, err := users.GetUsernames()
+	if err != nil {
+		slog.Error("failed to get usernames", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem getting the list of system users.")
+		return
+	}
+
+	sharesWithMe, err := filesystem.GetRecipientShares(requestor, usernames)
+	if err != nil {
+		slog.Error("failed to get recipient shares", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem getting the list of directories shared with you.")
+		return
+	}
+
+	sharesByMe, err := filesystem.GetOwnerShares(requestor)
+	if err != nil {
+		slog.Error("failed to get owner shares", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem getting the list of directories you have shared.")
+		return
+	}
+
+	tmpl, err := template.New("").Funcs(getTemplateFuncs(r)).ParseFS(
 		templates,
 		"templates/pages/base.html",
-		"templates/pages/bodies/files.html",
+		"templates/pages/bodies/spaces.html",
 	)
 	if err != nil {
-		slog.Error("failed to generate html", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to generate html", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "There was a problem generating the HTML for the requested page.")
 		return
 	}
 
 	_ = tmpl.ExecuteTemplate(w, "base", struct {
-		PageTitle           string
-		Username            string
-		IsAdmin             bool
-		Path                string
-		RootPath            string
-		FilePathBreadcrumbs []filesystem.FilePathBreadcrumb
-		DirectoryEntries    []filesystem.DirectoryEntryData
+		PageTitle    string
+		Username     string
+		IsAdmin      bool
+		Spaces       []filesystem.Space
+		SharesWithMe []filesystem.Share
+		SharesByMe   []filesystem.Share
 	}{
-		PageTitle:           "Ground - Files",
+		PageTitle:    "Ground - Shared",
+		Username:     requestor,
+		IsAdmin:      users.IsAdmin(requestor),
+		Spaces:       spaces,
+		SharesWithMe: sharesWithMe,
+		SharesByMe:   sharesByMe,
+	})
+}
+
+func Space(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	spaceName := r.PathValue("space")
+	urlRelativePath := path.Join("/", r.PathValue("path"))
+	searchFilter := r.URL.Query().Get("searchFilter")
+	showDotfiles := r.URL.Query().Get("showDotfiles")
+	sortBy := r.URL.Query().Get("sortBy")
+	sortOrder := r.URL.Query().Get("sortOrder")
+
+	spacePath, canRead, canWrite := filesystem.GetSpaceAccess(requestor, spaceName)
+	if !canRead {
+		slog.Warn("space not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", spaceName)
+		getProblemPage(w, r, "The requested shared space is not accessible.")
+		return
+	}
+
+	resolver, err := filesystem.NewPathResolver(spacePath)
+	if err != nil {
+		slog.Error("failed to resolve space", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem finding the shared space.")
+		return
+	}
+
+	urlRootPath, err := resolver.Resolve(urlRelativePath)
+	if err != nil {
+		slog.Warn("path outside of space", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "The requested file path is not in the shared space.")
+		return
+	}
+
+	urlPathInfo, err := os.Stat(urlRootPath)
+	if err != nil {
+		slog.Warn("failed to find path", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "The requested file path could not be found in the shared space.")
+		return
+	}
+
+	if !urlPathInfo.IsDir() {
+		err = filesystem.ServeFile(metrics.CountDownload(w), r, requestor, urlRootPath)
+		if err != nil {
+			slog.Error("failed to serve file", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+			getProblemPage(w, r, "There was a problem serving the requested file.")
+		}
+		return
+	}
+
+	if urlTrashPath, ok := strings.CutPrefix(urlRelativePath, "/"+filesystem.SPACE_TRASH_PATH); ok && canWrite && (urlTrashPath == "" || strings.HasPrefix(urlTrashPath, "/")) {
+		http.Redirect(w, r, common.GetUrl(path.Join("/shared-trash", spaceName, urlTrashPath)), http.StatusSeeOther)
+		return
+	}
+
+	spaceUrl := path.Join("/shared", spaceName)
+	directoryEntries, err := filesystem.GetDirectoryEntries(requestor, resolver, spaceUrl, spaceUrl, urlRelativePath, searchFilter, showDotfiles, sortBy, sortOrder)
+	if err != nil {
+		slog.Error("failed to get directory entries", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem getting the directory entries for this requested file path.")
+		return
+	}
+
+	getFilesPage(w, r, filesPage{
+		PageTitle:           "Ground - Shared",
 		Username:            requestor,
 		IsAdmin:             users.IsAdmin(requestor),
 		Path:                urlRelativePath,
 		RootPath:            urlRootPath,
-		FilePathBreadcrumbs: filesystem.GetFileBreadcrumbs(urlRelativePath),
+		FilesUrl:            spaceUrl,
+		RootName:            spaceName,
+		Space:               spaceName,
+		Share:               "",
+		IsHome:              false,
+		CanWrite:            canWrite,
+		FilePathBreadcrumbs: filesystem.GetSharedBreadcrumbs(spaceName, urlRelativePath),
+		DirectoryEntries:    directoryEntries,
+	})
+}
+
+func Share(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	owner := r.PathValue("owner")
+	shareId := r.PathValue("id")
+	urlRelativePath := path.Join("/", r.PathValue("path"))
+	searchFilter := r.URL.Query().Get("searchFilter")
+	showDotfiles := r.URL.Query().Get("showDotfiles")
+	sortBy := r.URL.Query().Get("sortBy")
+	sortOrder := r.URL.Query().Get("sortOrder")
+
+	sharePath, canRead, canWrite := filesystem.GetShareAccess(requestor, owner, shareId)
+	if !canRead || !common.GetFeatures().Shares {
+		slog.Warn("share not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "owner", owner, "share", shareId)
+		getProblemPage(w, r, "The requested shared directory is not accessible.")
+		return
+	}
+
+	resolver, err := filesystem.NewSharePathResolver(owner, sharePath)
+	if err != nil {
+		slog.Error("failed to resolve share", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem finding the shared directory.")
+		return
+	}
+
+	urlRootPath, err := resolver.Resolve(urlRelativePath)
+	if err != nil {
+		slog.Warn("path outside of share", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "The requested file path is not in the shared directory.")
+		return
+	}
+
+	urlPathInfo, err := os.Stat(urlRootPath)
+	if err != nil {
+		slog.Warn("failed to find path", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "The requested file path could not be found in the shared directory.")
+		return
+	}
+
+	if !urlPathInfo.IsDir() {
+		err = filesystem.ServeFile(metrics.CountDownload(w), r, owner, urlRootPath)
+		if err != nil {
+			slog.Error("failed to serve file", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+			getProblemPage(w, r, "There was a problem serving the requested file.")
+		}
+		return
+	}
+
+	shareUrl := path.Join("/share", owner, shareId)
+	directoryEntries, err := filesystem.GetDirectoryEntries(owner, resolver, shareUrl, shareUrl, urlRelativePath, searchFilter, showDotfiles, sortBy, sortOrder)
+	if err != nil {
+		slog.Error("failed to get directory entries", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem getting the directory entries for this requested file path.")
+		return
+	}
+
+	shareName := path.Base(sharePath)
+	getFilesPage(w, r, filesPage{
+		PageTitle:           "Ground - Shared",
+		Username:            requestor,
+		IsAdmin:             users.IsAdmin(requestor),
+		Path:                urlRelativePath,
+		RootPath:            urlRootPath,
+		FilesUrl:            shareUrl,
+		RootName:            shareName,
+		Space:               "",
+		Share:               path.Join(owner, shareId),
+		IsHome:              false,
+		CanWrite:            canWrite,
+		FilePathBreadcrumbs: filesystem.GetSharedBreadcrumbs(shareName, urlRelativePath),
 		DirectoryEntries:    directoryEntries,
 	})
 }
@@ -166,143 +397,279 @@ func File(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 	urlRelativePath := strings.TrimPrefix(r.URL.Path, "/file")
 
-	homePath := path.Join("/home", requestor)
-	urlRootPath := path.Join(homePath, urlRelativePath)
-	urlRootPath = path.Clean(urlRootPath)
+	resolver, err := filesystem.NewHomePathResolver(requestor)
+	if err != nil {
+		slog.Error("failed to resolve home", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem finding your home directory.")
+		return
+	}
 
-	if !strings.HasPrefix(urlRootPath, homePath) {
-		slog.Warn("path outside of home", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+	urlRootPath, err := resolver.Resolve(urlRelativePath)
+	if err != nil {
+		slog.Warn("path outside of home", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "The requested file path is not in your home directory.")
 		return
 	}
 
 	urlPathInfo, err := os.Stat(urlRootPath)
 	if err != nil {
-		slog.Warn("failed to find path", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Warn("failed to find path", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "The requested file path could not be found in your home directory.")
 		return
 	}
 
 	if urlPathInfo.IsDir() {
-		http.Redirect(w, r, path.Join("/files", urlRelativePath), http.StatusSeeOther)
+		http.Redirect(w, r, common.GetUrl(path.Join("/files", urlRelativePath)), http.StatusSeeOther)
 		return
 	}
 
-	http.ServeFile(w, r, urlRootPath)
+	err = filesystem.ServeFile(metrics.CountDownload(w), r, requestor, urlRootPath)
+	if err != nil {
+		slog.Error("failed to serve file", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem serving the requested file.")
+	}
 }
 
-func Trash(w http.ResponseWriter, r *http.Request) {
+func Versions(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
-	urlRelativePath := strings.TrimPrefix(r.URL.Path, "/trash")
-	sortBy := r.URL.Query().Get("sortBy")
-	sortOrder := r.URL.Query().Get("sortOrder")
+	urlRelativePath := strings.TrimPrefix(r.URL.Path, "/versions")
 
-	homePath := path.Join("/home", requestor, filesystem.TRASH_HOME_PATH)
-	urlRootPath := path.Join(homePath, urlRelativePath)
-	urlRootPath = path.Clean(urlRootPath)
+	resolver, err := filesystem.NewHomePathResolver(requestor)
+	if err != nil {
+		slog.Error("failed to resolve home", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem finding your home directory.")
+		return
+	}
 
-	if !strings.HasPrefix(urlRootPath, homePath) {
-		slog.Warn("path outside of home", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+	urlRootPath, err := resolver.Resolve(urlRelativePath)
+	if err != nil {
+		slog.Warn("path outside of home", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "The requested file path is not in your home directory.")
 		return
 	}
 
 	urlPathInfo, err := os.Stat(urlRootPath)
-	if err != nil || !urlPathInfo.IsDir() {
-		http.Redirect(w, r, path.Join("/trash", path.Dir(urlRelativePath)), http.StatusSeeOther)
+	fileExists := err == nil
+	if fileExists && urlPathInfo.IsDir() {
+		http.Redirect(w, r, common.GetUrl(path.Join("/files", urlRelativePath)), http.StatusSeeOther)
 		return
 	}
 
-	trashEntries, err := filesystem.GetTrashEntries(requestor, urlRelativePath, sortBy, sortOrder)
+	versionEntries, err := filesystem.GetVersionEntries(requestor, urlRelativePath)
 	if err != nil {
-		slog.Error("failed to get trash entries", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
-		getProblemPage(w, r, "There was a problem getting the trash entries for this requested file path.")
+		slog.Error("failed to get version entries", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem getting the versions for this requested file path.")
 		return
 	}
 
-	tmpl, err := template.ParseFS(
+	tmpl, err := template.New("").Funcs(getTemplateFuncs(r)).ParseFS(
 		templates,
 		"templates/pages/base.html",
-		"templates/pages/bodies/trash.html",
+		"templates/pages/bodies/versions.html",
 	)
 	if err != nil {
-		slog.Error("failed to generate html", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to generate html", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "There was a problem generating the HTML for the requested page.")
 		return
 	}
 
+	parentPath, fileName := path.Split(urlRelativePath)
 	_ = tmpl.ExecuteTemplate(w, "base", struct {
-		PageTitle           string
-		Username            string
-		IsAdmin             bool
-		Path                string
-		RootPath            string
-		FilePathBreadcrumbs []filesystem.FilePathBreadcrumb
-		TrashEntries        []filesystem.TrashEntryData
+		PageTitle      string
+		Username       string
+		IsAdmin        bool
+		Path           string
+		FileName       string
+		FileExists     bool
+		ParentPath     string
+		VersionEntries []filesystem.VersionEntryData
 	}{
-		PageTitle:           "Ground - Trash",
-		Username:            requestor,
-		IsAdmin:             users.IsAdmin(requestor),
-		Path:                urlRelativePath,
-		RootPath:            urlRootPath,
-		FilePathBreadcrumbs: filesystem.GetTrashBreadcrumbs(urlRelativePath),
-		TrashEntries:        trashEntries,
+		PageTitle:      "Ground - Versions",
+		Username:       requestor,
+		IsAdmin:        users.IsAdmin(requestor),
+		Path:           urlRelativePath,
+		FileName:       fileName,
+		FileExists:     fileExists,
+		ParentPath:     path.Clean(parentPath),
+		VersionEntries: versionEntries,
 	})
 }
 
+func Trash(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	urlRelativePath := strings.TrimPrefix(r.URL.Path, "/trash")
+
+	resolver, err := filesystem.NewHomePathResolver(requestor)
+	if err != nil {
+		slog.Error("failed to resolve home", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem finding your home directory.")
+		return
+	}
+
+	getTrashPage(w, r, resolver, trashPage{
+		PageTitle: "Ground - Trash",
+		Username:  requestor,
+		IsAdmin:   users.IsAdmin(requestor),
+		Path:      urlRelativePath,
+		TrashUrl:  "/trash",
+		FileUrl:   path.Join("/file", filesystem.TRASH_HOME_PATH),
+		TrashPath: filesystem.TRASH_HOME_PATH,
+		Space:     "",
+	})
+}
+
+func SpaceTrash(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+	spaceName := r.PathValue("space")
+	urlRelativePath := path.Join("/", r.PathValue("path"))
+
+	spacePath, _, canWrite := filesystem.GetSpaceAccess(requestor, spaceName)
+	if !canWrite {
+		slog.Warn("space not accessible", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "space", spaceName)
+		getProblemPage(w, r, "The requested shared space is not accessible.")
+		return
+	}
+
+	resolver, err := filesystem.NewPathResolver(spacePath)
+	if err != nil {
+		slog.Error("failed to resolve space", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem finding the shared space.")
+		return
+	}
+
+	getTrashPage(w, r, resolver, trashPage{
+		PageTitle: "Ground - Shared Trash",
+		Username:  requestor,
+		IsAdmin:   users.IsAdmin(requestor),
+		Path:      urlRelativePath,
+		TrashUrl:  path.Join("/shared-trash", spaceName),
+		FileUrl:   path.Join("/shared", spaceName, filesystem.SPACE_TRASH_PATH),
+		TrashPath: filesystem.SPACE_TRASH_PATH,
+		Space:     spaceName,
+	})
+}
+
+func getTrashPage(w http.ResponseWriter, r *http.Request, resolver filesystem.PathResolver, page trashPage) {
+	sortBy := r.URL.Query().Get("sortBy")
+	sortOrder := r.URL.Query().Get("sortOrder")
+
+	urlRootPath, err := resolver.Resolve(path.Join(page.TrashPath, path.Join("/", page.Path)))
+	if err != nil {
+		slog.Warn("path outside of root", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", page.Username, "error", err)
+		getProblemPage(w, r, "The requested file path is not in the trash.")
+		return
+	}
+
+	// a space trash is only created when something is first trashed there
+	urlPathInfo, err := os.Stat(urlRootPath)
+	trashExists := err == nil && urlPathInfo.IsDir()
+	if !trashExists && page.Path != "/" {
+		http.Redirect(w, r, common.GetUrl(path.Join(page.TrashUrl, path.Dir(page.Path))), http.StatusSeeOther)
+		return
+	}
+
+	trashEntries := []filesystem.TrashEntryData{}
+	if trashExists {
+		trashEntries, err = filesystem.GetTrashEntries(page.Username, resolver, page.TrashUrl, page.FileUrl, page.Path, sortBy, sortOrder)
+		if err != nil {
+			slog.Error("failed to get trash entries", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", page.Username, "error", err)
+			getProblemPage(w, r, "There was a problem getting the trash entries for this requested file path.")
+			return
+		}
+	}
+
+	tmpl, err := template.New("").Funcs(getTemplateFuncs(r)).ParseFS(
+		templates,
+		"templates/pages/base.html",
+		"templates/pages/bodies/trash.html",
+	)
+	if err != nil {
+		slog.Error("failed to generate html", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", page.Username, "error", err)
+		getProblemPage(w, r, "There was a problem generating the HTML for the requested page.")
+		return
+	}
+
+	page.RootPath = urlRootPath
+	page.FilePathBreadcrumbs = filesystem.GetTrashBreadcrumbs(page.Path)
+	page.TrashEntries = trashEntries
+	_ = tmpl.ExecuteTemplate(w, "base", page)
+}
+
 func User(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 
 	targetUsername := r.PathValue("username")
 
 	if !users.UserIsValid(targetUsername) {
-		slog.Warn("user is not valid", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor)
+		slog.Warn("user is not valid", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor)
 		getProblemPage(w, r, "The requested user is not valid.")
 		return
 	}
 
 	if requestor != targetUsername && !users.IsAdmin(requestor) {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, common.GetUrl("/"), http.StatusSeeOther)
 		return
 	}
 
 	err := filesystem.CreateRequiredFiles(targetUsername)
 	if err != nil {
-		slog.Error("failed to create required files", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to create required files", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "There was a problem creating the required files for this user.")
 		return
 	}
 
 	sshKeys, err := filesystem.GetUserSshKeys(targetUsername)
 	if err != nil {
-		slog.Error("failed to get ssh keys", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to get ssh keys", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "There was a problem getting the SSH Keys for this user.")
 		return
 	}
 
-	tmpl, err := template.ParseFS(
+	passkeys, err := auth.GetPasskeys(targetUsername)
+	if err != nil {
+		slog.Error("failed to get passkeys", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem getting the passkeys for this user.")
+		return
+	}
+
+	totpEnrolled, err := auth.TotpIsEnrolled(targetUsername)
+	if err != nil {
+		slog.Error("failed to check totp enrollment", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem checking two-factor authentication for this user.")
+		return
+	}
+
+	tmpl, err := template.New("").Funcs(getTemplateFuncs(r)).ParseFS(
 		templates,
 		"templates/pages/base.html",
 		"templates/pages/bodies/user.html",
 	)
 	if err != nil {
-		slog.Error("failed to generate html", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to generate html", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "There was a problem generating the HTML for the requested page.")
 		return
 	}
 
 	_ = tmpl.ExecuteTemplate(w, "base", struct {
-		PageTitle      string
-		Username       string
-		IsAdmin        bool
-		TargetUsername string
-		SshKeys        []string
+		PageTitle            string
+		Username             string
+		IsAdmin              bool
+		TargetUsername       string
+		SshKeys              []string
+		Passkeys             []auth.Passkey
+		TotpEnrolled         bool
+		TotpRequired         bool
+		PasswordRequirements []string
 	}{
-		PageTitle:      "Ground - User Manage",
-		Username:       requestor,
-		IsAdmin:        users.IsAdmin(requestor),
-		TargetUsername: targetUsername,
-		SshKeys:        sshKeys,
+		PageTitle:            "Ground - User Manage",
+		Username:             requestor,
+		IsAdmin:              users.IsAdmin(requestor),
+		TargetUsername:       targetUsername,
+		SshKeys:              sshKeys,
+		Passkeys:             passkeys,
+		TotpEnrolled:         totpEnrolled,
+		TotpRequired:         auth.AdminTotpRequired() && users.IsAdminGroupMember(targetUsername),
+		PasswordRequirements: auth.PasswordPolicyRequirements(),
 	})
 }
 
@@ -310,40 +677,114 @@ func Admin(w http.ResponseWriter, r *http.Request) {
 	requestor := common.GetRequestor(r)
 
 	if !users.IsAdmin(requestor) {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, common.GetUrl("/"), http.StatusSeeOther)
 		return
 	}
 
 	userListItems, err := users.GetUserListItems()
 	if err != nil {
-		slog.Error("failed to users", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to users", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "There was a problem getting the list of system users.")
 		return
 	}
 
-	tmpl, err := template.ParseFS(
+	spaces, err := filesystem.GetSpaces()
+	if err != nil {
+		slog.Error("failed to get spaces", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem getting the list of shared spaces.")
+		return
+	}
+
+	// a host without systemd still gets the rest of the page
+	serviceStatuses, err := services.GetUnitStatuses()
+	if err != nil {
+		slog.Error("failed to get service statuses", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		serviceStatuses = nil
+	}
+
+	serviceActions, err := audit.GetRecent(services.GetAuditActions(), serviceActionsShown)
+	if err != nil {
+		slog.Error("failed to get service actions", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		serviceActions = []audit.Entry{}
+	}
+
+	tmpl, err := template.New("").Funcs(getTemplateFuncs(r)).ParseFS(
 		templates,
 		"templates/pages/base.html",
 		"templates/pages/bodies/admin.html",
 	)
 	if err != nil {
-		slog.Error("failed to generate html", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to generate html", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		getProblemPage(w, r, "There was a problem generating the HTML for the requested page.")
 		return
 	}
 
 	_ = tmpl.ExecuteTemplate(w, "base", struct {
-		PageTitle     string
-		Username      string
-		IsAdmin       bool
-		Uptime        string
-		UserListItems []users.UserListItem
+		PageTitle            string
+		Username             string
+		IsAdmin              bool
+		Uptime               string
+		UserListItems        []users.UserListItem
+		Spaces               []filesystem.Space
+		HomeRootPath         string
+		TrashHomePath        string
+		AdminTotpRequired    bool
+		PasswordsAreSettable bool
+		PasswordRequirements []string
+		ServicesConfigured   bool
+		ServiceStatuses      []services.UnitStatus
+		ServiceActions       []audit.Entry
 	}{
-		PageTitle:     "Ground - Admin",
-		Username:      requestor,
-		IsAdmin:       users.IsAdmin(requestor),
-		Uptime:        monitor.GetUptime(),
-		UserListItems: userListItems,
+		PageTitle:            "Ground - Admin",
+		Username:             requestor,
+		IsAdmin:              users.IsAdmin(requestor),
+		Uptime:               monitor.GetUptime(),
+		UserListItems:        userListItems,
+		Spaces:               spaces,
+		HomeRootPath:         execute.GetHomeRootPath(),
+		TrashHomePath:        filesystem.TRASH_HOME_PATH,
+		AdminTotpRequired:    auth.AdminTotpRequired(),
+		PasswordsAreSettable: auth.PasswordsAreSettable(),
+		PasswordRequirements: auth.PasswordPolicyRequirements(),
+		ServicesConfigured:   len(services.GetUnits()) > 0,
+		ServiceStatuses:      serviceStatuses,
+		ServiceActions:       serviceActions,
+	})
+}
+
+func Logs(w http.ResponseWriter, r *http.Request) {
+	requestor := common.GetRequestor(r)
+
+	if !users.IsAdmin(requestor) {
+		http.Redirect(w, r, common.GetUrl("/"), http.StatusSeeOther)
+		return
+	}
+
+	tmpl, err := template.New("").Funcs(getTemplateFuncs(r)).ParseFS(
+		templates,
+		"templates/pages/base.html",
+		"templates/pages/bodies/logs.html",
+	)
+	if err != nil {
+		slog.Error("failed to generate html", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
+		getProblemPage(w, r, "There was a problem generating the HTML for the requested page.")
+		return
+	}
+
+	_ = tmpl.ExecuteTemplate(w, "base", struct {
+		PageTitle string
+		Username  string
+		IsAdmin   bool
+		User      string
+		Ip        string
+		Search    string
+	}{
+		PageTitle: "Ground - Server Logs",
+		Username:  requestor,
+		IsAdmin:   users.IsAdmin(requestor),
+		User:      r.URL.Query().Get("user"),
+		Ip:        r.URL.Query().Get("ip"),
+		Search:    r.URL.Query().Get("search"),
 	})
 }
 
@@ -351,16 +792,57 @@ func NotFound(w http.ResponseWriter, r *http.Request) {
 	getProblemPage(w, r, "The requested url path is not valid.")
 }
 
+// the csrf token is tied to the session of the request, so it is bound per page
+func getTemplateFuncs(r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": func() string {
+			return cookie.GetCsrfToken(r)
+		},
+		"features": common.GetFeatures,
+		"basePath": common.GetBasePath,
+	}
+}
+
+// the trash of a home or of a space, trash urls list directories and file urls serve files
+type trashPage struct {
+	PageTitle           string
+	Username            string
+	IsAdmin             bool
+	Path                string
+	RootPath            string
+	TrashUrl            string
+	FileUrl             string
+	TrashPath           string
+	Space               string
+	FilePathBreadcrumbs []filesystem.FilePathBreadcrumb
+	TrashEntries        []filesystem.TrashEntryData
+}
+
+func getFilesPage(w http.ResponseWriter, r *http.Request, page filesPage) {
+	tmpl, err := template.New("").Funcs(getTemplateFuncs(r)).ParseFS(
+		templates,
+		"templates/pages/base.html",
+		"templates/pages/bodies/files.html",
+	)
+	if err != nil {
+		slog.Error("failed to generate html", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", page.Username, "error", err)
+		getProblemPage(w, r, "There was a problem generating the HTML for the requested page.")
+		return
+	}
+
+	_ = tmpl.ExecuteTemplate(w, "base", page)
+}
+
 func getProblemPage(w http.ResponseWriter, r *http.Request, problemMessage string) {
 	requestor := common.GetRequestor(r)
 
-	tmpl, err := template.ParseFS(
+	tmpl, err := template.New("").Funcs(getTemplateFuncs(r)).ParseFS(
 		templates,
 		"templates/pages/base.html",
 		"templates/pages/bodies/problem.html",
 	)
 	if err != nil {
-		slog.Error("failed to generate html", "ip", r.RemoteAddr, "request", r.URL.Path, "requestor", requestor, "error", err)
+		slog.Error("failed to generate html", "ip", common.GetClientIp(r), "request", r.URL.Path, "requestor", requestor, "error", err)
 		http.Error(w, "Failed to generate HTML.", http.StatusInternalServerError)
 		return
 	}
@@ -1,28 +1,40 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"embed"
 	"errors"
-	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/grantfbarnes/ground/internal/server/api"
+	"github.com/grantfbarnes/ground/internal/server/certificate"
+	"github.com/grantfbarnes/ground/internal/server/common"
+	"github.com/grantfbarnes/ground/internal/server/logs"
+	"github.com/grantfbarnes/ground/internal/server/metrics"
 	"github.com/grantfbarnes/ground/internal/server/pages"
+	"github.com/grantfbarnes/ground/internal/system/auth"
+	"github.com/grantfbarnes/ground/internal/system/filesystem"
+	"github.com/grantfbarnes/ground/internal/system/monitor"
 )
 
 //go:embed static
 var static embed.FS
 
-func Run(port uint, certFile string, keyFile string) {
-	defer func() {
-		if err := recover(); err != nil {
-			slog.Error("panic occured", "error", err)
-		}
-	}()
+func Run(options Options) {
+	// prometheus metrics, only with a token since this listener is reachable by everyone
+	http.HandleFunc("GET /metrics", metrics.Handler)
+
+	// certificate authority, so browsers can be told to trust the generated certificate
+	http.HandleFunc("GET /ca.crt", serveCaCertificate)
 
 	// static files
 	http.HandleFunc("GET /static/{fileType}/{fileName}", func(w http.ResponseWriter, r *http.Request) {
@@ -30,13 +42,21 @@ func Run(port uint, certFile string, keyFile string) {
 	})
 
 	// apis
-	http.HandleFunc("POST /api/login", api.Login)
-	http.HandleFunc("POST /api/logout", api.Logout)
+	http.Handle("POST /api/login", api.OriginMiddleware(http.HandlerFunc(api.Login)))
+	http.Handle("POST /api/login/totp", api.OriginMiddleware(http.HandlerFunc(api.LoginTotp)))
+	http.Handle("POST /api/login/password", api.OriginMiddleware(http.HandlerFunc(api.LoginPasswordChange)))
+	http.Handle("POST /api/login/passkey/options", api.OriginMiddleware(http.HandlerFunc(api.BeginPasskeyLogin)))
+	http.Handle("POST /api/login/passkey", api.OriginMiddleware(http.HandlerFunc(api.LoginPasskey)))
+	http.Handle("POST /api/logout", api.OriginMiddleware(http.HandlerFunc(api.Logout)))
 
 	http.Handle("POST /api/upload/", api.Middleware(http.HandlerFunc(api.UploadFiles)))
 	http.Handle("GET /api/download/", api.Middleware(http.HandlerFunc(api.DownloadFile)))
 
+	http.Handle("GET /api/version/", api.Middleware(http.HandlerFunc(api.FileVersion)))
+	http.Handle("POST /api/version/restore", api.Middleware(http.HandlerFunc(api.RestoreVersion)))
+
 	http.Handle("GET /api/disk-usage/", api.Middleware(http.HandlerFunc(api.DiskUsage)))
+	http.Handle("GET /api/directory-tree/", api.Middleware(http.HandlerFunc(api.DirectoryTree)))
 
 	http.Handle("POST /api/directory", api.Middleware(http.HandlerFunc(api.CreateDirectory)))
 	http.Handle("POST /api/compress", api.Middleware(http.HandlerFunc(api.CompressDirectory)))
@@ -47,50 +67,255 @@ func Run(port uint, certFile string, keyFile string) {
 	http.Handle("POST /api/trash", api.Middleware(http.HandlerFunc(api.Trash)))
 	http.Handle("POST /api/restore", api.Middleware(http.HandlerFunc(api.Restore)))
 	http.Handle("DELETE /api/trash", api.Middleware(http.HandlerFunc(api.EmptyTrash)))
+	http.Handle("DELETE /api/trash/{trashDirName}", api.Middleware(http.HandlerFunc(api.DeleteTrash)))
 
 	http.Handle("POST /api/system/reboot", api.Middleware(http.HandlerFunc(api.SystemReboot)))
 	http.Handle("POST /api/system/poweroff", api.Middleware(http.HandlerFunc(api.SystemPoweroff)))
+	http.Handle("GET /api/system/stats", api.Middleware(http.HandlerFunc(api.SystemStats)))
+	http.Handle("POST /api/system/service", api.Middleware(http.HandlerFunc(api.ServiceAction)))
+	http.Handle("GET /api/system/service/journal", api.Middleware(http.HandlerFunc(api.ServiceJournal)))
+	http.Handle("GET /api/logs", api.Middleware(http.HandlerFunc(api.Logs)))
+	http.Handle("GET /api/logs/stream", api.Middleware(http.HandlerFunc(api.LogStream)))
+	http.Handle("POST /api/system/require-admin-totp", api.Middleware(http.HandlerFunc(api.SetAdminTotpRequired)))
 
 	http.Handle("POST /api/user", api.Middleware(http.HandlerFunc(api.CreateUser)))
 	http.Handle("DELETE /api/user", api.Middleware(http.HandlerFunc(api.DeleteUser)))
 
 	http.Handle("POST /api/user/toggle-admin", api.Middleware(http.HandlerFunc(api.ToggleAdmin)))
 	http.Handle("POST /api/user/impersonate", api.Middleware(http.HandlerFunc(api.Impersonate)))
+	http.Handle("POST /api/user/unlock", api.Middleware(http.HandlerFunc(api.UnlockUser)))
 
 	http.Handle("POST /api/user/password/reset", api.Middleware(http.HandlerFunc(api.ResetUserPassword)))
 	http.Handle("POST /api/user/password/change", api.Middleware(http.HandlerFunc(api.ChangeUserPassword)))
 
+	http.Handle("POST /api/space", api.Middleware(http.HandlerFunc(api.CreateSpace)))
+	http.Handle("DELETE /api/space", api.Middleware(http.HandlerFunc(api.DeleteSpace)))
+	http.Handle("POST /api/space/access", api.Middleware(http.HandlerFunc(api.SetSpaceAccess)))
+	http.Handle("POST /api/space/member", api.Middleware(http.HandlerFunc(api.AddSpaceMember)))
+	http.Handle("DELETE /api/space/member", api.Middleware(http.HandlerFunc(api.RemoveSpaceMember)))
+
+	http.Handle("POST /api/share", api.Middleware(http.HandlerFunc(api.CreateShare)))
+	http.Handle("DELETE /api/share", api.Middleware(http.HandlerFunc(api.DeleteShare)))
+
 	http.Handle("POST /api/user/ssh-key", api.Middleware(http.HandlerFunc(api.AddUserSshKey)))
 	http.Handle("DELETE /api/user/ssh-key", api.Middleware(http.HandlerFunc(api.DeleteUserSshKey)))
 
+	http.Handle("POST /api/user/totp/setup", api.Middleware(http.HandlerFunc(api.SetupUserTotp)))
+	http.Handle("POST /api/user/totp", api.Middleware(http.HandlerFunc(api.EnrollUserTotp)))
+	http.Handle("DELETE /api/user/totp", api.Middleware(http.HandlerFunc(api.DisableUserTotp)))
+
+	http.Handle("POST /api/user/passkey/options", api.Middleware(http.HandlerFunc(api.BeginPasskeyRegistration)))
+	http.Handle("POST /api/user/passkey", api.Middleware(http.HandlerFunc(api.RegisterPasskey)))
+	http.Handle("DELETE /api/user/passkey", api.Middleware(http.HandlerFunc(api.DeletePasskey)))
+
 	// pages
 	http.Handle("GET /{$}", pages.Middleware(http.HandlerFunc(pages.Home)))
 	http.Handle("GET /login", pages.Middleware(http.HandlerFunc(pages.Login)))
 	http.Handle("GET /files/", pages.Middleware(http.HandlerFunc(pages.Files)))
 	http.Handle("GET /file/", pages.Middleware(http.HandlerFunc(pages.File)))
+	http.Handle("GET /versions/", pages.Middleware(http.HandlerFunc(pages.Versions)))
+	http.Handle("GET /shared/{$}", pages.Middleware(http.HandlerFunc(pages.Spaces)))
+	http.Handle("GET /shared/{space}", pages.Middleware(http.HandlerFunc(pages.Space)))
+	http.Handle("GET /shared/{space}/{path...}", pages.Middleware(http.HandlerFunc(pages.Space)))
+	http.Handle("GET /share/{owner}/{id}", pages.Middleware(http.HandlerFunc(pages.Share)))
+	http.Handle("GET /share/{owner}/{id}/{path...}", pages.Middleware(http.HandlerFunc(pages.Share)))
 	http.Handle("GET /trash/", pages.Middleware(http.HandlerFunc(pages.Trash)))
+	http.Handle("GET /shared-trash/{space}", pages.Middleware(http.HandlerFunc(pages.SpaceTrash)))
+	http.Handle("GET /shared-trash/{space}/{path...}", pages.Middleware(http.HandlerFunc(pages.SpaceTrash)))
 	http.Handle("GET /user/{username}", pages.Middleware(http.HandlerFunc(pages.User)))
 	http.Handle("GET /admin", pages.Middleware(http.HandlerFunc(pages.Admin)))
+	http.Handle("GET /admin/logs", pages.Middleware(http.HandlerFunc(pages.Logs)))
 	http.Handle("GET /", pages.Middleware(http.HandlerFunc(pages.NotFound)))
 
-	ip, err := getLocalIPv4()
+	go runJanitor()
+	go monitor.RunSampler()
+
+	listeners, err := getListeners(options.Address, options.Port, options.SocketGroup)
 	if err != nil {
-		slog.Error("failed to get local ip", "error", err)
+		slog.Error("failed to listen", "error", err)
 		os.Exit(1)
 	}
 
-	addr := fmt.Sprintf(":%d", port)
-	if certFile != "" && keyFile != "" {
-		slog.Info("starting server", "url", fmt.Sprintf("https://%s%s", ip, addr))
-		err = http.ListenAndServeTLS(addr, certFile, keyFile, nil)
-	} else {
-		slog.Info("starting server", "url", fmt.Sprintf("http://%s%s", ip, addr))
-		err = http.ListenAndServe(addr, nil)
+	redirectListeners := []net.Listener{}
+	if certificate.TlsIsEnabled() && options.RedirectPort != 0 {
+		redirectListeners, err = getRedirectListeners(options.Address, options.RedirectPort)
+		if err != nil {
+			slog.Error("failed to listen for https redirect", "error", err)
+			os.Exit(1)
+		}
 	}
-	if err != nil {
+
+	metricsListeners := []net.Listener{}
+	if options.MetricsAddress != "" {
+		metricsListeners, err = getMetricsListeners(options.MetricsAddress, options.SocketGroup)
+		if err != nil {
+			slog.Error("failed to listen for metrics", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	metricsMux := http.NewServeMux()
+	metricsMux.HandleFunc("GET /metrics", metrics.ListenerHandler)
+
+	server := newHttpServer(options, recoverPanics(securityHeaders(mountAtBasePath(metrics.Middleware(http.DefaultServeMux)))))
+	redirectServer := newHttpServer(options, recoverPanics(httpsRedirect(options.Port)))
+	metricsServer := newHttpServer(options, recoverPanics(metricsMux))
+	server.RegisterOnShutdown(logs.StopStreams)
+	if certificate.TlsIsEnabled() {
+		server.TLSConfig = &tls.Config{GetCertificate: certificate.GetCertificate}
+	}
+
+	serveErrors := make(chan error, len(listeners)+len(redirectListeners)+len(metricsListeners))
+	for _, listener := range listeners {
+		go func() {
+			if certificate.TlsIsEnabled() {
+				slog.Info("starting server", "url", getListenerUrl(listener, "https"))
+				serveErrors <- server.ServeTLS(listener, "", "")
+			} else {
+				slog.Info("starting server", "url", getListenerUrl(listener, "http"))
+				serveErrors <- server.Serve(listener)
+			}
+		}()
+	}
+	for _, listener := range redirectListeners {
+		go func() {
+			slog.Info("starting https redirect", "url", getListenerUrl(listener, "http"))
+			serveErrors <- redirectServer.Serve(listener)
+		}()
+	}
+	for _, listener := range metricsListeners {
+		go func() {
+			slog.Info("starting metrics", "url", getListenerUrl(listener, "http")+"/metrics")
+			serveErrors <- metricsServer.Serve(listener)
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err = <-serveErrors:
 		slog.Error("failed to run server", "error", err)
 		os.Exit(1)
+	case sig := <-stop:
+		slog.Info("shutting down, waiting for requests to finish", "signal", sig.String(), "timeout", options.ShutdownTimeout)
+	}
+
+	// uploads in progress get until the timeout to finish, anything still running after that is cut off
+	ctx, cancel := context.WithTimeout(context.Background(), options.ShutdownTimeout)
+	defer cancel()
+
+	for _, httpServer := range []*http.Server{server, redirectServer, metricsServer} {
+		err = httpServer.Shutdown(ctx)
+		if err != nil {
+			slog.Warn("requests did not finish before shutdown timeout", "error", err)
+			httpServer.Close()
+		}
+	}
+
+	err = auth.FlushLoginFailures()
+	if err != nil {
+		slog.Error("failed to save login failures", "error", err)
 	}
+
+	slog.Info("server stopped")
+}
+
+func newHttpServer(options Options, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: options.ReadHeaderTimeout,
+		ReadTimeout:       options.ReadTimeout,
+		WriteTimeout:      options.WriteTimeout,
+		IdleTimeout:       options.IdleTimeout,
+		MaxHeaderBytes:    int(options.MaxHeaderSize) * 1000,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// sends plain http requests to the https port, except for the certificate authority which is needed before https can be trusted
+func httpsRedirect(httpsPort uint) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/ca.crt" {
+			serveCaCertificate(w, r)
+			return
+		}
+
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.FormatUint(uint64(httpsPort), 10))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// routes are written as if mounted at the root, so the base path is removed before they are matched
+func mountAtBasePath(next http.Handler) http.Handler {
+	basePath := common.GetBasePath()
+	if basePath == "" {
+		return next
+	}
+
+	stripped := http.StripPrefix(basePath, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == basePath {
+			http.Redirect(w, r, basePath+"/", http.StatusMovedPermanently)
+			return
+		}
+
+		if !strings.HasPrefix(r.URL.Path, basePath+"/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		stripped.ServeHTTP(w, r)
+	})
+}
+
+// a panicking handler fails only its own request instead of the connection with no explanation
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+
+			// net/http uses this panic on purpose to abort a response
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			slog.Error("panic occured", "ip", common.GetClientIp(r), "request", r.URL.Path, "error", err, "stack", string(debug.Stack()))
+			http.Error(w, "Internal server error.", http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func serveCaCertificate(w http.ResponseWriter, r *http.Request) {
+	if !certificate.CaIsAvailable() {
+		http.NotFound(w, r)
+		return
+	}
+
+	content, err := certificate.GetCaCertificate()
+	if err != nil {
+		slog.Error("failed to read ca certificate", "ip", common.GetClientIp(r), "request", r.URL.Path, "error", err)
+		http.Error(w, "Failed to read certificate.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+	filesystem.SetAttachmentHeader(w, "ground-ca.crt")
+	_, _ = w.Write(content)
 }
 
 func getLocalIPv4() (net.IP, error) {
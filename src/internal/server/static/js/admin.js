@@ -1,26 +1,212 @@
+const pageData = document.getElementById("page-data").dataset;
+const homeRootPath = pageData.homeRootPath;
+const trashHomePath = pageData.trashHomePath;
+
 document.addEventListener("DOMContentLoaded", () => {
     const diskUsageElement = document.getElementById("disk-usage");
     if (!diskUsageElement) return;
 
-    getDirectoryDiskUsage("/home").then((diskUsage) => {
+    getDirectoryDiskUsage(homeRootPath).then((diskUsage) => {
         diskUsageElement.innerText = `Disk Usage: ${diskUsage}`;
     });
 
     for (const userDiskUsageElement of document.getElementsByClassName("user-disk-usage")) {
         const username = userDiskUsageElement.dataset.username;
         if (!username) continue;
-        getDirectoryDiskUsage(`/home/${username}`).then((diskUsage) => {
+        getDirectoryDiskUsage(`${homeRootPath}/${username}`).then((diskUsage) => {
             userDiskUsageElement.innerText = diskUsage;
         });
     }
+
+    for (const userTrashSizeElement of document.getElementsByClassName("user-trash-size")) {
+        const username = userTrashSizeElement.dataset.username;
+        if (!username) continue;
+        getDirectoryDiskUsage(`${homeRootPath}/${username}/${trashHomePath}`).then((diskUsage) => {
+            userTrashSizeElement.innerText = diskUsage.split("/")[0];
+        });
+    }
+
+    refreshSystemStats();
+    setInterval(refreshSystemStats, statsRefreshInterval);
 });
 
+for (const systemCallElement of document.getElementsByClassName("system-call")) {
+    systemCallElement.onclick = () => systemCall(systemCallElement.dataset.method);
+}
+
+for (const serviceActionElement of document.getElementsByClassName("service-action")) {
+    const dataset = serviceActionElement.dataset;
+    serviceActionElement.onclick = () => serviceAction(dataset.unit, dataset.action, dataset.isGround == "true");
+}
+
+for (const serviceJournalElement of document.getElementsByClassName("service-journal")) {
+    serviceJournalElement.onclick = () => showServiceJournal(serviceJournalElement.dataset.unit);
+}
+
+if (document.getElementById("service-journal-dialog")) {
+    document.getElementById("service-journal-lines").onchange = () => loadServiceJournal();
+    document.getElementById("service-journal-refresh").onclick = () => loadServiceJournal();
+}
+
+document.getElementById("admin-totp-required").onchange = (event) => setAdminTotpRequired(event.target);
+
+for (const toggleAdminElement of document.getElementsByClassName("toggle-admin")) {
+    toggleAdminElement.onchange = () => toggleAdmin(toggleAdminElement, toggleAdminElement.dataset.username);
+}
+
+for (const unlockUserElement of document.getElementsByClassName("unlock-user")) {
+    unlockUserElement.onclick = () => unlockUser(unlockUserElement.dataset.username);
+}
+
+for (const impersonateUserElement of document.getElementsByClassName("impersonate-user")) {
+    impersonateUserElement.onclick = () => impersonateUser(impersonateUserElement.dataset.username);
+}
+
+for (const spaceAccessElement of document.getElementsByClassName("space-access")) {
+    spaceAccessElement.onchange = () => setSpaceAccess(spaceAccessElement, spaceAccessElement.dataset.space);
+}
+
+for (const addSpaceMemberElement of document.getElementsByClassName("add-space-member")) {
+    addSpaceMemberElement.onchange = () => addSpaceMember(addSpaceMemberElement, addSpaceMemberElement.dataset.space);
+}
+
+for (const removeSpaceMemberElement of document.getElementsByClassName("remove-space-member")) {
+    const dataset = removeSpaceMemberElement.dataset;
+    removeSpaceMemberElement.onclick = () => removeSpaceMember(dataset.space, dataset.username);
+}
+
+for (const deleteSpaceElement of document.getElementsByClassName("delete-space")) {
+    deleteSpaceElement.onclick = () => deleteSpace(deleteSpaceElement.dataset.space);
+}
+
+const statsRefreshInterval = 10000;
+const chartDuration = 60 * 60 * 1000;
+
+function refreshSystemStats() {
+    fetch(getUrl("/api/system/stats")).then((response) => {
+        if (!response.ok) return null;
+        return response.json();
+    }).then((stats) => {
+        if (!stats) return;
+        showSystemStats(stats);
+    });
+}
+
+function showSystemStats(stats) {
+    const samples = stats.samples;
+    const latest = samples[samples.length - 1];
+
+    drawChart("chart-cpu", samples, ["cpuPercent"], 100, (value) => `${value.toFixed(0)}%`);
+
+    const memoryTotal = latest ? latest.memoryTotalBytes : 1;
+    drawChart("chart-memory", samples, ["memoryUsedBytes", "swapUsedBytes"], memoryTotal, formatBytes);
+
+    // load is relative to the number of cores, so the scale grows with the highest value seen
+    const loadMax = Math.max(1, ...samples.map((sample) => Math.ceil(sample.load1)));
+    drawChart("chart-load", samples, ["load1", "load5", "load15"], loadMax, (value) => value.toFixed(2));
+
+    const networkMax = Math.max(1024, ...samples.map((sample) => Math.max(sample.networkReceiveRate, sample.networkTransmitRate)));
+    drawChart("chart-network", samples, ["networkReceiveRate", "networkTransmitRate"], networkMax, (value) => `${formatBytes(value)}/s`);
+
+    if (latest) {
+        document.getElementById("chart-cpu-value").innerText = `${latest.cpuPercent.toFixed(1)}%`;
+        let memoryText = `${formatBytes(latest.memoryUsedBytes)}/${formatBytes(latest.memoryTotalBytes)}`;
+        if (latest.swapTotalBytes > 0) {
+            memoryText += ` (swap ${formatBytes(latest.swapUsedBytes)}/${formatBytes(latest.swapTotalBytes)})`;
+        }
+        document.getElementById("chart-memory-value").innerText = memoryText;
+        document.getElementById("chart-load-value").innerText = `${latest.load1.toFixed(2)} ${latest.load5.toFixed(2)} ${latest.load15.toFixed(2)}`;
+        document.getElementById("chart-network-value").innerText = `${formatBytes(latest.networkReceiveRate)}/s down, ${formatBytes(latest.networkTransmitRate)}/s up`;
+    } else {
+        for (const name of ["cpu", "memory", "load", "network"]) {
+            document.getElementById(`chart-${name}-value`).innerText = "collecting...";
+        }
+    }
+
+    const filesystemsElement = document.getElementById("filesystems");
+    filesystemsElement.replaceChildren();
+    for (const filesystem of stats.filesystems) {
+        const row = document.createElement("tr");
+        const percent = filesystem.sizeBytes > 0 ? Math.round(filesystem.usedBytes / filesystem.sizeBytes * 100) : 0;
+        for (const text of [filesystem.mountPoint, filesystem.device, filesystem.type, formatBytes(filesystem.usedBytes), formatBytes(filesystem.sizeBytes), `${percent}%`]) {
+            const cell = document.createElement("td");
+            cell.innerText = text;
+            row.appendChild(cell);
+        }
+        filesystemsElement.appendChild(row);
+    }
+}
+
+// one line per key, scaled so maxValue is the top of the chart, the first key is drawn most prominently
+function drawChart(canvasId, samples, keys, maxValue, formatValue) {
+    const canvas = document.getElementById(canvasId);
+    const width = canvas.clientWidth;
+    const height = canvas.clientHeight;
+
+    // the drawing buffer follows the displayed size, so lines stay sharp on high density screens
+    const ratio = window.devicePixelRatio || 1;
+    canvas.width = width * ratio;
+    canvas.height = height * ratio;
+    const context = canvas.getContext("2d");
+    context.scale(ratio, ratio);
+
+    const styles = getComputedStyle(document.documentElement);
+    const colors = ["--color-blue1", "--color-orange1", "--color-purple1"].map((name) => styles.getPropertyValue(name));
+
+    context.fillStyle = styles.getPropertyValue("--color-bg1");
+    context.fillRect(0, 0, width, height);
+
+    context.strokeStyle = styles.getPropertyValue("--color-bg3");
+    context.lineWidth = 1;
+    for (let i = 1; i < 4; i++) {
+        const y = Math.round(height * i / 4) + 0.5;
+        context.beginPath();
+        context.moveTo(0, y);
+        context.lineTo(width, y);
+        context.stroke();
+    }
+
+    const end = Date.now();
+    const start = end - chartDuration;
+    keys.forEach((key, index) => {
+        context.strokeStyle = colors[index % colors.length];
+        context.lineWidth = index == 0 ? 2 : 1;
+        context.beginPath();
+        samples.forEach((sample, sampleIndex) => {
+            const x = (sample.time - start) / chartDuration * width;
+            const y = height - Math.min(sample[key] / maxValue, 1) * (height - 2) - 1;
+            if (sampleIndex == 0) {
+                context.moveTo(x, y);
+            } else {
+                context.lineTo(x, y);
+            }
+        });
+        context.stroke();
+    });
+
+    context.fillStyle = styles.getPropertyValue("--color-fg3");
+    context.font = "11px sans-serif";
+    context.textBaseline = "top";
+    context.fillText(formatValue(maxValue), 4, 4);
+}
+
+function formatBytes(bytes) {
+    const units = ["B", "K", "M", "G", "T", "P"];
+    let value = bytes;
+    let unitIndex = 0;
+    while (value >= 1024 && unitIndex < units.length - 1) {
+        value /= 1024;
+        unitIndex++;
+    }
+    return `${unitIndex == 0 ? value.toFixed(0) : value.toFixed(1)}${units[unitIndex]}`;
+}
+
 function systemCall(callMethod) {
     customConfirm(`Are you sure you want to ${callMethod} the system?`).then(confirmed => {
         if (confirmed) {
             toggleLoading();
             const reloadTimeout = setTimeout(() => location.reload(), 5000);
-            fetch(`/api/system/${callMethod}`, { method: "POST" }).then((response) => {
+            fetch(getUrl(`/api/system/${callMethod}`), { method: "POST" }).then((response) => {
                 if (response.ok) {
                     // success, wait for timeout reload
                 } else {
@@ -33,6 +219,73 @@ function systemCall(callMethod) {
     });
 }
 
+function serviceAction(unit, action, isGround) {
+    let message = `Are you sure you want to ${action} '${unit}'?`;
+    if (isGround) {
+        message += " This is the service running this page, it will be unavailable until it is back up.";
+    }
+    customConfirm(message).then(confirmed => {
+        if (confirmed) {
+            toggleLoading();
+            const formData = new FormData();
+            formData.append("unit", unit);
+            formData.append("action", action);
+            fetch(getUrl("/api/system/service"), { method: "POST", body: formData }).then((response) => {
+                if (response.ok) {
+                    // ground only queues its own restart, so give it time to come back
+                    setTimeout(() => location.reload(), isGround ? 5000 : 0);
+                } else {
+                    response.text().then((text) => notifyError(text));
+                    toggleLoading();
+                }
+            });
+        }
+    });
+}
+
+function showServiceJournal(unit) {
+    document.getElementById("service-journal-unit").innerText = unit;
+    document.getElementById("service-journal").innerText = "";
+    document.getElementById("service-journal-dialog").showModal();
+    loadServiceJournal();
+}
+
+function loadServiceJournal() {
+    const unit = document.getElementById("service-journal-unit").innerText;
+    const lines = document.getElementById("service-journal-lines").value;
+    const journalElement = document.getElementById("service-journal");
+    const params = new URLSearchParams({ unit: unit, lines: lines });
+    fetch(getUrl(`/api/system/service/journal?${params}`)).then((response) => {
+        response.text().then((text) => {
+            if (!response.ok) {
+                notifyError(text);
+                return;
+            }
+            journalElement.innerText = text || "No log lines found.";
+            journalElement.scrollTop = journalElement.scrollHeight;
+        });
+    });
+}
+
+function setAdminTotpRequired(selectElement) {
+    customConfirm("Are you sure you want to change the two-factor authentication requirement for admins?").then(confirmed => {
+        if (confirmed) {
+            toggleLoading();
+            const formData = new FormData();
+            formData.append("required", selectElement.value);
+            fetch(getUrl("/api/system/require-admin-totp"), { method: "POST", body: formData }).then((response) => {
+                if (!response.ok) {
+                    selectElement.value = selectElement.value == "true" ? "false" : "true";
+                    response.text().then((text) => notifyError(text));
+                }
+                toggleLoading();
+            });
+        } else {
+            selectElement.value = selectElement.value == "true" ? "false" : "true";
+        }
+    });
+}
+
 document.getElementById("create-user-form").addEventListener("submit", function (event) {
     event.preventDefault();
     const formData = new FormData(this);
@@ -41,9 +294,21 @@ document.getElementById("create-user-form").addEventListener("submit", function
         if (confirmed) {
             document.getElementById("create-user-dialog").close();
             toggleLoading();
-            fetch("/api/user", { method: "POST", body: formData }).then((response) => {
+            fetch(getUrl("/api/user"), { method: "POST", body: formData }).then((response) => {
                 if (response.ok) {
-                    location.href = `/user/${username}`;
+                    response.text().then((password) => {
+                        toggleLoading();
+                        // an initial password chosen by the admin is already known
+                        if (password && !formData.get("password")) {
+                            return customAlert(`Temporary password for '${username}', it will not be shown again:\n\n${password}`);
+                        }
+                    }).then(() => {
+                        location.href = getUrl(`/user/${username}`);
+                    });
+                } else if (response.status == 422) {
+                    document.getElementById("create-user-dialog").showModal();
+                    showPasswordViolations(this, response);
+                    toggleLoading();
                 } else {
                     response.text().then((text) => notifyError(text));
                     toggleLoading();
@@ -59,7 +324,7 @@ function toggleAdmin(selectElement, username) {
             toggleLoading();
             const formData = new FormData();
             formData.append("username", username);
-            fetch("/api/user/toggle-admin", { method: "POST", body: formData }).then((response) => {
+            fetch(getUrl("/api/user/toggle-admin"), { method: "POST", body: formData }).then((response) => {
                 if (!response.ok) {
                     response.text().then((text) => notifyError(text));
                 }
@@ -71,13 +336,122 @@ function toggleAdmin(selectElement, username) {
     });
 }
 
+function unlockUser(username) {
+    customConfirm(`Are you sure you want to unlock '${username}' after too many failed logins?`).then(confirmed => {
+        if (confirmed) {
+            toggleLoading();
+            const formData = new FormData();
+            formData.append("username", username);
+            fetch(getUrl("/api/user/unlock"), { method: "POST", body: formData }).then((response) => {
+                if (response.ok) {
+                    location.reload();
+                } else {
+                    response.text().then((text) => notifyError(text));
+                    toggleLoading();
+                }
+            });
+        }
+    });
+}
+
 function impersonateUser(username) {
     customConfirm(`Are you sure you want to impersonate user '${username}'?`).then(confirmed => {
         if (confirmed) {
             toggleLoading();
             const formData = new FormData();
             formData.append("username", username);
-            fetch("/api/user/impersonate", { method: "POST", body: formData }).then((response) => {
+            fetch(getUrl("/api/user/impersonate"), { method: "POST", body: formData }).then((response) => {
+                if (response.ok) {
+                    location.reload();
+                } else {
+                    response.text().then((text) => notifyError(text));
+                    toggleLoading();
+                }
+            });
+        }
+    });
+}
+
+document.getElementById("create-space-form").addEventListener("submit", function (event) {
+    event.preventDefault();
+    const formData = new FormData(this);
+    const name = formData.get("name");
+    customConfirm(`Are you sure you want to create shared space '${name}'?`).then(confirmed => {
+        if (confirmed) {
+            document.getElementById("create-space-dialog").close();
+            toggleLoading();
+            fetch(getUrl("/api/space"), { method: "POST", body: formData }).then((response) => {
+                if (response.ok) {
+                    location.reload();
+                } else {
+                    response.text().then((text) => notifyError(text));
+                    toggleLoading();
+                }
+            });
+        }
+    });
+});
+
+function setSpaceAccess(selectElement, name) {
+    customConfirm(`Are you sure you want to change the access for shared space '${name}'?`).then(confirmed => {
+        if (confirmed) {
+            toggleLoading();
+            const formData = new FormData();
+            formData.append("name", name);
+            formData.append("writable", selectElement.value);
+            fetch(getUrl("/api/space/access"), { method: "POST", body: formData }).then((response) => {
+                if (!response.ok) {
+                    response.text().then((text) => notifyError(text));
+                }
+                toggleLoading();
+            });
+        } else {
+            selectElement.value = selectElement.value == "true" ? "false" : "true";
+        }
+    });
+}
+
+function addSpaceMember(selectElement, name) {
+    const username = selectElement.value;
+    selectElement.value = "";
+    if (!username) return;
+    customConfirm(`Are you sure you want to add '${username}' to shared space '${name}'?`).then(confirmed => {
+        if (confirmed) {
+            callSpaceMemberApi("POST", name, username);
+        }
+    });
+}
+
+function removeSpaceMember(name, username) {
+    customConfirm(`Are you sure you want to remove '${username}' from shared space '${name}'?`).then(confirmed => {
+        if (confirmed) {
+            callSpaceMemberApi("DELETE", name, username);
+        }
+    });
+}
+
+function callSpaceMemberApi(method, name, username) {
+    toggleLoading();
+    const formData = new FormData();
+    formData.append("name", name);
+    formData.append("username", username);
+    fetch(getUrl("/api/space/member"), { method: method, body: formData }).then((response) => {
+        if (response.ok) {
+            location.reload();
+        } else {
+            response.text().then((text) => notifyError(text));
+            toggleLoading();
+        }
+    });
+}
+
+function deleteSpace(name) {
+    customConfirm(`Are you sure you want to delete shared space '${name}'?\nOnly empty spaces can be deleted.`).then(confirmed => {
+        if (confirmed) {
+            toggleLoading();
+            const formData = new FormData();
+            formData.append("name", name);
+            fetch(getUrl("/api/space"), { method: "DELETE", body: formData }).then((response) => {
                 if (response.ok) {
                     location.reload();
                 } else {
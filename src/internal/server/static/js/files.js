@@ -1,3 +1,13 @@
+const pageData = document.getElementById("page-data").dataset;
+const pagePath = pageData.path;
+const pageRootPath = pageData.rootPath;
+const pageRootName = pageData.rootName;
+const pageSpace = pageData.space;
+const pageShare = pageData.share;
+const pageIsHome = pageData.isHome == "true";
+const pageCanWrite = pageData.canWrite == "true";
+const sharesEnabled = pageData.sharesEnabled == "true";
+
 document.addEventListener("DOMContentLoaded", () => {
     getDiskUsages();
     setSearchFilterValue();
@@ -8,7 +18,7 @@ function getDiskUsages() {
     const diskUsageElement = document.getElementById("disk-usage");
     if (!diskUsageElement) return;
 
-    getDirectoryDiskUsage(pageRootPath).then((diskUsage) => {
+    getDirectoryDiskUsage(pageRootPath, getRootParams()).then((diskUsage) => {
         diskUsageElement.innerText = `Disk Usage: ${diskUsage}`;
     });
 }
@@ -48,11 +58,38 @@ const hoverClassName = "highlighted-normal";
 const selectedActionCompressElement = document.getElementById("selected-action-compress");
 const selectedActionExtractElement = document.getElementById("selected-action-extract");
 const selectedActionDownloadElement = document.getElementById("selected-action-download");
+const selectedActionVersionsElement = document.getElementById("selected-action-versions");
 const selectedActionRenameElement = document.getElementById("selected-action-rename");
+const selectedActionMoveElement = document.getElementById("selected-action-move");
+const selectedActionShareElement = document.getElementById("selected-action-share");
 const selectedActionTrashElement = document.getElementById("selected-action-trash");
 const tableContainerElement = document.getElementById("directory-entries-table-container");
 let selectedRow = null;
 
+for (const rowElement of document.getElementsByClassName("directory-entry")) {
+    rowElement.onclick = () => selectRow(rowElement);
+    rowElement.ondblclick = () => window.location.href = rowElement.dataset.url;
+    rowElement.ondragstart = () => selectRow(rowElement);
+    if (rowElement.dataset.isDir == "true") {
+        rowElement.ondragover = handleDirRowDragOver;
+        rowElement.ondragleave = handleDirRowDragLeave;
+        rowElement.ondrop = handleDirRowDrop;
+    }
+}
+
+for (const breadcrumbElement of document.getElementsByClassName("breadcrumb-drop-target")) {
+    breadcrumbElement.ondragover = handleBreadcrumbDragOver;
+    breadcrumbElement.ondragleave = handleBreadcrumbDragLeave;
+    breadcrumbElement.ondrop = handleBreadcrumbDrop;
+}
+
+tableContainerElement.ondragover = handleTableContainerDragOver;
+tableContainerElement.ondragleave = handleTableContainerDragLeave;
+tableContainerElement.ondrop = handleTableContainerDrop;
+
+document.getElementById("dotfiles-reveal-button").onclick = showDotfiles;
+document.getElementById("dotfiles-conceal-button").onclick = hideDotfiles;
+
 function selectRow(element) {
     if (selectedRow) {
         selectedRow.classList.remove(selectedClassName);
@@ -60,15 +97,21 @@ function selectRow(element) {
     selectedRow = element;
     selectedRow.classList.add(selectedClassName);
 
-    selectedActionCompressElement.hidden = selectedRow.dataset.isDir != "true";
+    selectedActionCompressElement.hidden = !pageCanWrite || selectedRow.dataset.isDir != "true";
     selectedActionCompressElement.onclick = () => compressDirectory(selectedRow.dataset.name, selectedRow.dataset.path);
-    selectedActionExtractElement.hidden = selectedRow.dataset.isCompressed != "true";
+    selectedActionExtractElement.hidden = !pageCanWrite || selectedRow.dataset.isCompressed != "true";
     selectedActionExtractElement.onclick = () => extractFile(selectedRow.dataset.name, selectedRow.dataset.path);
     selectedActionDownloadElement.hidden = selectedRow.dataset.isDir != "false";
     selectedActionDownloadElement.onclick = () => downloadFile(selectedRow.dataset.path);
-    selectedActionRenameElement.disabled = false;
+    selectedActionVersionsElement.hidden = !pageIsHome || selectedRow.dataset.isDir != "false";
+    selectedActionVersionsElement.onclick = () => window.location.href = getUrl("/versions" + selectedRow.dataset.path);
+    selectedActionRenameElement.disabled = !pageCanWrite;
     document.getElementById("rename-file-field-old-name").value = selectedRow.dataset.name;
-    selectedActionTrashElement.disabled = false;
+    selectedActionMoveElement.disabled = !pageCanWrite;
+    selectedActionMoveElement.onclick = () => openMoveToDialog(selectedRow.dataset.name, selectedRow.dataset.path);
+    selectedActionShareElement.hidden = !sharesEnabled || !pageIsHome || selectedRow.dataset.isDir != "true";
+    selectedActionShareElement.onclick = () => openShareDialog(selectedRow.dataset.name, selectedRow.dataset.path);
+    selectedActionTrashElement.disabled = !pageCanWrite;
     selectedActionTrashElement.onclick = () => moveToTrash(selectedRow.dataset.name, selectedRow.dataset.path);
 }
 
@@ -235,16 +278,25 @@ function upload(relHomePath, files) {
 
     toggleLoading();
 
+    const overwriteElement = document.getElementById("upload-overwrite");
+    const overwrite = overwriteElement && overwriteElement.checked;
+
     let uploadCount = 0;
     let failedFiles = [];
     const uploadPromises = files.map(file => {
         const formData = new FormData();
         formData.append("file", file);
-        return fetch(`/api/upload${relHomePath}`, { method: "POST", body: formData })
+        const url = new URL(getRootUrl("/api/upload" + relHomePath));
+        if (overwrite) {
+            url.searchParams.set("overwrite", "true");
+        }
+        return fetch(url.toString(), { method: "POST", body: formData })
             .then((response) => {
                 if (response.ok) {
                     uploadCount += 1;
                     notifyInfo(`Uploaded ${uploadCount} out of ${files.length} files...`);
+                } else if (response.status === 413) {
+                    failedFiles.push(`${file.webkitRelativePath ?? file.name} (too large)`);
                 } else {
                     failedFiles.push(file.webkitRelativePath ?? file.name);
                 }
@@ -271,7 +323,7 @@ document.getElementById("create-directory-form").addEventListener("submit", func
         if (confirmed) {
             document.getElementById("create-directory-dialog").close();
             toggleLoading();
-            fetch("/api/directory", { method: "POST", body: formData }).then((response) => {
+            fetch(getRootUrl("/api/directory"), { method: "POST", body: formData }).then((response) => {
                 if (response.ok) {
                     location.reload();
                 } else {
@@ -322,41 +374,221 @@ document.getElementById("rename-file-form").addEventListener("submit", function
         if (confirmed) {
             document.getElementById("rename-file-dialog").close();
             toggleLoading();
-            fetch("/api/rename", { method: "POST", body: formData }).then((response) => {
-                if (response.ok) {
-                    location.reload();
-                } else {
-                    response.text().then((text) => notifyError(text));
-                    toggleLoading();
-                }
-            });
+            callRenameApi(formData);
         }
     });
 });
 
+function callRenameApi(formData) {
+    fetch(getRootUrl("/api/rename"), { method: "POST", body: formData }).then((response) => {
+        if (response.ok) {
+            location.reload();
+        } else if (response.status == 409) {
+            response.json().then(async (data) => {
+                toggleLoading();
+                const resolutions = await resolveConflicts(data.conflicts);
+                if (!resolutions) return;
+                toggleLoading();
+                formData.set("conflictResolution", resolutions[0]);
+                callRenameApi(formData);
+            });
+        } else {
+            response.text().then((text) => notifyError(text));
+            toggleLoading();
+        }
+    });
+}
+
 function moveFiles(source, destination) {
     customConfirm(`Are you sure you want to move '${source}' to '${destination}'?`).then(confirmed => {
         if (confirmed) {
             toggleLoading();
-            const formData = new FormData();
-            formData.append("sourceRelHomePath", source);
-            formData.append("destinationRelHomePath", destination);
-            fetch("/api/move", { method: "POST", body: formData }).then((response) => {
-                if (response.ok) {
+            callMoveApi([source], [destination], null);
+        }
+    });
+}
+
+function callMoveApi(sources, destinations, resolutions) {
+    const formData = new FormData();
+    for (let i = 0; i < sources.length; i++) {
+        formData.append("sourceRelHomePath", sources[i]);
+        formData.append("destinationRelHomePath", destinations[i]);
+        if (resolutions) {
+            formData.append("conflictResolution", resolutions[i]);
+        }
+    }
+    fetch(getRootUrl("/api/move"), { method: "POST", body: formData }).then((response) => {
+        if (response.ok) {
+            location.reload();
+        } else if (response.headers.get("Content-Type") == "application/json") {
+            response.json().then(async (data) => {
+                toggleLoading();
+                // the other items have already been moved
+                const failed = data.results.filter(result => result.status == "error");
+                if (failed.length > 0) {
+                    await customAlert(`Failed to move:\n\n${failed.map(result => result.source).join("\n")}`);
+                }
+                const conflicts = data.results.filter(result => result.status == "conflict").map(result => result.conflict);
+                const resolutions = conflicts.length > 0 ? await resolveConflicts(conflicts) : null;
+                if (!resolutions) {
                     location.reload();
-                } else {
-                    response.text().then((text) => notifyError(text));
-                    toggleLoading();
+                    return;
                 }
+                toggleLoading();
+                callMoveApi(
+                    conflicts.map(conflict => conflict.source.path),
+                    conflicts.map(conflict => conflict.destination.path),
+                    resolutions,
+                );
             });
+        } else {
+            response.text().then((text) => notifyError(text));
+            toggleLoading();
+        }
+    });
+}
+
+async function resolveConflicts(conflicts) {
+    let resolutions = [];
+    let appliedResolution = null;
+    for (let i = 0; i < conflicts.length; i++) {
+        if (appliedResolution) {
+            resolutions.push(appliedResolution);
+            continue;
+        }
+
+        const result = await resolveConflict(conflicts[i], conflicts.length - i - 1);
+        if (!result) return null;
+
+        resolutions.push(result.resolution);
+        if (result.applyToAll) {
+            appliedResolution = result.resolution;
+        }
+    }
+    return resolutions;
+}
+
+function resolveConflict(conflict, remainingCount) {
+    return new Promise((resolve) => {
+        const dialogElement = document.getElementById("conflict-dialog");
+        const applyAllElement = document.getElementById("conflict-apply-all");
+
+        document.getElementById("conflict-message").textContent = `'${conflict.destination.path}' already exists.`;
+        document.getElementById("conflict-destination-size").textContent = conflict.destination.humanSize;
+        document.getElementById("conflict-destination-time").textContent = conflict.destination.lastModified;
+        document.getElementById("conflict-source-size").textContent = conflict.source.humanSize;
+        document.getElementById("conflict-source-time").textContent = conflict.source.lastModified;
+        document.getElementById("conflict-apply-all-label").hidden = remainingCount == 0;
+        applyAllElement.checked = false;
+
+        const choose = (resolution) => {
+            dialogElement.close();
+            resolve(resolution ? { resolution: resolution, applyToAll: applyAllElement.checked } : null);
+        };
+
+        document.getElementById("conflict-overwrite").onclick = () => choose("overwrite");
+        document.getElementById("conflict-keep-both").onclick = () => choose("keep-both");
+        document.getElementById("conflict-skip").onclick = () => choose("skip");
+        document.getElementById("conflict-cancel").onclick = () => choose(null);
+        dialogElement.oncancel = () => resolve(null);
+
+        dialogElement.showModal();
+    });
+}
+
+function openMoveToDialog(name, relHomePath) {
+    document.getElementById("move-to-field-source").value = relHomePath;
+    document.getElementById("move-to-field-name").value = name;
+
+    const treeElement = document.getElementById("move-to-tree");
+    treeElement.innerHTML = "";
+    const rootListElement = document.createElement("ul");
+    rootListElement.appendChild(createDirectoryTreeNode(pageRootName, "/"));
+    treeElement.appendChild(rootListElement);
+    selectMoveToDirectory(rootListElement.firstChild);
+    toggleDirectoryTreeNode(rootListElement.firstChild);
+
+    document.getElementById("move-to-dialog").showModal();
+}
+
+function createDirectoryTreeNode(name, relHomePath) {
+    const itemElement = document.createElement("li");
+    itemElement.dataset.path = relHomePath;
+
+    const toggleElement = document.createElement("span");
+    toggleElement.className = "clickable";
+    toggleElement.textContent = "+ ";
+    toggleElement.onclick = () => toggleDirectoryTreeNode(itemElement);
+
+    const nameElement = document.createElement("span");
+    nameElement.className = "clickable";
+    nameElement.textContent = name;
+    nameElement.onclick = () => selectMoveToDirectory(itemElement);
+    nameElement.ondblclick = () => toggleDirectoryTreeNode(itemElement);
+
+    itemElement.appendChild(toggleElement);
+    itemElement.appendChild(nameElement);
+    return itemElement;
+}
+
+function toggleDirectoryTreeNode(itemElement) {
+    const toggleElement = itemElement.firstChild;
+    const childListElement = itemElement.querySelector(":scope > ul");
+    if (childListElement) {
+        childListElement.remove();
+        toggleElement.textContent = "+ ";
+        return;
+    }
+
+    const url = new URL(getRootUrl("/api/directory-tree" + itemElement.dataset.path));
+    const urlParams = new URLSearchParams(window.location.search);
+    if (urlParams.get("showDotfiles")) {
+        url.searchParams.set("showDotfiles", urlParams.get("showDotfiles"));
+    }
+
+    fetch(url.toString(), { method: "GET" }).then((response) => {
+        if (!response.ok) {
+            response.text().then((text) => notifyError(text));
+            return;
         }
+
+        response.json().then((treeItems) => {
+            const listElement = document.createElement("ul");
+            for (const treeItem of treeItems) {
+                listElement.appendChild(createDirectoryTreeNode(treeItem.name, treeItem.path));
+            }
+            itemElement.appendChild(listElement);
+            toggleElement.textContent = treeItems.length ? "- " : "  ";
+        });
     });
 }
 
+function selectMoveToDirectory(itemElement) {
+    for (const element of document.querySelectorAll("#move-to-tree ." + selectedClassName)) {
+        element.classList.remove(selectedClassName);
+    }
+    itemElement.children[1].classList.add(selectedClassName);
+    document.getElementById("move-to-field-directory").value = itemElement.dataset.path;
+}
+
+document.getElementById("move-to-form").addEventListener("submit", function (event) {
+    event.preventDefault();
+    const formData = new FormData(this);
+    const source = formData.get("sourceRelHomePath");
+    const destination = pathJoin(formData.get("directory"), formData.get("name"));
+    customConfirm(`Are you sure you want to move '${source}' to '${destination}'?`).then(confirmed => {
+        if (confirmed) {
+            document.getElementById("move-to-dialog").close();
+            toggleLoading();
+            callMoveApi([source], [destination], null);
+        }
+    });
+});
+
 function compressDirectory(name, relHomePath) {
     customConfirm(`Are you sure you want to compress '${name}'?`).then(confirmed => {
         if (confirmed) {
-            callFileApi("compress", relHomePath);
+            callFileApi("compress", relHomePath, getRootParams());
         }
     });
 }
@@ -364,14 +596,41 @@ function compressDirectory(name, relHomePath) {
 function extractFile(name, relHomePath) {
     customConfirm(`Are you sure you want to extract '${name}'?`).then(confirmed => {
         if (confirmed) {
-            callFileApi("extract", relHomePath);
+            callFileApi("extract", relHomePath, getRootParams());
         }
     });
 }
 
+function openShareDialog(name, relHomePath) {
+    document.getElementById("share-field-name").value = name;
+    document.getElementById("share-field-path").value = relHomePath;
+    document.getElementById("share-dialog").showModal();
+}
+
+document.getElementById("share-form").addEventListener("submit", function (event) {
+    event.preventDefault();
+    const formData = new FormData(this);
+    const name = formData.get("name");
+    const recipient = formData.get("recipient");
+    customConfirm(`Are you sure you want to share '${name}' with '${recipient}'?`).then(confirmed => {
+        if (confirmed) {
+            document.getElementById("share-dialog").close();
+            toggleLoading();
+            fetch(getUrl("/api/share"), { method: "POST", body: formData }).then((response) => {
+                if (response.ok) {
+                    notifyInfo(`Shared '${name}' with '${recipient}'.`);
+                } else {
+                    response.text().then((text) => notifyError(text));
+                }
+                toggleLoading();
+            });
+        }
+    });
+});
+
 function downloadFile(filePath) {
     const a = document.createElement("a");
-    a.href = "/api/download" + filePath;
+    a.href = getRootUrl("/api/download" + filePath);
     a.download = true;
     a.click();
     a.remove();
@@ -380,7 +639,7 @@ function downloadFile(filePath) {
 function moveToTrash(name, relHomePath) {
     customConfirm(`Are you sure you want to move '${name}' to the trash?`).then(confirmed => {
         if (confirmed) {
-            callFileApi("trash", relHomePath);
+            callFileApi("trash", relHomePath, getRootParams());
         }
     });
 }
@@ -393,4 +652,18 @@ function pathJoin(left, right) {
         right = right.slice(1);
     }
     return left + right;
+}
+
+function getRootParams() {
+    if (pageSpace) return { space: pageSpace };
+    if (pageShare) return { share: pageShare };
+    return {};
+}
+
+function getRootUrl(urlPath) {
+    const url = new URL(getUrl(urlPath), window.location.origin);
+    for (const [key, value] of Object.entries(getRootParams())) {
+        url.searchParams.set(key, value);
+    }
+    return url.toString();
 }
\ No newline at end of file
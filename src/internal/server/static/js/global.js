@@ -1,7 +1,51 @@
 document.addEventListener("DOMContentLoaded", () => {
     setTableSortIcons();
+    bindCommonActions();
 });
 
+// ground can be served under a path by a reverse proxy, so absolute paths are built with this
+const basePath = document.querySelector("meta[name='base-path']").content;
+
+function getUrl(path) {
+    return basePath + path;
+}
+
+// state changing requests send the token from the page, other sites cannot read it to forge them
+const unprotectedFetch = window.fetch;
+window.fetch = (resource, options = {}) => {
+    const method = (options.method || "GET").toUpperCase();
+    if (!["GET", "HEAD", "OPTIONS"].includes(method)) {
+        const headers = new Headers(options.headers);
+        headers.set("X-CSRF-Token", document.querySelector("meta[name='csrf-token']").content);
+        options = { ...options, headers: headers };
+    }
+    return unprotectedFetch(resource, options);
+};
+
+// inline handlers are blocked by the content security policy, so common actions are declared with data attributes
+function bindCommonActions() {
+    for (const element of document.querySelectorAll("[data-href]")) {
+        element.addEventListener("click", () => window.location.href = element.dataset.href);
+    }
+
+    for (const element of document.querySelectorAll("[data-show-dialog]")) {
+        element.addEventListener("click", () => document.getElementById(element.dataset.showDialog).showModal());
+    }
+
+    for (const element of document.querySelectorAll("[data-close-dialog]")) {
+        element.addEventListener("click", () => document.getElementById(element.dataset.closeDialog).close());
+    }
+
+    for (const element of document.querySelectorAll("[data-sort-by]")) {
+        element.addEventListener("click", () => reloadPageWithSortBy(element.dataset.sortBy));
+    }
+
+    const logoutElement = document.getElementById("logout");
+    if (logoutElement) {
+        logoutElement.addEventListener("click", confirmLogout);
+    }
+}
+
 function setTableSortIcons() {
     const urlParams = new URLSearchParams(window.location.search);
     if (!urlParams) return;
@@ -18,9 +62,9 @@ function setTableSortIcons() {
 
     const imgElement = document.createElement("img");
     if (urlParams.get("sortOrder") == "desc") {
-        imgElement.src = "/static/symbols/sort-desc.svg";
+        imgElement.src = getUrl("/static/symbols/sort-desc.svg");
     } else {
-        imgElement.src = "/static/symbols/sort-asc.svg";
+        imgElement.src = getUrl("/static/symbols/sort-asc.svg");
     }
     imgElement.alt = "Sort Icon"
     imgElement.width = 16;
@@ -126,6 +170,26 @@ function customConfirm(message) {
     });
 }
 
+function customAlert(message) {
+    return new Promise((resolve) => {
+        const dialogElement = document.getElementById("confirm-dialog");
+        const messageElement = document.getElementById("confirm-message");
+        const okElement = document.getElementById("confirm-ok");
+        const cancelElement = document.getElementById("confirm-cancel");
+
+        messageElement.textContent = message;
+        cancelElement.parentElement.hidden = true;
+
+        okElement.onclick = () => {
+            cancelElement.parentElement.hidden = false;
+            resolve();
+            dialogElement.close();
+        }
+
+        dialogElement.showModal();
+    });
+}
+
 function confirmLogout() {
     customConfirm("Are you sure you want to logout?").then(confirmed => {
         if (confirmed) {
@@ -135,14 +199,18 @@ function confirmLogout() {
 }
 
 function logout() {
-    fetch("/api/logout", { method: "POST" }).then(() => location.reload());
+    fetch(getUrl("/api/logout"), { method: "POST" }).then(() => location.reload());
 }
 
-function callFileApi(api, relHomePath) {
+function callFileApi(api, relHomePath, rootParams = {}) {
     toggleLoading();
     const formData = new FormData();
     formData.append("relHomePath", relHomePath);
-    fetch("/api/" + api, { method: "POST", body: formData }).then((response) => {
+    const url = new URL(getUrl("/api/" + api), window.location.origin);
+    for (const [key, value] of Object.entries(rootParams)) {
+        url.searchParams.set(key, value);
+    }
+    fetch(url.toString(), { method: "POST", body: formData }).then((response) => {
         if (response.ok) {
             location.reload();
         } else {
@@ -152,9 +220,13 @@ function callFileApi(api, relHomePath) {
     });
 }
 
-function getDirectoryDiskUsage(dirPath) {
+function getDirectoryDiskUsage(dirPath, rootParams = {}) {
     return new Promise((resolve, reject) => {
-        fetch(`/api/disk-usage${dirPath}`, { method: "GET" })
+        const url = new URL(getUrl(`/api/disk-usage${dirPath}`), window.location.origin);
+        for (const [key, value] of Object.entries(rootParams)) {
+            url.searchParams.set(key, value);
+        }
+        fetch(url.toString(), { method: "GET" })
             .then((response) => {
                 if (response.ok) {
                     resolve(response.text());
@@ -164,4 +236,39 @@ function getDirectoryDiskUsage(dirPath) {
             })
             .catch(() => reject());
     });
+}
+
+function base64UrlToBuffer(base64Url) {
+    const base64 = base64Url.replace(/-/g, "+").replace(/_/g, "/");
+    return Uint8Array.from(atob(base64), (c) => c.charCodeAt(0)).buffer;
+}
+
+function bufferToBase64Url(buffer) {
+    const binary = String.fromCharCode(...new Uint8Array(buffer));
+    return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+// policy violations are listed under the password fields, anything else is a notification
+function showPasswordViolations(formElement, response) {
+    const listElement = formElement.querySelector(".password-violations");
+    clearPasswordViolations(formElement);
+    if (response.status != 422) {
+        return response.text().then((text) => notifyError(text));
+    }
+    return response.json().then((body) => {
+        for (const violation of body.violations) {
+            const itemElement = document.createElement("li");
+            itemElement.textContent = violation;
+            listElement.appendChild(itemElement);
+        }
+        listElement.hidden = false;
+    });
+}
+
+function clearPasswordViolations(formElement) {
+    const listElement = formElement.querySelector(".password-violations");
+    if (listElement) {
+        listElement.replaceChildren();
+        listElement.hidden = true;
+    }
 }
\ No newline at end of file
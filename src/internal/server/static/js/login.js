@@ -1,13 +1,101 @@
+// passkeys need browser support and a secure context
+const passkeyLoginButtonElement = document.getElementById("passkey-login-button");
+passkeyLoginButtonElement.hidden = !window.PublicKeyCredential;
+passkeyLoginButtonElement.onclick = () => loginWithPasskey();
+
 document.getElementById("login-form").addEventListener("submit", function (event) {
     event.preventDefault();
     const formData = new FormData(this);
     toggleLoading();
-    fetch("/api/login", { method: "POST", body: formData }).then((response) => {
-        if (response.ok) {
-            location.reload();
-        } else {
+    fetch(getUrl("/api/login"), { method: "POST", body: formData }).then(handleLoginResponse);
+});
+
+document.getElementById("totp-form").addEventListener("submit", function (event) {
+    event.preventDefault();
+    const formData = new FormData(this);
+    toggleLoading();
+    fetch(getUrl("/api/login/totp"), { method: "POST", body: formData }).then(handleLoginResponse);
+});
+
+document.getElementById("password-change-form").addEventListener("submit", function (event) {
+    event.preventDefault();
+    const formData = new FormData(this);
+    toggleLoading();
+    fetch(getUrl("/api/login/password"), { method: "POST", body: formData }).then(handleLoginResponse);
+});
+
+// accepted responses name the next login step, unauthorized means the pending login expired
+function handleLoginResponse(response) {
+    if (response.status == 202) {
+        response.text().then((step) => {
+            showLoginStep(step);
+            toggleLoading();
+        });
+    } else if (response.ok) {
+        location.reload();
+    } else if (response.status == 422) {
+        showPasswordViolations(document.getElementById("password-change-form"), response);
+        toggleLoading();
+    } else if (response.status == 401) {
+        response.text().then((text) => notifyError(text));
+        showLoginStep("password");
+        toggleLoading();
+    } else {
+        response.text().then((text) => notifyError(text));
+        toggleLoading();
+    }
+}
+
+function showLoginStep(step) {
+    const forms = {
+        "password": document.getElementById("login-form"),
+        "totp": document.getElementById("totp-form"),
+        "password-change": document.getElementById("password-change-form"),
+    };
+    for (const [formStep, form] of Object.entries(forms)) {
+        form.hidden = formStep != step;
+        if (formStep != "password") {
+            form.reset();
+        }
+        clearPasswordViolations(form);
+    }
+    document.getElementById("passkey-login-button").hidden = step != "password" || !window.PublicKeyCredential;
+    forms[step].querySelector("input:not([hidden])").focus();
+}
+
+function loginWithPasskey() {
+    // a username narrows the choice to that user's passkeys, without one the browser offers every passkey for this site
+    const optionsFormData = new FormData();
+    optionsFormData.append("username", document.getElementById("username").value);
+    toggleLoading();
+    fetch(getUrl("/api/login/passkey/options"), { method: "POST", body: optionsFormData }).then((response) => {
+        if (!response.ok) {
             response.text().then((text) => notifyError(text));
             toggleLoading();
+            return;
         }
+        return response.json().then((options) => navigator.credentials.get({
+            publicKey: {
+                challenge: base64UrlToBuffer(options.challenge),
+                rpId: options.rpId,
+                allowCredentials: options.allowCredentialIds.map((id) => ({ type: "public-key", id: base64UrlToBuffer(id) })),
+                userVerification: "preferred",
+                timeout: options.timeout,
+            },
+        })).then((credential) => {
+            const formData = new FormData();
+            formData.append("username", optionsFormData.get("username"));
+            formData.append("credentialId", bufferToBase64Url(credential.rawId));
+            formData.append("clientDataJSON", bufferToBase64Url(credential.response.clientDataJSON));
+            formData.append("authenticatorData", bufferToBase64Url(credential.response.authenticatorData));
+            formData.append("signature", bufferToBase64Url(credential.response.signature));
+            if (credential.response.userHandle) {
+                formData.append("userHandle", bufferToBase64Url(credential.response.userHandle));
+            }
+            return fetch(getUrl("/api/login/passkey"), { method: "POST", body: formData });
+        }).then(handleLoginResponse).catch((error) => {
+            notifyError(`Passkey login failed: ${error.message}`);
+            toggleLoading();
+        });
     });
-});
\ No newline at end of file
+}
\ No newline at end of file
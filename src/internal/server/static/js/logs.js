@@ -0,0 +1,135 @@
+const logRecordsShown = 500;
+const logUserKeys = ["requestor", "username", "owner"];
+
+let logStream = null;
+let lastLogRecordId = 0;
+
+document.addEventListener("DOMContentLoaded", () => {
+    loadLogRecords();
+});
+
+document.getElementById("log-filter-form").addEventListener("submit", function (event) {
+    event.preventDefault();
+    loadLogRecords();
+});
+
+document.getElementById("log-live").addEventListener("change", () => {
+    updateLogStream();
+});
+
+function getLogFilterParams() {
+    const params = new URLSearchParams();
+    for (const [key, value] of new FormData(document.getElementById("log-filter-form"))) {
+        if (value.trim()) {
+            params.set(key, value.trim());
+        }
+    }
+    return params;
+}
+
+function loadLogRecords() {
+    const params = getLogFilterParams();
+    params.set("limit", logRecordsShown);
+    fetch(getUrl(`/api/logs?${params}`)).then((response) => {
+        if (!response.ok) {
+            response.text().then((text) => notifyError(text));
+            return;
+        }
+        response.json().then((result) => {
+            const recordsElement = document.getElementById("log-records");
+            recordsElement.replaceChildren();
+            lastLogRecordId = 0;
+            for (const record of result.records) {
+                addLogRecord(record);
+            }
+            updateLogStream();
+        });
+    });
+}
+
+// the stream starts after the last record shown, so nothing logged in between is missed
+function updateLogStream() {
+    if (logStream) {
+        logStream.close();
+        logStream = null;
+    }
+
+    const statusElement = document.getElementById("log-status");
+    if (!document.getElementById("log-live").checked) {
+        statusElement.innerText = "Live updates are paused.";
+        return;
+    }
+
+    const params = getLogFilterParams();
+    params.set("after", lastLogRecordId);
+    logStream = new EventSource(getUrl(`/api/logs/stream?${params}`));
+    logStream.onopen = () => {
+        statusElement.innerText = "Showing new records as they are logged.";
+    };
+    logStream.onerror = () => {
+        statusElement.innerText = logStream.readyState == EventSource.CLOSED ? "Live updates stopped, reload the page to resume." : "Live updates disconnected, reconnecting...";
+    };
+    logStream.onmessage = (event) => {
+        addLogRecord(JSON.parse(event.data));
+    };
+}
+
+// newest first, older rows are dropped once the table is full
+function addLogRecord(record) {
+    if (record.id <= lastLogRecordId) return;
+    lastLogRecordId = record.id;
+
+    const recordsElement = document.getElementById("log-records");
+    recordsElement.prepend(createLogRow(record));
+    while (recordsElement.children.length > logRecordsShown) {
+        recordsElement.lastChild.remove();
+    }
+}
+
+function createLogRow(record) {
+    const row = document.createElement("tr");
+
+    const timeCell = document.createElement("td");
+    timeCell.innerText = new Date(record.time).toLocaleString();
+    row.appendChild(timeCell);
+
+    const levelCell = document.createElement("td");
+    levelCell.innerText = record.level;
+    levelCell.classList.add(`log-level-${record.level.toLowerCase()}`);
+    row.appendChild(levelCell);
+
+    const messageCell = document.createElement("td");
+    messageCell.innerText = record.message;
+    row.appendChild(messageCell);
+
+    const detailsCell = document.createElement("td");
+    for (const attr of record.attrs || []) {
+        const attrElement = document.createElement("div");
+        attrElement.classList.add("log-attr");
+
+        const keyElement = document.createElement("span");
+        keyElement.classList.add("muted");
+        keyElement.innerText = `${attr.key}: `;
+        attrElement.appendChild(keyElement);
+
+        // errors joined with errors.Join keep one cause per line
+        const valueElement = document.createElement("span");
+        valueElement.innerText = attr.value;
+        if (attr.key == "ip" || logUserKeys.includes(attr.key)) {
+            valueElement.classList.add("clickable");
+            valueElement.title = "Filter by this value";
+            valueElement.onclick = () => filterLogsBy(attr.key == "ip" ? "ip" : "user", attr.value);
+        }
+        attrElement.appendChild(valueElement);
+
+        detailsCell.appendChild(attrElement);
+    }
+    row.appendChild(detailsCell);
+
+    return row;
+}
+
+function filterLogsBy(name, value) {
+    document.getElementById(`log-filter-${name}`).value = value;
+    loadLogRecords();
+}
\ No newline at end of file
@@ -0,0 +1,21 @@
+for (const buttonElement of document.getElementsByClassName("delete-share")) {
+    buttonElement.onclick = () => deleteShare(buttonElement.dataset.id, buttonElement.dataset.path, buttonElement.dataset.recipient);
+}
+
+function deleteShare(id, relHomePath, recipient) {
+    customConfirm(`Are you sure you want to stop sharing '${relHomePath}' with '${recipient}'?`).then(confirmed => {
+        if (confirmed) {
+            toggleLoading();
+            const formData = new FormData();
+            formData.append("id", id);
+            fetch(getUrl("/api/share"), { method: "DELETE", body: formData }).then((response) => {
+                if (response.ok) {
+                    location.reload();
+                } else {
+                    response.text().then((text) => notifyError(text));
+                    toggleLoading();
+                }
+            });
+        }
+    });
+}
\ No newline at end of file
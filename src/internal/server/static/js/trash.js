@@ -1,8 +1,13 @@
+const pageData = document.getElementById("page-data").dataset;
+const pageRootPath = pageData.rootPath;
+const pageSpace = pageData.space;
+const pageTrashUrl = pageData.trashUrl;
+
 document.addEventListener("DOMContentLoaded", () => {
     const diskUsageElement = document.getElementById("disk-usage");
     if (!diskUsageElement) return;
 
-    getDirectoryDiskUsage(pageRootPath).then((diskUsage) => {
+    getDirectoryDiskUsage(pageRootPath, getRootParams()).then((diskUsage) => {
         diskUsageElement.innerText = `Disk Usage: ${diskUsage}`;
     });
 });
@@ -10,6 +15,23 @@ document.addEventListener("DOMContentLoaded", () => {
 const selectedClassName = "highlighted-extra";
 let selectedRow = null;
 
+for (const rowElement of document.getElementsByClassName("trash-entry")) {
+    rowElement.onclick = () => selectRow(rowElement);
+    rowElement.ondblclick = () => window.location.href = rowElement.dataset.url;
+}
+
+for (const checkboxElement of document.getElementsByClassName("select-checkbox")) {
+    checkboxElement.onclick = (event) => event.stopPropagation();
+    checkboxElement.onchange = () => updateSelectedActions();
+}
+
+for (const restoreElement of document.getElementsByClassName("restore-dir")) {
+    restoreElement.onclick = (event) => {
+        event.stopPropagation();
+        restoreDir(restoreElement.dataset.dirName, restoreElement.dataset.trashedOn);
+    };
+}
+
 function selectRow(element) {
     if (selectedRow) {
         selectedRow.classList.remove(selectedClassName);
@@ -22,9 +44,9 @@ function emptyTrash() {
     customConfirm("Are you sure you want to empty the trash?\nThis is permanent and cannot be undone.").then(confirmed => {
         if (confirmed) {
             toggleLoading();
-            fetch("/api/trash", { method: "DELETE" }).then((response) => {
+            fetch(getRootUrl("/api/trash"), { method: "DELETE" }).then((response) => {
                 if (response.ok) {
-                    location.href = "/trash";
+                    location.href = getUrl(pageTrashUrl);
                 } else {
                     response.text().then((text) => notifyError(text));
                     toggleLoading();
@@ -40,7 +62,7 @@ function restoreDir(trashDirName, trashedOn) {
             toggleLoading();
             const formData = new FormData();
             formData.append("trashDirName", trashDirName);
-            fetch("/api/restore", { method: "POST", body: formData }).then((response) => {
+            fetch(getRootUrl("/api/restore"), { method: "POST", body: formData }).then((response) => {
                 if (response.ok) {
                     location.reload();
                 } else {
@@ -50,4 +72,132 @@ function restoreDir(trashDirName, trashedOn) {
             });
         }
     });
+}
+
+const selectedActionRestoreElement = document.getElementById("selected-action-restore");
+const selectedActionRestoreToElement = document.getElementById("selected-action-restore-to");
+const selectedActionDeleteElement = document.getElementById("selected-action-delete");
+
+selectedActionRestoreElement.onclick = () => restoreSelected();
+selectedActionRestoreToElement.onclick = () => openRestoreToDialog();
+selectedActionDeleteElement.onclick = () => deleteSelected();
+document.getElementById("empty-trash").onclick = () => emptyTrash();
+document.getElementById("select-all-checkbox").onclick = (event) => selectAll(event.target.checked);
+
+function getSelectedRows() {
+    let rows = [];
+    for (const checkboxElement of document.getElementsByClassName("select-checkbox")) {
+        if (checkboxElement.checked) {
+            rows.push(checkboxElement.closest("tr"));
+        }
+    }
+    return rows;
+}
+
+function getSelectedTrashDirNames() {
+    const trashDirNames = new Set(getSelectedRows().map(row => row.dataset.dirName));
+    return Array.from(trashDirNames);
+}
+
+function updateSelectedActions() {
+    const noneSelected = getSelectedRows().length == 0;
+    selectedActionRestoreElement.disabled = noneSelected;
+    selectedActionRestoreToElement.disabled = noneSelected;
+    selectedActionDeleteElement.disabled = noneSelected;
+}
+
+function selectAll(checked) {
+    for (const checkboxElement of document.getElementsByClassName("select-checkbox")) {
+        checkboxElement.checked = checked;
+    }
+    updateSelectedActions();
+}
+
+function callTrashDirApis(trashDirNames, callApi) {
+    toggleLoading();
+    let failedCount = 0;
+    const promises = trashDirNames.map(trashDirName => {
+        return callApi(trashDirName).then((response) => {
+            if (!response.ok) {
+                failedCount += 1;
+            }
+        });
+    });
+
+    Promise.all(promises)
+        .finally(() => {
+            if (failedCount) {
+                notifyError(`Failed for ${failedCount} out of ${trashDirNames.length} trash entries.`, true);
+                toggleLoading();
+            } else {
+                location.reload();
+            }
+        });
+}
+
+function restoreTrashDirs(trashDirNames, destinationRelHomePath) {
+    callTrashDirApis(trashDirNames, (trashDirName) => {
+        const formData = new FormData();
+        formData.append("trashDirName", trashDirName);
+        if (destinationRelHomePath) {
+            formData.append("destinationRelHomePath", destinationRelHomePath);
+        }
+        return fetch(getRootUrl("/api/restore"), { method: "POST", body: formData });
+    });
+}
+
+function restoreSelected() {
+    const trashDirNames = getSelectedTrashDirNames();
+    if (trashDirNames.length == 0) return;
+    customConfirm(`Are you sure you want to restore ${trashDirNames.length} trash entries to their original location?`).then(confirmed => {
+        if (confirmed) {
+            restoreTrashDirs(trashDirNames, "");
+        }
+    });
+}
+
+function openRestoreToDialog() {
+    const selectedRows = getSelectedRows();
+    if (selectedRows.length == 0) return;
+    document.getElementById("restore-to-field-destination").value = selectedRows[0].dataset.restorePath || "/";
+    document.getElementById("restore-to-dialog").showModal();
+}
+
+document.getElementById("restore-to-form").addEventListener("submit", function (event) {
+    event.preventDefault();
+    const formData = new FormData(this);
+    const destinationRelHomePath = formData.get("destinationRelHomePath");
+    const trashDirNames = getSelectedTrashDirNames();
+    if (trashDirNames.length == 0) return;
+    customConfirm(`Are you sure you want to restore ${trashDirNames.length} trash entries to '${destinationRelHomePath}'?`).then(confirmed => {
+        if (confirmed) {
+            document.getElementById("restore-to-dialog").close();
+            restoreTrashDirs(trashDirNames, destinationRelHomePath);
+        }
+    });
+});
+
+function deleteSelected() {
+    const trashDirNames = getSelectedTrashDirNames();
+    if (trashDirNames.length == 0) return;
+    customConfirm(`Are you sure you want to permanently delete ${trashDirNames.length} trash entries?\nThis is permanent and cannot be undone.`).then(confirmed => {
+        if (confirmed) {
+            callTrashDirApis(trashDirNames, (trashDirName) => {
+                return fetch(getRootUrl(`/api/trash/${encodeURIComponent(trashDirName)}`), { method: "DELETE" });
+            });
+        }
+    });
+}
+
+function getRootParams() {
+    if (pageSpace) return { space: pageSpace };
+    return {};
+}
+
+function getRootUrl(urlPath) {
+    const url = new URL(getUrl(urlPath), window.location.origin);
+    for (const [key, value] of Object.entries(getRootParams())) {
+        url.searchParams.set(key, value);
+    }
+    return url.toString();
 }
\ No newline at end of file
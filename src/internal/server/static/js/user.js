@@ -1,9 +1,36 @@
+const pageData = document.getElementById("page-data").dataset;
+const currentUsername = pageData.username;
+const targetUsername = pageData.targetUsername;
+
+for (const buttonElement of document.getElementsByClassName("delete-ssh-key")) {
+    buttonElement.onclick = () => deleteSshKeyLine(buttonElement.dataset.index);
+}
+
+for (const buttonElement of document.getElementsByClassName("delete-passkey")) {
+    buttonElement.onclick = () => deletePasskey(buttonElement.dataset.id);
+}
+
+for (const [id, action] of Object.entries({
+    "reset-password": resetPassword,
+    "disable-totp": disableTotp,
+    "setup-totp": setupTotp,
+    "delete-user": deleteUser,
+})) {
+    const buttonElement = document.getElementById(id);
+    if (buttonElement) {
+        buttonElement.onclick = () => action();
+    }
+}
+
+document.getElementById("recovery-codes-close").onclick = () => location.reload();
+
 document.getElementById("change-password-form").addEventListener("submit", function (event) {
     event.preventDefault();
     const formData = new FormData(this);
     toggleLoading();
-    fetch("/api/user/password/change", { method: "POST", body: formData }).then((response) => {
+    fetch(getUrl("/api/user/password/change"), { method: "POST", body: formData }).then((response) => {
         if (response.ok) {
+            clearPasswordViolations(this);
             if (currentUsername == targetUsername) {
                 logout();
             } else {
@@ -11,7 +38,7 @@ document.getElementById("change-password-form").addEventListener("submit", funct
                 notifyInfo("Password changed successfully.");
             }
         } else {
-            response.text().then((text) => notifyError(text));
+            showPasswordViolations(this, response);
             toggleLoading();
         }
     });
@@ -24,7 +51,7 @@ document.getElementById("add-ssh-key-form").addEventListener("submit", function
         if (confirmed) {
             document.getElementById("add-ssh-key-dialog").close();
             toggleLoading();
-            fetch("/api/user/ssh-key", { method: "POST", body: formData }).then((response) => {
+            fetch(getUrl("/api/user/ssh-key"), { method: "POST", body: formData }).then((response) => {
                 if (response.ok) {
                     location.reload();
                 } else {
@@ -43,7 +70,7 @@ function deleteSshKeyLine(index) {
             const formData = new FormData();
             formData.append("username", targetUsername);
             formData.append("index", index);
-            fetch("/api/user/ssh-key", { method: "DELETE", body: formData }).then((response) => {
+            fetch(getUrl("/api/user/ssh-key"), { method: "DELETE", body: formData }).then((response) => {
                 if (response.ok) {
                     location.reload();
                 } else {
@@ -61,14 +88,16 @@ function resetPassword() {
             toggleLoading();
             const formData = new FormData();
             formData.append("username", targetUsername);
-            fetch("/api/user/password/reset", { method: "POST", body: formData }).then((response) => {
+            fetch(getUrl("/api/user/password/reset"), { method: "POST", body: formData }).then((response) => {
                 if (response.ok) {
-                    if (currentUsername == targetUsername) {
-                        logout();
-                    } else {
+                    response.text().then((password) => {
                         toggleLoading();
-                        notifyInfo("Password reset successfully.");
-                    }
+                        return customAlert(`Temporary password for '${targetUsername}', it will not be shown again:\n\n${password}`);
+                    }).then(() => {
+                        if (currentUsername == targetUsername) {
+                            logout();
+                        }
+                    });
                 } else {
                     response.text().then((text) => notifyError(text));
                     toggleLoading();
@@ -84,12 +113,12 @@ function deleteUser() {
             toggleLoading();
             const formData = new FormData();
             formData.append("username", targetUsername);
-            fetch("/api/user", { method: "DELETE", body: formData }).then((response) => {
+            fetch(getUrl("/api/user"), { method: "DELETE", body: formData }).then((response) => {
                 if (response.ok) {
                     if (currentUsername == targetUsername) {
                         logout();
                     } else {
-                        location.href = "/admin";
+                        location.href = getUrl("/admin");
                     }
                 } else {
                     response.text().then((text) => notifyError(text));
@@ -98,4 +127,137 @@ function deleteUser() {
             });
         }
     });
+}
+
+function setupTotp() {
+    toggleLoading();
+    fetch(getUrl("/api/user/totp/setup"), { method: "POST" }).then((response) => {
+        if (response.ok) {
+            response.json().then((setup) => {
+                document.getElementById("setup-totp-qr-code").innerHTML = setup.qrSvg;
+                document.getElementById("setup-totp-secret").innerText = setup.secret;
+                document.getElementById("setup-totp-field-secret").value = setup.secret;
+                document.getElementById("setup-totp-dialog").showModal();
+                toggleLoading();
+            });
+        } else {
+            response.text().then((text) => notifyError(text));
+            toggleLoading();
+        }
+    });
+}
+
+document.getElementById("setup-totp-form").addEventListener("submit", function (event) {
+    event.preventDefault();
+    const formData = new FormData(this);
+    toggleLoading();
+    fetch(getUrl("/api/user/totp"), { method: "POST", body: formData }).then((response) => {
+        if (response.ok) {
+            response.json().then((result) => {
+                document.getElementById("setup-totp-dialog").close();
+                document.getElementById("recovery-codes").innerText = result.recoveryCodes.join("\n");
+                document.getElementById("recovery-codes-dialog").showModal();
+                toggleLoading();
+            });
+        } else {
+            response.text().then((text) => notifyError(text));
+            toggleLoading();
+        }
+    });
+});
+
+const disableTotpForm = document.getElementById("disable-totp-form");
+if (disableTotpForm) {
+    disableTotpForm.addEventListener("submit", function (event) {
+        event.preventDefault();
+        const formData = new FormData(this);
+        customConfirm("Are you sure you want to disable two-factor authentication?").then(confirmed => {
+            if (confirmed) {
+                callDisableTotpApi(formData);
+            }
+        });
+    });
+}
+
+function disableTotp() {
+    customConfirm("Are you sure you want to disable two-factor authentication for this user?").then(confirmed => {
+        if (confirmed) {
+            const formData = new FormData();
+            formData.append("username", targetUsername);
+            callDisableTotpApi(formData);
+        }
+    });
+}
+
+function callDisableTotpApi(formData) {
+    toggleLoading();
+    fetch(getUrl("/api/user/totp"), { method: "DELETE", body: formData }).then((response) => {
+        if (response.ok) {
+            location.reload();
+        } else {
+            response.text().then((text) => notifyError(text));
+            toggleLoading();
+        }
+    });
+}
+
+document.getElementById("add-passkey-form").addEventListener("submit", function (event) {
+    event.preventDefault();
+    const name = new FormData(this).get("name");
+    document.getElementById("add-passkey-dialog").close();
+    toggleLoading();
+    fetch(getUrl("/api/user/passkey/options"), { method: "POST" }).then((response) => {
+        if (!response.ok) {
+            response.text().then((text) => notifyError(text));
+            toggleLoading();
+            return;
+        }
+        return response.json().then((options) => navigator.credentials.create({
+            publicKey: {
+                challenge: base64UrlToBuffer(options.challenge),
+                rp: { id: options.rpId, name: options.rpName },
+                user: { id: base64UrlToBuffer(options.userId), name: options.userName, displayName: options.userName },
+                pubKeyCredParams: options.algorithms.map((alg) => ({ type: "public-key", alg: alg })),
+                excludeCredentials: options.excludeCredentialIds.map((id) => ({ type: "public-key", id: base64UrlToBuffer(id) })),
+                authenticatorSelection: { residentKey: "preferred", userVerification: "preferred" },
+                attestation: "none",
+                timeout: options.timeout,
+            },
+        })).then((credential) => {
+            const formData = new FormData();
+            formData.append("name", name);
+            formData.append("clientDataJSON", bufferToBase64Url(credential.response.clientDataJSON));
+            formData.append("attestationObject", bufferToBase64Url(credential.response.attestationObject));
+            return fetch(getUrl("/api/user/passkey"), { method: "POST", body: formData });
+        }).then((response) => {
+            if (response.ok) {
+                location.reload();
+            } else {
+                response.text().then((text) => notifyError(text));
+                toggleLoading();
+            }
+        }).catch((error) => {
+            notifyError(`Passkey registration failed: ${error.message}`);
+            toggleLoading();
+        });
+    });
+});
+
+function deletePasskey(id) {
+    customConfirm("Are you sure you want to delete this passkey?").then(confirmed => {
+        if (confirmed) {
+            toggleLoading();
+            const formData = new FormData();
+            formData.append("username", targetUsername);
+            formData.append("id", id);
+            fetch(getUrl("/api/user/passkey"), { method: "DELETE", body: formData }).then((response) => {
+                if (response.ok) {
+                    location.reload();
+                } else {
+                    response.text().then((text) => notifyError(text));
+                    toggleLoading();
+                }
+            });
+        }
+    });
 }
\ No newline at end of file
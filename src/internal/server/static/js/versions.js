@@ -0,0 +1,53 @@
+const pagePath = document.getElementById("page-data").dataset.path;
+
+for (const element of document.getElementsByClassName("preview-version")) {
+    element.onclick = () => previewVersion(element.dataset.name);
+}
+
+for (const element of document.getElementsByClassName("download-version")) {
+    element.onclick = () => downloadVersion(element.dataset.name);
+}
+
+for (const element of document.getElementsByClassName("restore-version")) {
+    element.onclick = () => restoreVersion(element.dataset.name, element.dataset.savedOn);
+}
+
+function getVersionUrl(versionName, download) {
+    const url = new URL(getUrl("/api/version" + pagePath), window.location.origin);
+    url.searchParams.set("versionName", versionName);
+    if (download) {
+        url.searchParams.set("download", "true");
+    }
+    return url.toString();
+}
+
+function previewVersion(versionName) {
+    window.open(getVersionUrl(versionName, false), "_blank");
+}
+
+function downloadVersion(versionName) {
+    const a = document.createElement("a");
+    a.href = getVersionUrl(versionName, true);
+    a.download = true;
+    a.click();
+    a.remove();
+}
+
+function restoreVersion(versionName, savedOn) {
+    customConfirm(`Are you sure you want to restore the version saved on ${savedOn}?\nThe current file will be kept as a version.`).then(confirmed => {
+        if (confirmed) {
+            toggleLoading();
+            const formData = new FormData();
+            formData.append("relHomePath", pagePath);
+            formData.append("versionName", versionName);
+            fetch(getUrl("/api/version/restore"), { method: "POST", body: formData }).then((response) => {
+                if (response.ok) {
+                    location.reload();
+                } else {
+                    response.text().then((text) => notifyError(text));
+                    toggleLoading();
+                }
+            });
+        }
+    });
+}
\ No newline at end of file
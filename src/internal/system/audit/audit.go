@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+const auditLogFilePath string = "/etc/ground/audit.log"
+
+// the log is moved aside once it grows past this, keeping one previous file
+const auditLogMaxSize int64 = 10 * 1000 * 1000
+
+var auditMutex sync.Mutex
+
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Requestor string    `json:"requestor"`
+	Ip        string    `json:"ip"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// appends one json line per action, a failed action is recorded along with its error
+func Record(requestor string, ip string, action string, target string, actionErr error) error {
+	entry := Entry{
+		Time:      time.Now(),
+		Requestor: requestor,
+		Ip:        ip,
+		Action:    action,
+		Target:    target,
+	}
+	if actionErr != nil {
+		entry.Error = actionErr.Error()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Join(errors.New("failed to encode audit entry"), err)
+	}
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	err = os.MkdirAll(path.Dir(auditLogFilePath), 0755)
+	if err != nil {
+		return errors.Join(errors.New("failed to create directory"), err)
+	}
+
+	info, err := os.Stat(auditLogFilePath)
+	if err == nil && info.Size() > auditLogMaxSize {
+		err = os.Rename(auditLogFilePath, auditLogFilePath+".1")
+		if err != nil {
+			return errors.Join(errors.New("failed to rotate audit log"), err)
+		}
+	}
+
+	file, err := os.OpenFile(auditLogFilePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Join(errors.New("failed to open audit log"), err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		return errors.Join(errors.New("failed to write audit log"), err)
+	}
+
+	return nil
+}
+
+// newest first, only entries whose action is in the given list
+func GetRecent(actions []string, count int) ([]Entry, error) {
+	if count <= 0 {
+		return []Entry{}, nil
+	}
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	file, err := os.Open(auditLogFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to open audit log"), err)
+	}
+	defer file.Close()
+
+	wanted := make(map[string]bool)
+	for _, action := range actions {
+		wanted[action] = true
+	}
+
+	// a ring of the last matching entries, the file is read once from the start
+	recent := make([]Entry, 0, count)
+	next := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := Entry{}
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil || !wanted[entry.Action] {
+			continue
+		}
+
+		if len(recent) < count {
+			recent = append(recent, entry)
+		} else {
+			recent[next] = entry
+		}
+		next = (next + 1) % count
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read audit log"), err)
+	}
+
+	entries := make([]Entry, 0, len(recent))
+	for i := range recent {
+		entries = append(entries, recent[(next-1-i+len(recent))%len(recent)])
+	}
+	return entries, nil
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const BACKEND_SYSTEM string = "system"
+const BACKEND_PAM string = "pam"
+const BACKEND_HTPASSWD string = "htpasswd"
+const BACKEND_LDAP string = "ldap"
+
+var ErrPasswordNotSettable = errors.New("passwords are not managed by the authentication backend")
+
+var authenticator Authenticator = systemAuthenticator{}
+
+type Authenticator interface {
+	Authenticate(username string, password string) error
+	SetPassword(username string, password string) error
+}
+
+type Options struct {
+	PamService   string
+	HtpasswdFile string
+	LdapUrl      string
+	LdapUserDn   string
+}
+
+func SetupAuthenticator(backend string, options Options) error {
+	switch backend {
+	case BACKEND_SYSTEM:
+		authenticator = systemAuthenticator{}
+	case BACKEND_PAM:
+		pam, err := newPamAuthenticator(options.PamService)
+		if err != nil {
+			return errors.Join(errors.New("failed to setup pam"), err)
+		}
+		authenticator = pam
+	case BACKEND_HTPASSWD:
+		htpasswd, err := newHtpasswdAuthenticator(options.HtpasswdFile)
+		if err != nil {
+			return errors.Join(errors.New("failed to setup htpasswd file"), err)
+		}
+		authenticator = htpasswd
+	case BACKEND_LDAP:
+		ldap, err := newLdapAuthenticator(options.LdapUrl, options.LdapUserDn)
+		if err != nil {
+			return errors.Join(errors.New("failed to setup ldap"), err)
+		}
+		authenticator = ldap
+	default:
+		return errors.New("authentication backend is not valid")
+	}
+
+	return nil
+}
+
+func CredentialsAreValid(username string, password string) bool {
+	if password == "" || strings.ContainsAny(password, "\x00\n") {
+		return false
+	}
+
+	if hash, ok := getPasswordResetHash(username); ok {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	return authenticator.Authenticate(username, password) == nil
+}
+
+func SetPassword(username string, password string) error {
+	if password == "" || strings.ContainsAny(password, "\x00\n") {
+		return errors.New("password is not valid")
+	}
+
+	err := ValidatePassword(username, password)
+	if err != nil {
+		return err
+	}
+
+	err = checkPasswordHistory(username, password)
+	if err != nil {
+		return err
+	}
+
+	err = authenticator.SetPassword(username, password)
+	if err != nil {
+		return err
+	}
+
+	err = addPasswordHistory(username, password)
+	if err != nil {
+		return errors.Join(errors.New("failed to add password history"), err)
+	}
+
+	err = removePasswordReset(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to remove password reset"), err)
+	}
+
+	return nil
+}
+
+// backends like ldap manage passwords elsewhere, so ground cannot set an initial one
+func PasswordsAreSettable() bool {
+	_, ok := authenticator.(ldapAuthenticator)
+	return !ok
+}
+
+// removes the records ground keeps about a user's passwords
+func RemovePasswordRecords(username string) error {
+	err := removePasswordReset(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to remove password reset"), err)
+	}
+
+	err = removePasswordHistory(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to remove password history"), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const cborMaxDepth int = 16
+
+// decodes the subset of cbor that webauthn authenticators produce, returns the value and the bytes after it
+// maps decode to map[any]any with int64 or string keys, definite lengths only
+func cborDecode(b []byte) (any, []byte, error) {
+	return cborDecodeDepth(b, 0)
+}
+
+func cborDecodeDepth(b []byte, depth int) (any, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, errors.New("cbor is nested too deeply")
+	}
+
+	if len(b) == 0 {
+		return nil, nil, errors.New("cbor is truncated")
+	}
+
+	majorType := b[0] >> 5
+	additional := b[0] & 0x1f
+	b = b[1:]
+
+	// simple values and floats carry their value in the additional bits and following bytes
+	if majorType == 7 {
+		switch additional {
+		case 20:
+			return false, b, nil
+		case 21:
+			return true, b, nil
+		case 22, 23:
+			return nil, b, nil
+		case 25:
+			if len(b) < 2 {
+				return nil, nil, errors.New("cbor is truncated")
+			}
+			return float64(float16ToFloat32(binary.BigEndian.Uint16(b))), b[2:], nil
+		case 26:
+			if len(b) < 4 {
+				return nil, nil, errors.New("cbor is truncated")
+			}
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), b[4:], nil
+		case 27:
+			if len(b) < 8 {
+				return nil, nil, errors.New("cbor is truncated")
+			}
+			return math.Float64frombits(binary.BigEndian.Uint64(b)), b[8:], nil
+		default:
+			return nil, nil, errors.New("cbor simple value is not supported")
+		}
+	}
+
+	var argument uint64
+	switch {
+	case additional < 24:
+		argument = uint64(additional)
+	case additional == 24 && len(b) >= 1:
+		argument = uint64(b[0])
+		b = b[1:]
+	case additional == 25 && len(b) >= 2:
+		argument = uint64(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	case additional == 26 && len(b) >= 4:
+		argument = uint64(binary.BigEndian.Uint32(b))
+		b = b[4:]
+	case additional == 27 && len(b) >= 8:
+		argument = binary.BigEndian.Uint64(b)
+		b = b[8:]
+	case additional == 31:
+		return nil, nil, errors.New("cbor indefinite length is not supported")
+	default:
+		return nil, nil, errors.New("cbor is truncated")
+	}
+
+	switch majorType {
+	case 0:
+		if argument > math.MaxInt64 {
+			return nil, nil, errors.New("cbor integer is too large")
+		}
+		return int64(argument), b, nil
+	case 1:
+		if argument > math.MaxInt64 {
+			return nil, nil, errors.New("cbor integer is too large")
+		}
+		return -1 - int64(argument), b, nil
+	case 2, 3:
+		if argument > uint64(len(b)) {
+			return nil, nil, errors.New("cbor is truncated")
+		}
+		value := b[:argument]
+		if majorType == 3 {
+			return string(value), b[argument:], nil
+		}
+		return append([]byte{}, value...), b[argument:], nil
+	case 4:
+		// every item takes at least one byte, a larger count cannot be valid
+		if argument > uint64(len(b)) {
+			return nil, nil, errors.New("cbor is truncated")
+		}
+		items := make([]any, 0, argument)
+		for range argument {
+			var item any
+			var err error
+			item, b, err = cborDecodeDepth(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, b, nil
+	case 5:
+		if argument > uint64(len(b)) {
+			return nil, nil, errors.New("cbor is truncated")
+		}
+		entries := make(map[any]any, argument)
+		for range argument {
+			var key, value any
+			var err error
+			key, b, err = cborDecodeDepth(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errors.New("cbor map key is not supported")
+			}
+			value, b, err = cborDecodeDepth(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			entries[key] = value
+		}
+		return entries, b, nil
+	case 6:
+		// tags only add meaning to the value that follows
+		return cborDecodeDepth(b, depth+1)
+	}
+
+	return nil, nil, errors.New("cbor major type is not valid")
+}
+
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exponent := uint32(h>>10) & 0x1f
+	fraction := uint32(h) & 0x3ff
+
+	switch {
+	case exponent == 0 && fraction == 0:
+		return math.Float32frombits(sign)
+	case exponent == 0:
+		// subnormal, value is fraction * 2^-24
+		value := float32(fraction) / (1 << 24)
+		if sign != 0 {
+			return -value
+		}
+		return value
+	case exponent == 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | fraction<<13)
+	}
+
+	return math.Float32frombits(sign | (exponent+112)<<23 | fraction<<13)
+}
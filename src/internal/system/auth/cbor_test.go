@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCborDecode(t *testing.T) {
+	// examples from rfc 8949 appendix a
+	tests := []struct {
+		encoded string
+		want    any
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1a000f4240", int64(1000000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"3863", int64(-100)},
+		{"3903e7", int64(-1000)},
+		{"f90000", float64(0)},
+		{"f93c00", float64(1)},
+		{"f93e00", float64(1.5)},
+		{"f97bff", float64(65504)},
+		{"f90001", float64(5.960464477539063e-8)},
+		{"f90400", float64(6.103515625e-5)},
+		{"f9c400", float64(-4)},
+		{"f97c00", math.Inf(1)},
+		{"fa47c35000", float64(100000)},
+		{"fb3ff199999999999a", float64(1.1)},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"40", []byte{}},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"60", ""},
+		{"6161", "a"},
+		{"6449455446", "IETF"},
+		{"62c3bc", "ü"},
+		{"80", []any{}},
+		{"83010203", []any{int64(1), int64(2), int64(3)}},
+		{"8301820203820405", []any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}}},
+		{"a0", map[any]any{}},
+		{"a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{"c074323031332d30332d32315432303a30343a30305a", "2013-03-21T20:04:00Z"},
+		{"d82076687474703a2f2f7777772e6578616d706c652e636f6d", "http://www.example.com"},
+	}
+
+	for _, test := range tests {
+		encoded, err := hex.DecodeString(test.encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, rest, err := cborDecode(encoded)
+		if err != nil {
+			t.Errorf("cborDecode(%s) failed: %v", test.encoded, err)
+			continue
+		}
+		if len(rest) != 0 {
+			t.Errorf("cborDecode(%s) left %x", test.encoded, rest)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("cborDecode(%s) = %#v, want %#v", test.encoded, got, test.want)
+		}
+	}
+}
+
+func TestCborDecodeReturnsRest(t *testing.T) {
+	got, rest, err := cborDecode([]byte{0x61, 'a', 0x01, 0x02})
+	if err != nil || got != "a" || !bytes.Equal(rest, []byte{0x01, 0x02}) {
+		t.Errorf("cborDecode = %#v, %x, %v, want \"a\", 0102", got, rest, err)
+	}
+}
+
+func TestCborDecodeNegativeZeroAndNaN(t *testing.T) {
+	got, _, err := cborDecode([]byte{0xf9, 0x80, 0x00})
+	if value, ok := got.(float64); err != nil || !ok || value != 0 || !math.Signbit(value) {
+		t.Errorf("cborDecode(f98000) = %#v, %v, want -0", got, err)
+	}
+
+	got, _, err = cborDecode([]byte{0xf9, 0x7e, 0x00})
+	if value, ok := got.(float64); err != nil || !ok || !math.IsNaN(value) {
+		t.Errorf("cborDecode(f97e00) = %#v, %v, want NaN", got, err)
+	}
+}
+
+func TestCborDecodeRejectsMalformed(t *testing.T) {
+	tests := map[string]string{
+		"empty":                     "",
+		"truncated argument":        "19e8",
+		"truncated byte string":     "44010203",
+		"truncated text string":     "64494554",
+		"truncated array":           "830102",
+		"truncated map value":       "a20102",
+		"array longer than input":   "9a0000ffff",
+		"map longer than input":     "ba0000ffff",
+		"unsigned too large":        "1bffffffffffffffff",
+		"negative too large":        "3bffffffffffffffff",
+		"indefinite byte string":    "5f42010243030405ff",
+		"indefinite array":          "9f018202039f0405ffff",
+		"reserved additional value": "1c",
+		"unsupported simple value":  "e0",
+		"byte string map key":       "a1420102 01",
+		"array map key":             "a18001",
+		"truncated half float":      "f93c",
+		"truncated double":          "fb3ff1999999",
+	}
+
+	for name, encodedHex := range tests {
+		encoded, err := hex.DecodeString(strings.ReplaceAll(encodedHex, " ", ""))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		got, _, err := cborDecode(encoded)
+		if err == nil {
+			t.Errorf("%s: cborDecode(%s) = %#v, want error", name, encodedHex, got)
+		}
+	}
+}
+
+func TestCborDecodeRejectsDeepNesting(t *testing.T) {
+	nested := append(bytes.Repeat([]byte{0x81}, cborMaxDepth+1), 0x00)
+	_, _, err := cborDecode(nested)
+	if err == nil {
+		t.Error("cborDecode accepted arrays nested past the maximum depth")
+	}
+
+	nested = append(bytes.Repeat([]byte{0x81}, cborMaxDepth), 0x00)
+	_, _, err = cborDecode(nested)
+	if err != nil {
+		t.Errorf("cborDecode rejected arrays nested to the maximum depth: %v", err)
+	}
+}
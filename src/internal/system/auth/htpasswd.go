@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const bcryptCost int = 12
+
+// web only passwords stored as bcrypt hashes, one 'username:hash' entry per line
+type htpasswdAuthenticator struct {
+	filePath string
+	mutex    *sync.Mutex
+}
+
+func newHtpasswdAuthenticator(filePath string) (Authenticator, error) {
+	if filePath == "" {
+		return nil, errors.New("htpasswd file not provided")
+	}
+
+	if !path.IsAbs(filePath) {
+		return nil, errors.New("htpasswd file path is not absolute")
+	}
+
+	htpasswd := htpasswdAuthenticator{
+		filePath: filePath,
+		mutex:    &sync.Mutex{},
+	}
+
+	_, err := htpasswd.readEntries()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Join(errors.New("failed to read htpasswd file"), err)
+	}
+
+	return htpasswd, nil
+}
+
+func (htpasswd htpasswdAuthenticator) Authenticate(username string, password string) error {
+	htpasswd.mutex.Lock()
+	entries, err := htpasswd.readEntries()
+	htpasswd.mutex.Unlock()
+	if err != nil {
+		return errors.Join(errors.New("failed to read htpasswd file"), err)
+	}
+
+	hash, ok := entries[username]
+	if !ok {
+		return errors.New("user not found in htpasswd file")
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		return errors.Join(errors.New("failed to compare password"), err)
+	}
+
+	return nil
+}
+
+func (htpasswd htpasswdAuthenticator) SetPassword(username string, password string) error {
+	if strings.Contains(username, ":") {
+		return errors.New("username is not valid")
+	}
+
+	if len(password) > 72 {
+		return errors.New("password is longer than 72 bytes")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return errors.Join(errors.New("failed to hash password"), err)
+	}
+
+	htpasswd.mutex.Lock()
+	defer htpasswd.mutex.Unlock()
+
+	lines, err := htpasswd.readLines()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Join(errors.New("failed to read htpasswd file"), err)
+	}
+
+	found := false
+	for i, line := range lines {
+		if entryUsername, _, ok := strings.Cut(line, ":"); ok && entryUsername == username {
+			lines[i] = username + ":" + string(hash)
+			found = true
+		}
+	}
+
+	if !found {
+		lines = append(lines, username+":"+string(hash))
+	}
+
+	err = os.MkdirAll(path.Dir(htpasswd.filePath), 0755)
+	if err != nil {
+		return errors.Join(errors.New("failed to create htpasswd directory"), err)
+	}
+
+	// write to a temporary file first so a failed write never loses every password
+	tempFilePath := htpasswd.filePath + ".tmp"
+	err = os.WriteFile(tempFilePath, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	if err != nil {
+		return errors.Join(errors.New("failed to write htpasswd file"), err)
+	}
+
+	err = os.Rename(tempFilePath, htpasswd.filePath)
+	if err != nil {
+		return errors.Join(errors.New("failed to replace htpasswd file"), err)
+	}
+
+	return nil
+}
+
+func (htpasswd htpasswdAuthenticator) readEntries() (map[string]string, error) {
+	lines, err := htpasswd.readLines()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]string)
+	for _, line := range lines {
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(username, "#") {
+			continue
+		}
+		entries[username] = hash
+	}
+
+	return entries, nil
+}
+
+func (htpasswd htpasswdAuthenticator) readLines() ([]string, error) {
+	file, err := os.Open(htpasswd.filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Join(errors.New("failed to scan file"), err)
+	}
+
+	return lines, nil
+}
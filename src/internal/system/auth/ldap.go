@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"crypto/tls"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const ldapTimeout time.Duration = 10 * time.Second
+const ldapResultSuccess int = 0
+const berTagInteger byte = 0x02
+const berTagOctetString byte = 0x04
+const berTagEnumerated byte = 0x0a
+const berTagSequence byte = 0x30
+const ldapTagBindResponse byte = 0x61
+const ldapMaxResponseLength int = 1 << 16
+
+// verifies passwords with an ldap simple bind as the user's dn
+type ldapAuthenticator struct {
+	address string
+	useTls  bool
+	host    string
+	userDn  string
+}
+
+type ldapBindRequest struct {
+	Version  int
+	Name     []byte
+	Password []byte `asn1:"tag:0"`
+}
+
+type ldapBindRequestMessage struct {
+	MessageId   int
+	BindRequest ldapBindRequest `asn1:"application,tag:0"`
+}
+
+func newLdapAuthenticator(ldapUrl string, userDn string) (Authenticator, error) {
+	parsedUrl, err := url.Parse(ldapUrl)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to parse ldap url"), err)
+	}
+
+	ldap := ldapAuthenticator{
+		host:   parsedUrl.Hostname(),
+		userDn: userDn,
+	}
+
+	port := parsedUrl.Port()
+	switch parsedUrl.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+	case "ldaps":
+		ldap.useTls = true
+		if port == "" {
+			port = "636"
+		}
+	default:
+		return nil, errors.New("ldap url scheme must be ldap or ldaps")
+	}
+
+	if ldap.host == "" {
+		return nil, errors.New("ldap url host not provided")
+	}
+	ldap.address = net.JoinHostPort(ldap.host, port)
+
+	if strings.Count(userDn, "%s") != 1 {
+		return nil, errors.New("ldap user dn must contain a single '%s' for the username")
+	}
+
+	return ldap, nil
+}
+
+func (ldap ldapAuthenticator) Authenticate(username string, password string) error {
+	// an empty password is an unauthenticated bind, which always succeeds
+	if password == "" {
+		return errors.New("password not provided")
+	}
+
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+	var conn net.Conn
+	var err error
+	if ldap.useTls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", ldap.address, &tls.Config{ServerName: ldap.host})
+	} else {
+		conn, err = dialer.Dial("tcp", ldap.address)
+	}
+	if err != nil {
+		return errors.Join(errors.New("failed to connect to ldap server"), err)
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(ldapTimeout))
+	if err != nil {
+		return errors.Join(errors.New("failed to set deadline"), err)
+	}
+
+	request, err := asn1.Marshal(ldapBindRequestMessage{
+		MessageId: 1,
+		BindRequest: ldapBindRequest{
+			Version:  3,
+			Name:     []byte(fmt.Sprintf(ldap.userDn, escapeLdapDnValue(username))),
+			Password: []byte(password),
+		},
+	})
+	if err != nil {
+		return errors.Join(errors.New("failed to encode bind request"), err)
+	}
+
+	_, err = conn.Write(request)
+	if err != nil {
+		return errors.Join(errors.New("failed to send bind request"), err)
+	}
+
+	responseBytes, err := readLdapMessage(conn)
+	if err != nil {
+		return errors.Join(errors.New("failed to read bind response"), err)
+	}
+
+	messageId, resultCode, diagnosticMessage, err := parseLdapBindResponse(responseBytes)
+	if err != nil {
+		return errors.Join(errors.New("failed to decode bind response"), err)
+	}
+
+	if messageId != 1 {
+		return errors.New("bind response message id does not match")
+	}
+
+	if resultCode != ldapResultSuccess {
+		return fmt.Errorf("bind failed with result code %d: %s", resultCode, diagnosticMessage)
+	}
+
+	return nil
+}
+
+func (ldap ldapAuthenticator) SetPassword(username string, password string) error {
+	return ErrPasswordNotSettable
+}
+
+// reads a single ber encoded message, the outer length decides how much to read
+func readLdapMessage(reader io.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if header[0] != berTagSequence {
+		return nil, fmt.Errorf("tag is 0x%02x instead of 0x%02x", header[0], berTagSequence)
+	}
+
+	length := int(header[1])
+	if header[1]&0x80 != 0 {
+		lengthBytes := make([]byte, header[1]&0x7f)
+		if len(lengthBytes) == 0 || len(lengthBytes) > 4 {
+			return nil, errors.New("message length is not supported")
+		}
+
+		_, err = io.ReadFull(reader, lengthBytes)
+		if err != nil {
+			return nil, err
+		}
+		header = append(header, lengthBytes...)
+
+		length = 0
+		for _, b := range lengthBytes {
+			length = length<<8 | int(b)
+		}
+	}
+
+	if length > ldapMaxResponseLength {
+		return nil, errors.New("message is too long")
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(reader, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(header, body...), nil
+}
+
+// servers send ber, which encoding/asn1 rejects when lengths are not minimal, so responses are parsed by hand
+func parseLdapBindResponse(message []byte) (int, int, string, error) {
+	content, _, err := readBerElement(message, berTagSequence)
+	if err != nil {
+		return 0, 0, "", errors.Join(errors.New("failed to read message"), err)
+	}
+
+	messageIdBytes, content, err := readBerElement(content, berTagInteger)
+	if err != nil {
+		return 0, 0, "", errors.Join(errors.New("failed to read message id"), err)
+	}
+
+	bindResponse, _, err := readBerElement(content, ldapTagBindResponse)
+	if err != nil {
+		return 0, 0, "", errors.Join(errors.New("failed to read bind response"), err)
+	}
+
+	resultCodeBytes, bindResponse, err := readBerElement(bindResponse, berTagEnumerated)
+	if err != nil {
+		return 0, 0, "", errors.Join(errors.New("failed to read result code"), err)
+	}
+
+	_, bindResponse, err = readBerElement(bindResponse, berTagOctetString)
+	if err != nil {
+		return 0, 0, "", errors.Join(errors.New("failed to read matched dn"), err)
+	}
+
+	diagnosticMessage, _, err := readBerElement(bindResponse, berTagOctetString)
+	if err != nil {
+		return 0, 0, "", errors.Join(errors.New("failed to read diagnostic message"), err)
+	}
+
+	messageId, err := parseBerInteger(messageIdBytes)
+	if err != nil {
+		return 0, 0, "", errors.Join(errors.New("failed to parse message id"), err)
+	}
+
+	resultCode, err := parseBerInteger(resultCodeBytes)
+	if err != nil {
+		return 0, 0, "", errors.Join(errors.New("failed to parse result code"), err)
+	}
+
+	return messageId, resultCode, string(diagnosticMessage), nil
+}
+
+// returns the content of the element with the expected tag and the bytes after it
+func readBerElement(b []byte, tag byte) ([]byte, []byte, error) {
+	if len(b) < 2 {
+		return nil, nil, errors.New("element is truncated")
+	}
+
+	if b[0] != tag {
+		return nil, nil, fmt.Errorf("tag is 0x%02x instead of 0x%02x", b[0], tag)
+	}
+
+	length := int(b[1])
+	offset := 2
+	if b[1]&0x80 != 0 {
+		lengthByteCount := int(b[1] & 0x7f)
+		if lengthByteCount == 0 || lengthByteCount > 4 || len(b) < offset+lengthByteCount {
+			return nil, nil, errors.New("element length is not valid")
+		}
+
+		length = 0
+		for _, lengthByte := range b[offset : offset+lengthByteCount] {
+			length = length<<8 | int(lengthByte)
+		}
+		offset += lengthByteCount
+	}
+
+	if length < 0 || len(b) < offset+length {
+		return nil, nil, errors.New("element is truncated")
+	}
+
+	return b[offset : offset+length], b[offset+length:], nil
+}
+
+// message ids and result codes fit in 4 bytes, anything longer is not a valid response
+func parseBerInteger(b []byte) (int, error) {
+	if len(b) == 0 || len(b) > 4 {
+		return 0, errors.New("integer length is not valid")
+	}
+
+	value := 0
+	for i, valueByte := range b {
+		if i == 0 && valueByte&0x80 != 0 {
+			value = -1
+		}
+		value = value<<8 | int(valueByte)
+	}
+	return value, nil
+}
+
+// escapes the special characters of rfc 4514 so a username cannot change the dn
+func escapeLdapDnValue(value string) string {
+	var escaped strings.Builder
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(",+\"\\<>;=", r),
+			i == 0 && (r == ' ' || r == '#'),
+			i == len(value)-1 && r == ' ':
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
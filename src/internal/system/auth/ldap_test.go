@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"net"
+	"testing"
+)
+
+func TestEscapeLdapDnValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"alice", "alice"},
+		{"al,ice", `al\,ice`},
+		{"a+b", `a\+b`},
+		{`a"b`, `a\"b`},
+		{`a\b`, `a\\b`},
+		{"a<b>c", `a\<b\>c`},
+		{"a;b", `a\;b`},
+		{"a=b", `a\=b`},
+		{" alice", `\ alice`},
+		{"alice ", `alice\ `},
+		{"al ice", "al ice"},
+		{"#alice", `\#alice`},
+		{"al#ice", "al#ice"},
+		{"admin,ou=admins", `admin\,ou\=admins`},
+	}
+
+	for _, test := range tests {
+		got := escapeLdapDnValue(test.value)
+		if got != test.want {
+			t.Errorf("escapeLdapDnValue(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+// answers each connection with a single bind response, recording the bind request it received
+func startFakeLdapServer(t *testing.T, response func(request ldapBindRequestMessage) []byte) (string, <-chan ldapBindRequestMessage) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	requests := make(chan ldapBindRequestMessage, 16)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			requestBytes, err := readLdapMessage(conn)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+
+			var request ldapBindRequestMessage
+			_, err = asn1.UnmarshalWithParams(requestBytes, &request, "")
+			if err != nil {
+				conn.Close()
+				continue
+			}
+
+			requests <- request
+			conn.Write(response(request))
+			conn.Close()
+		}
+	}()
+
+	return "ldap://" + listener.Addr().String(), requests
+}
+
+// builds a bind response the way servers send it, with a long form length on the outer sequence
+func ldapBindResponse(messageId int, resultCode int, diagnosticMessage string) []byte {
+	bindResponse := []byte{berTagEnumerated, 0x01, byte(resultCode), berTagOctetString, 0x00, berTagOctetString, byte(len(diagnosticMessage))}
+	bindResponse = append(bindResponse, diagnosticMessage...)
+
+	content := []byte{berTagInteger, 0x01, byte(messageId), ldapTagBindResponse, byte(len(bindResponse))}
+	content = append(content, bindResponse...)
+
+	return append([]byte{berTagSequence, 0x81, byte(len(content))}, content...)
+}
+
+func TestLdapAuthenticate(t *testing.T) {
+	ldapUrl, requests := startFakeLdapServer(t, func(request ldapBindRequestMessage) []byte {
+		if string(request.BindRequest.Password) == "right" {
+			return ldapBindResponse(request.MessageId, ldapResultSuccess, "")
+		}
+		// invalidCredentials
+		return ldapBindResponse(request.MessageId, 49, "80090308: LdapErr: DSID-0C09044E")
+	})
+
+	authenticator, err := newLdapAuthenticator(ldapUrl, "uid=%s,ou=people,dc=example,dc=com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = authenticator.Authenticate("alice", "right")
+	if err != nil {
+		t.Errorf("Authenticate with the right password failed: %v", err)
+	}
+
+	request := <-requests
+	if request.BindRequest.Version != 3 {
+		t.Errorf("bind request version = %d, want 3", request.BindRequest.Version)
+	}
+	if dn := string(request.BindRequest.Name); dn != "uid=alice,ou=people,dc=example,dc=com" {
+		t.Errorf("bind request dn = %q", dn)
+	}
+
+	err = authenticator.Authenticate("alice", "wrong")
+	if err == nil {
+		t.Error("Authenticate with the wrong password succeeded")
+	}
+	<-requests
+
+	err = authenticator.Authenticate("mallory,ou=admins", "right")
+	if err != nil {
+		t.Errorf("Authenticate with an escaped username failed: %v", err)
+	}
+	request = <-requests
+	if dn := string(request.BindRequest.Name); dn != `uid=mallory\,ou\=admins,ou=people,dc=example,dc=com` {
+		t.Errorf("bind request dn = %q, want the username escaped", dn)
+	}
+}
+
+func TestLdapAuthenticateRejectsEmptyPassword(t *testing.T) {
+	ldapUrl, requests := startFakeLdapServer(t, func(request ldapBindRequestMessage) []byte {
+		return ldapBindResponse(request.MessageId, ldapResultSuccess, "")
+	})
+
+	authenticator, err := newLdapAuthenticator(ldapUrl, "uid=%s,dc=example,dc=com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = authenticator.Authenticate("alice", "")
+	if err == nil {
+		t.Error("Authenticate with an empty password succeeded")
+	}
+
+	select {
+	case <-requests:
+		t.Error("an unauthenticated bind was sent to the server")
+	default:
+	}
+}
+
+func TestLdapAuthenticateRejectsMismatchedMessageId(t *testing.T) {
+	ldapUrl, _ := startFakeLdapServer(t, func(request ldapBindRequestMessage) []byte {
+		return ldapBindResponse(request.MessageId+1, ldapResultSuccess, "")
+	})
+
+	authenticator, err := newLdapAuthenticator(ldapUrl, "uid=%s,dc=example,dc=com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = authenticator.Authenticate("alice", "right")
+	if err == nil {
+		t.Error("Authenticate accepted a response to another message")
+	}
+}
+
+func FuzzReadLdapMessage(f *testing.F) {
+	f.Add(ldapBindResponse(1, 0, ""))
+	f.Add(ldapBindResponse(2, 49, "invalid credentials"))
+	f.Add([]byte{berTagSequence, 0x84, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{berTagSequence, 0x80})
+	f.Add([]byte{berTagSequence, 0x05, 0x01})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		message, err := readLdapMessage(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		if len(message) > len(data) {
+			t.Fatalf("read %d bytes from %d bytes of input", len(message), len(data))
+		}
+
+		if !bytes.Equal(message, data[:len(message)]) {
+			t.Fatal("message is not a prefix of the input")
+		}
+	})
+}
+
+func FuzzParseLdapBindResponse(f *testing.F) {
+	f.Add(ldapBindResponse(1, 0, ""))
+	f.Add(ldapBindResponse(2, 49, "invalid credentials"))
+	f.Add([]byte{berTagSequence, 0x03, berTagInteger, 0x01, 0x01})
+	f.Add([]byte{berTagSequence, 0x84, 0x7f, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _, diagnosticMessage, err := parseLdapBindResponse(data)
+		if err != nil {
+			return
+		}
+
+		if len(diagnosticMessage) > len(data) {
+			t.Fatalf("diagnostic message of %d bytes from %d bytes of input", len(diagnosticMessage), len(data))
+		}
+	})
+}
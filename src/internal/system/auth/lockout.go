@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const loginFailuresFilePath string = "/etc/ground/login-failures.json"
+const loginFailureExpiry time.Duration = 24 * time.Hour
+const loginFailuresMax int = 10000
+const loginBackoffBase time.Duration = time.Second
+const ipFreeLoginFailures int = 5
+const userFreeLoginFailures int = 3
+const loginFailuresSaveDelay time.Duration = 5 * time.Second
+
+var loginFailureMutex sync.Mutex
+
+// held for a whole save so snapshots are written in the order they were taken
+var loginFailuresSaveMutex sync.Mutex
+
+// pending write of the failures, guarded by the failure mutex
+var loginFailuresSaveTimer *time.Timer
+
+// guarded by the failure mutex
+var loginThrottle LoginThrottle = LoginThrottle{
+	BackoffMax:      15 * time.Minute,
+	LockoutFailures: 10,
+	LockoutDuration: 30 * time.Minute,
+}
+
+type LoginThrottle struct {
+	BackoffMax      time.Duration
+	LockoutFailures uint
+	LockoutDuration time.Duration
+}
+
+// keyed by "ip/<address>" and "user/<username>"
+var loginFailures map[string]loginFailure = make(map[string]loginFailure)
+
+type loginFailure struct {
+	Count        int       `json:"count"`
+	LastFailure  time.Time `json:"lastFailure"`
+	BlockedUntil time.Time `json:"blockedUntil"`
+}
+
+func ValidateLoginThrottle(throttle LoginThrottle) error {
+	if throttle.BackoffMax < loginBackoffBase {
+		return fmt.Errorf("login backoff max must be at least %s", loginBackoffBase)
+	}
+
+	if throttle.LockoutFailures <= uint(userFreeLoginFailures) {
+		return fmt.Errorf("account lockout failures must be more than %d", userFreeLoginFailures)
+	}
+
+	if throttle.LockoutDuration < time.Minute {
+		return errors.New("account lockout duration must be at least a minute")
+	}
+
+	return nil
+}
+
+func SetupLoginThrottle(throttle LoginThrottle) error {
+	err := ValidateLoginThrottle(throttle)
+	if err != nil {
+		return err
+	}
+
+	loginFailureMutex.Lock()
+	defer loginFailureMutex.Unlock()
+
+	loginThrottle = throttle
+	return nil
+}
+
+// loads failures recorded before a restart, so restarting does not reset the lockouts
+func LoadLoginFailures() error {
+	loginFailureMutex.Lock()
+	defer loginFailureMutex.Unlock()
+
+	content, err := os.ReadFile(loginFailuresFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return errors.Join(errors.New("failed to read login failures"), err)
+	}
+
+	failures := make(map[string]loginFailure)
+	err = json.Unmarshal(content, &failures)
+	if err != nil {
+		return errors.Join(errors.New("failed to parse login failures"), err)
+	}
+
+	loginFailures = failures
+	pruneLoginFailures(time.Now())
+
+	return nil
+}
+
+// returns how long the client has to wait before trying again, the username may be empty
+func LoginRetryAfter(ip string, username string) (time.Duration, bool) {
+	loginFailureMutex.Lock()
+	defer loginFailureMutex.Unlock()
+
+	now := time.Now()
+	retryAfter := time.Duration(0)
+	for _, key := range loginFailureKeys(ip, username) {
+		if failure, ok := loginFailures[key]; ok && failure.BlockedUntil.After(now) {
+			retryAfter = max(retryAfter, failure.BlockedUntil.Sub(now))
+		}
+	}
+
+	return retryAfter, retryAfter > 0
+}
+
+// counts a failed attempt against the address and the user, an empty username only counts against the address
+func RecordLoginFailure(ip string, username string) {
+	loginFailureMutex.Lock()
+	defer loginFailureMutex.Unlock()
+
+	now := time.Now()
+	for _, key := range loginFailureKeys(ip, username) {
+		failure, ok := loginFailures[key]
+		if !ok && len(loginFailures) >= loginFailuresMax {
+			pruneLoginFailures(now)
+			if len(loginFailures) >= loginFailuresMax {
+				evictOldestLoginFailure()
+			}
+		}
+
+		// a served lockout or a long quiet spell starts the count over
+		if loginFailureIsStale(failure, now) || (failure.Count >= int(loginThrottle.LockoutFailures) && !failure.BlockedUntil.After(now)) {
+			failure = loginFailure{}
+		}
+
+		failure.Count++
+		failure.LastFailure = now
+
+		freeFailures := ipFreeLoginFailures
+		if strings.HasPrefix(key, "user/") {
+			freeFailures = userFreeLoginFailures
+			if failure.Count >= int(loginThrottle.LockoutFailures) {
+				failure.BlockedUntil = now.Add(loginThrottle.LockoutDuration)
+				loginFailures[key] = failure
+				continue
+			}
+		}
+
+		if failure.Count > freeFailures {
+			failure.BlockedUntil = now.Add(getLoginBackoff(failure.Count - freeFailures))
+		}
+		loginFailures[key] = failure
+	}
+
+	scheduleLoginFailuresSave()
+}
+
+// a completed login clears the user's failures, the address keeps its own so one account cannot reset them
+func RecordLoginSuccess(username string) {
+	loginFailureMutex.Lock()
+	defer loginFailureMutex.Unlock()
+
+	if _, ok := loginFailures["user/"+username]; !ok {
+		return
+	}
+
+	delete(loginFailures, "user/"+username)
+	scheduleLoginFailuresSave()
+}
+
+func AccountLockedUntil(username string) (time.Time, bool) {
+	loginFailureMutex.Lock()
+	defer loginFailureMutex.Unlock()
+
+	failure, ok := loginFailures["user/"+username]
+	if !ok || failure.Count < int(loginThrottle.LockoutFailures) || !failure.BlockedUntil.After(time.Now()) {
+		return time.Time{}, false
+	}
+
+	return failure.BlockedUntil, true
+}
+
+func UnlockAccount(username string) error {
+	loginFailureMutex.Lock()
+	_, ok := loginFailures["user/"+username]
+	delete(loginFailures, "user/"+username)
+	loginFailureMutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return saveLoginFailures()
+}
+
+// drops failures that are old enough to no longer matter
+func PruneLoginFailures() error {
+	loginFailureMutex.Lock()
+	count := len(loginFailures)
+	pruneLoginFailures(time.Now())
+	pruned := len(loginFailures) != count
+	loginFailureMutex.Unlock()
+
+	if !pruned {
+		return nil
+	}
+
+	return saveLoginFailures()
+}
+
+// writes a pending save right away, for when the server stops
+func FlushLoginFailures() error {
+	loginFailureMutex.Lock()
+	pending := loginFailuresSaveTimer != nil && loginFailuresSaveTimer.Stop()
+	loginFailuresSaveTimer = nil
+	loginFailureMutex.Unlock()
+
+	if !pending {
+		return nil
+	}
+
+	return saveLoginFailures()
+}
+
+func loginFailureKeys(ip string, username string) []string {
+	keys := []string{"ip/" + ip}
+	if username != "" {
+		keys = append(keys, "user/"+username)
+	}
+	return keys
+}
+
+// doubles with every failure over the free ones, up to the max
+func getLoginBackoff(excessFailures int) time.Duration {
+	backoff := loginBackoffBase
+	for range excessFailures - 1 {
+		backoff *= 2
+		if backoff >= loginThrottle.BackoffMax {
+			return loginThrottle.BackoffMax
+		}
+	}
+	return min(backoff, loginThrottle.BackoffMax)
+}
+
+func pruneLoginFailures(now time.Time) {
+	for key, failure := range loginFailures {
+		if loginFailureIsStale(failure, now) {
+			delete(loginFailures, key)
+		}
+	}
+}
+
+func loginFailureIsStale(failure loginFailure, now time.Time) bool {
+	return now.Sub(failure.LastFailure) > loginFailureExpiry && !failure.BlockedUntil.After(now)
+}
+
+func evictOldestLoginFailure() {
+	oldestKey := ""
+	var oldest time.Time
+	for key, failure := range loginFailures {
+		if oldestKey == "" || failure.LastFailure.Before(oldest) {
+			oldestKey = key
+			oldest = failure.LastFailure
+		}
+	}
+	delete(loginFailures, oldestKey)
+}
+
+// failures come in bursts, so they are written at most once per delay instead of on every attempt
+func scheduleLoginFailuresSave() {
+	if loginFailuresSaveTimer != nil {
+		return
+	}
+
+	loginFailuresSaveTimer = time.AfterFunc(loginFailuresSaveDelay, func() {
+		loginFailureMutex.Lock()
+		loginFailuresSaveTimer = nil
+		loginFailureMutex.Unlock()
+
+		err := saveLoginFailures()
+		if err != nil {
+			slog.Error("failed to save login failures", "error", err)
+		}
+	})
+}
+
+// must be called without the failure mutex, which is only held while taking the snapshot
+func saveLoginFailures() error {
+	loginFailuresSaveMutex.Lock()
+	defer loginFailuresSaveMutex.Unlock()
+
+	loginFailureMutex.Lock()
+	content, err := json.Marshal(loginFailures)
+	loginFailureMutex.Unlock()
+	if err != nil {
+		return errors.Join(errors.New("failed to encode login failures"), err)
+	}
+
+	err = os.MkdirAll(path.Dir(loginFailuresFilePath), 0755)
+	if err != nil {
+		return errors.Join(errors.New("failed to create directory"), err)
+	}
+
+	tempFilePath := loginFailuresFilePath + ".tmp"
+	err = os.WriteFile(tempFilePath, content, 0600)
+	if err != nil {
+		return errors.Join(errors.New("failed to write login failures"), err)
+	}
+
+	err = os.Rename(tempFilePath, loginFailuresFilePath)
+	if err != nil {
+		return errors.Join(errors.New("failed to replace login failures"), err)
+	}
+
+	return nil
+}
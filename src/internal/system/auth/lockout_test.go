@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func resetLoginFailures(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		loginFailureMutex.Lock()
+		defer loginFailureMutex.Unlock()
+		if loginFailuresSaveTimer != nil {
+			loginFailuresSaveTimer.Stop()
+			loginFailuresSaveTimer = nil
+		}
+		loginFailures = make(map[string]loginFailure)
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestRecordLoginFailureLocksAccount(t *testing.T) {
+	resetLoginFailures(t)
+
+	for i := range int(loginThrottle.LockoutFailures) {
+		// a different address each time, so only the user count adds up
+		RecordLoginFailure(fmt.Sprintf("192.0.2.%d", i+1), "alice")
+	}
+
+	_, locked := AccountLockedUntil("alice")
+	if !locked {
+		t.Fatal("account is not locked after the lockout failures")
+	}
+
+	if loginFailuresSaveTimer == nil {
+		t.Error("failures were not scheduled to be saved")
+	}
+}
+
+func TestRecordLoginFailureResetsCountAfterLockout(t *testing.T) {
+	resetLoginFailures(t)
+
+	now := time.Now()
+	loginFailures["user/alice"] = loginFailure{
+		Count:        int(loginThrottle.LockoutFailures),
+		LastFailure:  now.Add(-loginThrottle.LockoutDuration - time.Second),
+		BlockedUntil: now.Add(-time.Second),
+	}
+
+	RecordLoginFailure("192.0.2.1", "alice")
+
+	failure := loginFailures["user/alice"]
+	if failure.Count != 1 {
+		t.Errorf("count after a served lockout = %d, want 1", failure.Count)
+	}
+
+	_, locked := AccountLockedUntil("alice")
+	if locked {
+		t.Error("a single failure after a served lockout locked the account again")
+	}
+}
+
+func TestRecordLoginFailureKeepsCountDuringBackoff(t *testing.T) {
+	resetLoginFailures(t)
+
+	now := time.Now()
+	loginFailures["ip/192.0.2.1"] = loginFailure{
+		Count:        ipFreeLoginFailures + 2,
+		LastFailure:  now.Add(-time.Minute),
+		BlockedUntil: now.Add(-time.Second),
+	}
+
+	RecordLoginFailure("192.0.2.1", "")
+
+	failure := loginFailures["ip/192.0.2.1"]
+	if failure.Count != ipFreeLoginFailures+3 {
+		t.Errorf("count after a served backoff = %d, want %d", failure.Count, ipFreeLoginFailures+3)
+	}
+
+	if want := getLoginBackoff(3); failure.BlockedUntil.Sub(failure.LastFailure) != want {
+		t.Errorf("backoff = %s, want %s", failure.BlockedUntil.Sub(failure.LastFailure), want)
+	}
+}
+
+func TestRecordLoginFailureResetsStaleCount(t *testing.T) {
+	resetLoginFailures(t)
+
+	loginFailures["ip/192.0.2.1"] = loginFailure{
+		Count:       ipFreeLoginFailures + 5,
+		LastFailure: time.Now().Add(-loginFailureExpiry - time.Minute),
+	}
+
+	RecordLoginFailure("192.0.2.1", "")
+
+	failure := loginFailures["ip/192.0.2.1"]
+	if failure.Count != 1 || !failure.BlockedUntil.IsZero() {
+		t.Errorf("failure after a day without any = %+v, want a fresh count", failure)
+	}
+}
@@ -0,0 +1,124 @@
+//go:build pam
+
+package auth
+
+/*
+#cgo LDFLAGS: -lpam
+#include <security/pam_appl.h>
+#include <stdlib.h>
+#include <string.h>
+
+static int ground_pam_conv(int count, const struct pam_message **messages, struct pam_response **responses, void *password) {
+	struct pam_response *replies = calloc(count, sizeof(struct pam_response));
+	if (replies == NULL) {
+		return PAM_BUF_ERR;
+	}
+
+	for (int i = 0; i < count; i++) {
+		switch (messages[i]->msg_style) {
+		case PAM_PROMPT_ECHO_OFF:
+		case PAM_PROMPT_ECHO_ON:
+			replies[i].resp = strdup((const char *)password);
+			if (replies[i].resp == NULL) {
+				for (int j = 0; j < i; j++) {
+					free(replies[j].resp);
+				}
+				free(replies);
+				return PAM_BUF_ERR;
+			}
+			break;
+		case PAM_ERROR_MSG:
+		case PAM_TEXT_INFO:
+			break;
+		default:
+			for (int j = 0; j < i; j++) {
+				free(replies[j].resp);
+			}
+			free(replies);
+			return PAM_CONV_ERR;
+		}
+	}
+
+	*responses = replies;
+	return PAM_SUCCESS;
+}
+
+static int ground_pam_authenticate(const char *service, const char *username, const char *password) {
+	struct pam_conv conv = { ground_pam_conv, (void *)password };
+	pam_handle_t *handle = NULL;
+
+	int status = pam_start(service, username, &conv, &handle);
+	if (status != PAM_SUCCESS) {
+		return status;
+	}
+
+	status = pam_authenticate(handle, PAM_SILENT | PAM_DISALLOW_NULL_AUTHTOK);
+	if (status == PAM_SUCCESS) {
+		status = pam_acct_mgmt(handle, PAM_SILENT);
+	}
+
+	pam_end(handle, status);
+	return status;
+}
+
+static const char *ground_pam_strerror(int status) {
+	return pam_strerror(NULL, status);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/grantfbarnes/ground/internal/system/execute"
+)
+
+type pamAuthenticator struct {
+	service string
+}
+
+func newPamAuthenticator(service string) (Authenticator, error) {
+	if service == "" {
+		return nil, errors.New("pam service not provided")
+	}
+
+	return pamAuthenticator{service: service}, nil
+}
+
+func (pam pamAuthenticator) Authenticate(username string, password string) error {
+	cService := C.CString(pam.service)
+	defer C.free(unsafe.Pointer(cService))
+
+	cUsername := C.CString(username)
+	defer C.free(unsafe.Pointer(cUsername))
+
+	cPassword := C.CString(password)
+	defer C.free(unsafe.Pointer(cPassword))
+
+	status := C.ground_pam_authenticate(cService, cUsername, cPassword)
+
+	// an expired password is still a correct password, it is changed through ground
+	if status != C.PAM_SUCCESS && status != C.PAM_NEW_AUTHTOK_REQD {
+		return errors.New(C.GoString(C.ground_pam_strerror(status)))
+	}
+
+	return nil
+}
+
+func (pam pamAuthenticator) SetPassword(username string, password string) error {
+	err := execute.PasswordSet(username, password)
+	if err != nil {
+		return errors.Join(errors.New("failed to set system password"), err)
+	}
+
+	return nil
+}
+
+func (pam pamAuthenticator) ExpirePassword(username string) error {
+	return expireSystemPassword(username)
+}
+
+func (pam pamAuthenticator) PasswordIsExpired(username string) (bool, error) {
+	return systemPasswordIsExpired(username)
+}
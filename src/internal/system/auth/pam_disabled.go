@@ -0,0 +1,9 @@
+//go:build !pam
+
+package auth
+
+import "errors"
+
+func newPamAuthenticator(service string) (Authenticator, error) {
+	return nil, errors.New("ground was built without pam support, rebuild with '-tags pam'")
+}
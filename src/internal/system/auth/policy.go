@@ -0,0 +1,256 @@
+package auth
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const passwordHistoryDirPath string = "/etc/ground/password-history"
+const passwordHistoryMax uint = 24
+const passwordClassCount uint = 4
+
+// bcrypt only reads this much of a password
+const passwordMaxBytes int = 72
+
+//go:embed common-passwords.txt
+var commonPasswordsContent string
+
+var commonPasswords map[string]bool = make(map[string]bool)
+var commonPasswordsOnce sync.Once
+
+// only read through getPasswordPolicy
+var passwordPolicy PasswordPolicy = PasswordPolicy{MinLength: 8, MinClasses: 1}
+var passwordPolicyMutex sync.RWMutex
+
+var passwordHistoryMutex sync.Mutex
+
+type PasswordPolicy struct {
+	MinLength  uint
+	MinClasses uint
+	History    uint
+}
+
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet policy: " + strings.Join(e.Violations, " ")
+}
+
+func ValidatePasswordPolicy(policy PasswordPolicy) error {
+	if policy.MinLength < 1 {
+		return errors.New("minimum length must be at least 1")
+	}
+
+	if policy.MinClasses < 1 || policy.MinClasses > passwordClassCount {
+		return fmt.Errorf("minimum character classes must be between 1 and %d", passwordClassCount)
+	}
+
+	if policy.History > passwordHistoryMax {
+		return fmt.Errorf("password history must be at most %d", passwordHistoryMax)
+	}
+
+	return nil
+}
+
+func SetupPasswordPolicy(policy PasswordPolicy) error {
+	err := ValidatePasswordPolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	commonPasswordsOnce.Do(func() {
+		for line := range strings.Lines(commonPasswordsContent) {
+			line = strings.TrimSpace(line)
+			if line != "" {
+				commonPasswords[strings.ToLower(line)] = true
+			}
+		}
+	})
+
+	passwordPolicyMutex.Lock()
+	passwordPolicy = policy
+	passwordPolicyMutex.Unlock()
+
+	return nil
+}
+
+func getPasswordPolicy() PasswordPolicy {
+	passwordPolicyMutex.RLock()
+	defer passwordPolicyMutex.RUnlock()
+	return passwordPolicy
+}
+
+// human readable rules shown next to password fields
+func PasswordPolicyRequirements() []string {
+	policy := getPasswordPolicy()
+	requirements := []string{fmt.Sprintf("At least %d characters", policy.MinLength)}
+	if policy.MinClasses > 1 {
+		requirements = append(requirements, fmt.Sprintf("At least %d of: lowercase letters, uppercase letters, digits, symbols", policy.MinClasses))
+	}
+	requirements = append(requirements, "Does not contain the username", "Is not a commonly used password")
+	if policy.History > 0 {
+		requirements = append(requirements, fmt.Sprintf("Is not one of the last %d passwords", policy.History))
+	}
+	return requirements
+}
+
+// checks everything except reuse, which only applies when a user chooses their own password
+func ValidatePassword(username string, password string) error {
+	policy := getPasswordPolicy()
+	violations := []string{}
+
+	if uint(len([]rune(password))) < policy.MinLength {
+		violations = append(violations, fmt.Sprintf("Password must be at least %d characters.", policy.MinLength))
+	}
+
+	if len(password) > passwordMaxBytes {
+		violations = append(violations, fmt.Sprintf("Password must be at most %d bytes.", passwordMaxBytes))
+	}
+
+	if countPasswordClasses(password) < policy.MinClasses {
+		violations = append(violations, fmt.Sprintf("Password must use at least %d of: lowercase letters, uppercase letters, digits, symbols.", policy.MinClasses))
+	}
+
+	// very short usernames would match too many passwords by accident
+	if len(username) >= 3 && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		violations = append(violations, "Password must not contain the username.")
+	}
+
+	if commonPasswords[strings.ToLower(password)] {
+		violations = append(violations, "Password is too common.")
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+func countPasswordClasses(password string) uint {
+	var hasLower, hasUpper, hasDigit, hasOther bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasOther = true
+		}
+	}
+
+	var count uint
+	for _, has := range []bool{hasLower, hasUpper, hasDigit, hasOther} {
+		if has {
+			count++
+		}
+	}
+	return count
+}
+
+func checkPasswordHistory(username string, password string) error {
+	policy := getPasswordPolicy()
+
+	if policy.History == 0 {
+		return nil
+	}
+
+	hashes, err := readPasswordHistory(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to read password history"), err)
+	}
+
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return &PasswordPolicyError{Violations: []string{fmt.Sprintf("Password must not be one of the last %d passwords.", policy.History)}}
+		}
+	}
+
+	return nil
+}
+
+// keeps hashes of the newest passwords, only as many as the policy checks
+func addPasswordHistory(username string, password string) error {
+	policy := getPasswordPolicy()
+
+	if policy.History == 0 {
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return errors.Join(errors.New("failed to hash password"), err)
+	}
+
+	hashes, err := readPasswordHistory(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to read password history"), err)
+	}
+
+	hashes = append(hashes, string(hash))
+	if uint(len(hashes)) > policy.History {
+		hashes = hashes[uint(len(hashes))-policy.History:]
+	}
+
+	passwordHistoryMutex.Lock()
+	defer passwordHistoryMutex.Unlock()
+
+	err = os.MkdirAll(passwordHistoryDirPath, 0700)
+	if err != nil {
+		return errors.Join(errors.New("failed to create password history directory"), err)
+	}
+
+	err = os.WriteFile(path.Join(passwordHistoryDirPath, username), []byte(strings.Join(hashes, "\n")+"\n"), 0600)
+	if err != nil {
+		return errors.Join(errors.New("failed to write password history"), err)
+	}
+
+	return nil
+}
+
+func readPasswordHistory(username string) ([]string, error) {
+	passwordHistoryMutex.Lock()
+	defer passwordHistoryMutex.Unlock()
+
+	content, err := os.ReadFile(path.Join(passwordHistoryDirPath, username))
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := []string{}
+	for line := range strings.Lines(string(content)) {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			hashes = append(hashes, line)
+		}
+	}
+	return hashes, nil
+}
+
+func removePasswordHistory(username string) error {
+	passwordHistoryMutex.Lock()
+	defer passwordHistoryMutex.Unlock()
+
+	err := os.Remove(path.Join(passwordHistoryDirPath, username))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
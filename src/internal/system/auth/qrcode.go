@@ -0,0 +1,461 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// minimal qr code encoder, byte mode with medium error correction is all an otpauth uri needs
+
+const qrQuietZone int = 4
+
+type qrVersion struct {
+	ecPerBlock   int
+	blockLengths []int
+	alignment    []int
+}
+
+// medium error correction, versions 1 through 10
+var qrVersions = []qrVersion{
+	{10, []int{16}, nil},
+	{16, []int{28}, []int{6, 18}},
+	{26, []int{44}, []int{6, 22}},
+	{18, []int{32, 32}, []int{6, 26}},
+	{24, []int{43, 43}, []int{6, 30}},
+	{16, []int{27, 27, 27, 27}, []int{6, 34}},
+	{18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	{22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	{22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	{26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+type qrCode struct {
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+func qrCodeSvg(text string) (string, error) {
+	code, err := qrEncode([]byte(text))
+	if err != nil {
+		return "", errors.Join(errors.New("failed to encode qr code"), err)
+	}
+
+	var svgPath strings.Builder
+	for y := range code.size {
+		for x := range code.size {
+			if code.modules[y][x] {
+				fmt.Fprintf(&svgPath, "M%d,%dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+
+	dimension := code.size + qrQuietZone*2
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges"><rect width="100%%" height="100%%" fill="#ffffff"/><path d="%s" fill="#000000"/></svg>`,
+		dimension, dimension, dimension*6, dimension*6, svgPath.String()), nil
+}
+
+func qrEncode(data []byte) (*qrCode, error) {
+	versionNumber := 0
+	for i, version := range qrVersions {
+		countBits := 8
+		if i+1 >= 10 {
+			countBits = 16
+		}
+
+		capacityBits := sum(version.blockLengths) * 8
+		if 4+countBits+len(data)*8 <= capacityBits {
+			versionNumber = i + 1
+			break
+		}
+	}
+
+	if versionNumber == 0 {
+		return nil, errors.New("text is too long for a qr code")
+	}
+	version := qrVersions[versionNumber-1]
+
+	codewords := qrAddErrorCorrection(qrDataCodewords(data, versionNumber, sum(version.blockLengths)), version)
+
+	size := versionNumber*4 + 17
+	code := &qrCode{
+		size:       size,
+		modules:    make([][]bool, size),
+		isFunction: make([][]bool, size),
+	}
+	for i := range size {
+		code.modules[i] = make([]bool, size)
+		code.isFunction[i] = make([]bool, size)
+	}
+
+	code.drawFunctionPatterns(versionNumber, version.alignment)
+	code.drawCodewords(codewords)
+
+	bestMask := 0
+	bestPenalty := -1
+	for mask := range 8 {
+		code.applyMask(mask)
+		code.drawFormatBits(mask)
+		penalty := code.penalty()
+		if bestPenalty < 0 || penalty < bestPenalty {
+			bestMask = mask
+			bestPenalty = penalty
+		}
+		// masks are xor, applying again removes it
+		code.applyMask(mask)
+	}
+
+	code.applyMask(bestMask)
+	code.drawFormatBits(bestMask)
+
+	return code, nil
+}
+
+func qrDataCodewords(data []byte, versionNumber int, dataLength int) []byte {
+	var bits []bool
+	appendBits := func(value int, length int) {
+		for i := length - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 == 1)
+		}
+	}
+
+	// byte mode indicator and character count
+	appendBits(0b0100, 4)
+	if versionNumber < 10 {
+		appendBits(len(data), 8)
+	} else {
+		appendBits(len(data), 16)
+	}
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+
+	capacityBits := dataLength * 8
+	appendBits(0, min(4, capacityBits-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+
+	codewords := make([]byte, 0, dataLength)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := range 8 {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		codewords = append(codewords, b)
+	}
+
+	for pad := byte(0xec); len(codewords) < dataLength; pad ^= 0xec ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+
+	return codewords
+}
+
+func qrAddErrorCorrection(data []byte, version qrVersion) []byte {
+	divisor := reedSolomonDivisor(version.ecPerBlock)
+
+	var dataBlocks, ecBlocks [][]byte
+	offset := 0
+	for _, blockLength := range version.blockLengths {
+		block := data[offset : offset+blockLength]
+		offset += blockLength
+		dataBlocks = append(dataBlocks, block)
+		ecBlocks = append(ecBlocks, reedSolomonRemainder(block, divisor))
+	}
+
+	// interleave the blocks, shorter blocks come first and are skipped once exhausted
+	var result []byte
+	for i := 0; i < version.blockLengths[len(version.blockLengths)-1]; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := range version.ecPerBlock {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+
+	return result
+}
+
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = galoisMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = galoisMultiply(root, 0x02)
+	}
+
+	return result
+}
+
+func reedSolomonRemainder(data []byte, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= galoisMultiply(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// multiplication in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func galoisMultiply(x byte, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11d)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func (code *qrCode) setFunction(x int, y int, dark bool) {
+	code.modules[y][x] = dark
+	code.isFunction[y][x] = true
+}
+
+func (code *qrCode) drawFunctionPatterns(versionNumber int, alignment []int) {
+	for i := range code.size {
+		code.setFunction(6, i, i%2 == 0)
+		code.setFunction(i, 6, i%2 == 0)
+	}
+
+	for _, center := range [][2]int{{3, 3}, {code.size - 4, 3}, {3, code.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || x >= code.size || y < 0 || y >= code.size {
+					continue
+				}
+				distance := max(abs(dx), abs(dy))
+				code.setFunction(x, y, distance != 2 && distance != 4)
+			}
+		}
+	}
+
+	last := len(alignment) - 1
+	for i, x := range alignment {
+		for j, y := range alignment {
+			// skip the corners that overlap finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					code.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// reserve the format areas, they are drawn once the mask is known
+	code.drawFormatBits(0)
+
+	if versionNumber >= 7 {
+		remainder := versionNumber
+		for range 12 {
+			remainder = (remainder << 1) ^ ((remainder >> 11) * 0x1f25)
+		}
+		bits := versionNumber<<12 | remainder
+		for i := range 18 {
+			dark := (bits>>i)&1 == 1
+			a := code.size - 11 + i%3
+			b := i / 3
+			code.setFunction(a, b, dark)
+			code.setFunction(b, a, dark)
+		}
+	}
+}
+
+func (code *qrCode) drawFormatBits(mask int) {
+	// medium error correction level is 00
+	data := mask
+	remainder := data
+	for range 10 {
+		remainder = (remainder << 1) ^ ((remainder >> 9) * 0x537)
+	}
+	bits := (data<<10 | remainder) ^ 0x5412
+	bit := func(i int) bool {
+		return (bits>>i)&1 == 1
+	}
+
+	for i := 0; i <= 5; i++ {
+		code.setFunction(8, i, bit(i))
+	}
+	code.setFunction(8, 7, bit(6))
+	code.setFunction(8, 8, bit(7))
+	code.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		code.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := range 8 {
+		code.setFunction(code.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		code.setFunction(8, code.size-15+i, bit(i))
+	}
+	code.setFunction(8, code.size-8, true)
+}
+
+func (code *qrCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := code.size - 1; right >= 1; right -= 2 {
+		// skip the vertical timing pattern
+		if right == 6 {
+			right = 5
+		}
+		for vertical := range code.size {
+			for j := range 2 {
+				x := right - j
+				y := vertical
+				if (right+1)&2 == 0 {
+					y = code.size - 1 - vertical
+				}
+				if code.isFunction[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				code.modules[y][x] = (codewords[i>>3]>>(7-i&7))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+func (code *qrCode) applyMask(mask int) {
+	for y := range code.size {
+		for x := range code.size {
+			if code.isFunction[y][x] {
+				continue
+			}
+
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			code.modules[y][x] = code.modules[y][x] != invert
+		}
+	}
+}
+
+func (code *qrCode) penalty() int {
+	penalty := 0
+	finderLike := []bool{true, false, true, true, true, false, true}
+
+	for _, transposed := range []bool{false, true} {
+		for i := range code.size {
+			line := make([]bool, code.size)
+			for j := range code.size {
+				if transposed {
+					line[j] = code.modules[j][i]
+				} else {
+					line[j] = code.modules[i][j]
+				}
+			}
+
+			// runs of five or more modules of the same color
+			run := 1
+			for j := 1; j <= code.size; j++ {
+				if j < code.size && line[j] == line[j-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+
+			// finder like patterns with four light modules on either side
+			for j := 0; j+len(finderLike) <= code.size; j++ {
+				matches := true
+				for k, dark := range finderLike {
+					if line[j+k] != dark {
+						matches = false
+						break
+					}
+				}
+				if matches && (lightRun(line, j-4, j) || lightRun(line, j+len(finderLike), j+len(finderLike)+4)) {
+					penalty += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := range code.size {
+		for x := range code.size {
+			if code.modules[y][x] {
+				dark++
+			}
+			if x+1 < code.size && y+1 < code.size {
+				color := code.modules[y][x]
+				if code.modules[y][x+1] == color && code.modules[y+1][x] == color && code.modules[y+1][x+1] == color {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	total := code.size * code.size
+	deviation := abs(dark*20 - total*10)
+	penalty += (deviation + total - 1) / total * 10
+	penalty -= 10
+
+	return penalty
+}
+
+// modules outside of the code are light
+func lightRun(line []bool, start int, end int) bool {
+	for i := start; i < end; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sum(values []int) int {
+	total := 0
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+// the full matrix, without the quiet zone, that an independent encoder produces for the same payload with mask 3
+var qrExpectedModules = []string{
+	"#######.#...#.#.#.#.#.#.#..##.#######",
+	"#.....#.##.#.#..#..##..###..#.#.....#",
+	"#.###.#....#....#...#....##...#.###.#",
+	"#.###.#.#.#.#....####.#.####..#.###.#",
+	"#.###.#..##...##.###.#..##..#.#.###.#",
+	"#.....#..##.#..#...###...#....#.....#",
+	"#######.#.#.#.#.#.#.#.#.#.#.#.#######",
+	"........#.##..#..##..#.##.###........",
+	"#.##.###...#...##..##..#.####.#..#.##",
+	"######.#...##.####...#....######.#.#.",
+	"..##..###.#.#..#.##..#...##...#..##..",
+	"###.#..#..#....#..##...###..####.##..",
+	"#..#####.#...#........######..#.#.###",
+	"...###...#.##..#...#....#.##.##.#..##",
+	"###.####.#...##.#####.#.##..#..##.##.",
+	"...###..#.##.######.###.#..#.#..#..##",
+	"#.###.#.###.#.#.###.#..#....#...#.#..",
+	"#..#.#.#.#.#.##.#..##........#....###",
+	"#..#..###.##...###.#.##.####.#..#####",
+	".#.###..#.#.##...###..##....#.#..#..#",
+	"###..######.#...###.###...#..#..#..##",
+	"....##.#.#..#.#.#..##.##.##.##...#...",
+	"#.##..#.....##...#...###.##.....##...",
+	"#..#...####...##..#..###.##..########",
+	".#.#..#.#.#.#.....#.####.#.#.##...#.#",
+	"..###...#...##..###.##.##...#..###.##",
+	".#.##.#.####.#.###.###...##..#...###.",
+	"#.##.#...#####..#.#..##.#.#...###..##",
+	"....###.#....#.#..#..##.##..########.",
+	"........###.####.#..#.##.#.##...#####",
+	"#######.#.#.#.####..##..##..#.#.#..##",
+	"#.....#.#....##.#..##.###..##...##.##",
+	"#.###.#..#.#.#....##..#.###.######.#.",
+	"#.###.#.#.#.#.##.##.#.#..##.###.#...#",
+	"#.###.#.###..#..#.###..#.#.######....",
+	"#.....#..##.##..#.#.#....#.#..##..#..",
+	"#######.#..#...###.##.#.####.###..###",
+}
+
+func TestQrEncode(t *testing.T) {
+	code, err := qrEncode([]byte("otpauth://totp/Ground:alice?issuer=Ground&secret=JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code.size != len(qrExpectedModules) {
+		t.Fatalf("size = %d, want %d", code.size, len(qrExpectedModules))
+	}
+
+	for y := range code.size {
+		var row strings.Builder
+		for x := range code.size {
+			if code.modules[y][x] {
+				row.WriteByte('#')
+			} else {
+				row.WriteByte('.')
+			}
+		}
+		if row.String() != qrExpectedModules[y] {
+			t.Errorf("row %d = %s, want %s", y, row.String(), qrExpectedModules[y])
+		}
+	}
+}
+
+func TestQrAddErrorCorrection(t *testing.T) {
+	// the 1-M "HELLO WORLD" data and error correction codewords from the qr code specification tutorial
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	codewords := qrAddErrorCorrection(data, qrVersions[0])
+	if string(codewords[:len(data)]) != string(data) {
+		t.Errorf("data codewords = %v, want %v", codewords[:len(data)], data)
+	}
+	if string(codewords[len(data):]) != string(want) {
+		t.Errorf("error correction codewords = %v, want %v", codewords[len(data):], want)
+	}
+}
+
+func TestQrEncodeRejectsLongText(t *testing.T) {
+	_, err := qrEncode([]byte(strings.Repeat("a", 300)))
+	if err == nil {
+		t.Error("qrEncode accepted text longer than version 10 holds")
+	}
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/grantfbarnes/ground/internal/system/execute"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const passwordResetsDirPath string = "/etc/ground/password-resets"
+const temporaryPasswordLength int = 16
+
+var passwordResetMutex sync.Mutex
+
+// backends with system accounts can also force the change outside of ground
+type passwordExpirer interface {
+	ExpirePassword(username string) error
+	PasswordIsExpired(username string) (bool, error)
+}
+
+// sets a random one time password and returns it, it has to be changed at the next login
+// su refuses expired passwords, so the temporary password is verified against its own hash until it is changed
+func ResetPassword(username string) (string, error) {
+	// base32 has no 0, 1, or 8, so the password is hard to misread when copied by hand
+	password := rand.Text()[:temporaryPasswordLength]
+
+	err := setTemporaryPassword(username, password)
+	if err != nil {
+		return "", err
+	}
+
+	return password, nil
+}
+
+// sets a one time password chosen by an admin, it still has to follow the policy since it could be guessed
+func SetTemporaryPassword(username string, password string) error {
+	if password == "" || strings.ContainsAny(password, "\x00\n") {
+		return errors.New("password is not valid")
+	}
+
+	err := ValidatePassword(username, password)
+	if err != nil {
+		return err
+	}
+
+	return setTemporaryPassword(username, password)
+}
+
+func setTemporaryPassword(username string, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return errors.Join(errors.New("failed to hash password"), err)
+	}
+
+	err = authenticator.SetPassword(username, password)
+	if err != nil {
+		return errors.Join(errors.New("failed to set password"), err)
+	}
+
+	if expirer, ok := authenticator.(passwordExpirer); ok {
+		err = expirer.ExpirePassword(username)
+		if err != nil {
+			return errors.Join(errors.New("failed to expire password"), err)
+		}
+	}
+
+	passwordResetMutex.Lock()
+	defer passwordResetMutex.Unlock()
+
+	err = os.MkdirAll(passwordResetsDirPath, 0700)
+	if err != nil {
+		return errors.Join(errors.New("failed to create password resets directory"), err)
+	}
+
+	err = os.WriteFile(path.Join(passwordResetsDirPath, username), append(hash, '\n'), 0600)
+	if err != nil {
+		return errors.Join(errors.New("failed to write password reset"), err)
+	}
+
+	return nil
+}
+
+func PasswordChangeRequired(username string) bool {
+	_, ok := getPasswordResetHash(username)
+	return ok
+}
+
+// returns the hash of the temporary password while it is still the user's password
+func getPasswordResetHash(username string) (string, bool) {
+	passwordResetMutex.Lock()
+	defer passwordResetMutex.Unlock()
+
+	resetFilePath := path.Join(passwordResetsDirPath, username)
+	content, err := os.ReadFile(resetFilePath)
+	if err != nil {
+		return "", false
+	}
+
+	// the password was changed outside of ground, through ssh for example
+	if expirer, ok := authenticator.(passwordExpirer); ok {
+		expired, err := expirer.PasswordIsExpired(username)
+		if err == nil && !expired {
+			os.Remove(resetFilePath)
+			return "", false
+		}
+	}
+
+	return strings.TrimSpace(string(content)), true
+}
+
+func removePasswordReset(username string) error {
+	passwordResetMutex.Lock()
+	defer passwordResetMutex.Unlock()
+
+	err := os.Remove(path.Join(passwordResetsDirPath, username))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func expireSystemPassword(username string) error {
+	err := execute.PasswordExpire(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to expire system password"), err)
+	}
+
+	return nil
+}
+
+func systemPasswordIsExpired(username string) (bool, error) {
+	expired, err := execute.PasswordIsExpired(username)
+	if err != nil {
+		return false, errors.Join(errors.New("failed to check system password"), err)
+	}
+
+	return expired, nil
+}
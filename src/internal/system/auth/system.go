@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/grantfbarnes/ground/internal/system/execute"
+)
+
+// verifies system passwords through su, kept as the default for existing installs
+type systemAuthenticator struct{}
+
+func (systemAuthenticator) Authenticate(username string, password string) error {
+	err := execute.TestRunAs(username, password)
+	if err != nil {
+		return errors.Join(errors.New("failed to run as user"), err)
+	}
+
+	return nil
+}
+
+func (systemAuthenticator) SetPassword(username string, password string) error {
+	err := execute.PasswordSet(username, password)
+	if err != nil {
+		return errors.Join(errors.New("failed to set system password"), err)
+	}
+
+	return nil
+}
+
+func (systemAuthenticator) ExpirePassword(username string) error {
+	return expireSystemPassword(username)
+}
+
+func (systemAuthenticator) PasswordIsExpired(username string) (bool, error) {
+	return systemPasswordIsExpired(username)
+}
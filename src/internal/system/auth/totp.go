@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const totpDirPath string = "/etc/ground/totp"
+const adminTotpRequiredFilePath string = "/etc/ground/require-admin-totp"
+const totpIssuer string = "Ground"
+const totpSecretLength int = 20
+const totpDigits int = 6
+const totpPeriod int64 = 30
+const totpSkew int64 = 1
+const recoveryCodeCount int = 10
+const recoveryCodeLength int = 10
+
+var ErrTotpCodeNotValid = errors.New("code is not valid")
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var totpMutex sync.Mutex
+
+// the last used step is kept with the secret, so a code cannot be used again after a restart
+type totpRecord struct {
+	Secret        string   `json:"secret"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+	LastUsedStep  int64    `json:"lastUsedStep"`
+}
+
+type TotpSetup struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`
+	QrSvg  string `json:"qrSvg"`
+}
+
+func GenerateTotpSetup(username string) (TotpSetup, error) {
+	secretBytes := make([]byte, totpSecretLength)
+	_, err := rand.Read(secretBytes)
+	if err != nil {
+		return TotpSetup{}, errors.Join(errors.New("failed to generate secret"), err)
+	}
+	secret := totpEncoding.EncodeToString(secretBytes)
+
+	uri := fmt.Sprintf("otpauth://totp/%s:%s?%s",
+		url.PathEscape(totpIssuer),
+		url.PathEscape(username),
+		url.Values{"secret": {secret}, "issuer": {totpIssuer}}.Encode(),
+	)
+
+	qrSvg, err := qrCodeSvg(uri)
+	if err != nil {
+		return TotpSetup{}, errors.Join(errors.New("failed to create qr code"), err)
+	}
+
+	return TotpSetup{
+		Secret: secret,
+		Uri:    uri,
+		QrSvg:  qrSvg,
+	}, nil
+}
+
+func TotpIsEnrolled(username string) (bool, error) {
+	record, err := readTotpRecord(username)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Join(errors.New("failed to read secret"), err)
+	}
+
+	return record.Secret != "", nil
+}
+
+// saves the secret once the user proves their authenticator has it, returns the plaintext recovery codes
+func EnrollTotp(username string, secret string, code string) ([]string, error) {
+	secretBytes, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(secretBytes) != totpSecretLength {
+		return nil, errors.New("secret is not valid")
+	}
+
+	totpMutex.Lock()
+	defer totpMutex.Unlock()
+
+	step, ok := matchTotpCode(secretBytes, code)
+	if !ok {
+		return nil, ErrTotpCodeNotValid
+	}
+
+	recoveryCodes := make([]string, 0, recoveryCodeCount)
+	recoveryCodeHashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		recoveryCodeBytes := make([]byte, recoveryCodeLength/2)
+		_, err := rand.Read(recoveryCodeBytes)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to generate recovery code"), err)
+		}
+		recoveryCode := hex.EncodeToString(recoveryCodeBytes)
+		recoveryCodes = append(recoveryCodes, recoveryCode[:recoveryCodeLength/2]+"-"+recoveryCode[recoveryCodeLength/2:])
+		recoveryCodeHashes = append(recoveryCodeHashes, hashRecoveryCode(recoveryCode))
+	}
+
+	err = writeTotpRecord(username, totpRecord{
+		Secret:        secret,
+		RecoveryCodes: recoveryCodeHashes,
+		LastUsedStep:  step,
+	})
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to write secret"), err)
+	}
+
+	return recoveryCodes, nil
+}
+
+func DisableTotp(username string) error {
+	totpMutex.Lock()
+	defer totpMutex.Unlock()
+
+	err := os.Remove(path.Join(totpDirPath, username))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Join(errors.New("failed to remove file"), err)
+	}
+
+	return nil
+}
+
+// accepts a current authenticator code, or a recovery code which is then used up
+func VerifySecondFactor(username string, code string) error {
+	code = strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+
+	totpMutex.Lock()
+	defer totpMutex.Unlock()
+
+	record, err := readTotpRecord(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to read secret"), err)
+	}
+
+	if len(code) == recoveryCodeLength {
+		err = useRecoveryCode(&record, code)
+	} else {
+		err = acceptTotpCode(&record, code)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = writeTotpRecord(username, record)
+	if err != nil {
+		return errors.Join(errors.New("failed to write secret"), err)
+	}
+
+	return nil
+}
+
+func AdminTotpRequired() bool {
+	_, err := os.Stat(adminTotpRequiredFilePath)
+	return err == nil
+}
+
+func SetAdminTotpRequired(required bool) error {
+	if !required {
+		err := os.Remove(adminTotpRequiredFilePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Join(errors.New("failed to remove file"), err)
+		}
+		return nil
+	}
+
+	err := os.MkdirAll(path.Dir(adminTotpRequiredFilePath), 0755)
+	if err != nil {
+		return errors.Join(errors.New("failed to create directory"), err)
+	}
+
+	err = os.WriteFile(adminTotpRequiredFilePath, []byte{}, 0644)
+	if err != nil {
+		return errors.Join(errors.New("failed to write file"), err)
+	}
+
+	return nil
+}
+
+func useRecoveryCode(record *totpRecord, code string) error {
+	codeHash := hashRecoveryCode(code)
+	for i, recoveryCodeHash := range record.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(recoveryCodeHash), []byte(codeHash)) == 1 {
+			record.RecoveryCodes = slices.Delete(record.RecoveryCodes, i, i+1)
+			return nil
+		}
+	}
+
+	return ErrTotpCodeNotValid
+}
+
+// a code, or any code from an earlier time step, is only accepted once per user
+func acceptTotpCode(record *totpRecord, code string) error {
+	secret, err := totpEncoding.DecodeString(record.Secret)
+	if err != nil {
+		return errors.Join(errors.New("failed to decode secret"), err)
+	}
+
+	step, ok := matchTotpCode(secret, code)
+	if !ok {
+		return ErrTotpCodeNotValid
+	}
+
+	if step <= record.LastUsedStep {
+		return errors.New("code was already used")
+	}
+	record.LastUsedStep = step
+
+	return nil
+}
+
+// returns the time step of the matching code, allowing for clock drift of one step either way
+func matchTotpCode(secret []byte, code string) (int64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	currentStep := time.Now().Unix() / totpPeriod
+	for step := currentStep - totpSkew; step <= currentStep+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(generateTotpCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// rfc 6238 with the default sha1, 6 digit and 30 second parameters most authenticator apps expect
+func generateTotpCode(secret []byte, step int64) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	hash := hmac.New(sha1.New, secret)
+	hash.Write(counter)
+	sum := hash.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func readTotpRecord(username string) (totpRecord, error) {
+	content, err := os.ReadFile(path.Join(totpDirPath, username))
+	if err != nil {
+		return totpRecord{}, err
+	}
+
+	record := totpRecord{}
+	err = json.Unmarshal(content, &record)
+	if err != nil {
+		return totpRecord{}, errors.Join(errors.New("failed to parse secret"), err)
+	}
+
+	return record, nil
+}
+
+func writeTotpRecord(username string, record totpRecord) error {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return writeRootFile(path.Join(totpDirPath, username), content)
+}
+
+// writes a file only root can read, through a temporary file so a failed write keeps the old content
+func writeRootFile(filePath string, content []byte) error {
+	err := os.MkdirAll(path.Dir(filePath), 0700)
+	if err != nil {
+		return errors.Join(errors.New("failed to create directory"), err)
+	}
+
+	tempFilePath := filePath + ".tmp"
+	err = os.WriteFile(tempFilePath, content, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempFilePath, filePath)
+}
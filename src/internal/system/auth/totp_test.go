@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestGenerateTotpCode(t *testing.T) {
+	// rfc 6238 appendix b sha1 vectors, truncated to the last 6 of their 8 digits
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unixTime int64
+		want     string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		got := generateTotpCode(secret, test.unixTime/totpPeriod)
+		if got != test.want {
+			t.Errorf("generateTotpCode at %d = %s, want %s", test.unixTime, got, test.want)
+		}
+	}
+}
+
+func TestMatchTotpCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	currentStep := time.Now().Unix() / totpPeriod
+
+	for offset := -totpSkew; offset <= totpSkew; offset++ {
+		step, ok := matchTotpCode(secret, generateTotpCode(secret, currentStep+offset))
+		if !ok || step != currentStep+offset {
+			t.Errorf("code for step offset %d = %d, %v, want %d, true", offset, step, ok, currentStep+offset)
+		}
+	}
+
+	for _, offset := range []int64{-totpSkew - 1, totpSkew + 1} {
+		_, ok := matchTotpCode(secret, generateTotpCode(secret, currentStep+offset))
+		if ok {
+			t.Errorf("code for step offset %d matched outside of the allowed skew", offset)
+		}
+	}
+
+	for _, code := range []string{"", "12345", "1234567"} {
+		_, ok := matchTotpCode(secret, code)
+		if ok {
+			t.Errorf("matchTotpCode(%q) matched a code of the wrong length", code)
+		}
+	}
+}
+
+func TestAcceptTotpCodeRejectsReplay(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	record := totpRecord{Secret: totpEncoding.EncodeToString(secret)}
+
+	currentStep := time.Now().Unix() / totpPeriod
+	code := generateTotpCode(secret, currentStep)
+
+	err := acceptTotpCode(&record, code)
+	if err != nil {
+		t.Fatalf("first use of the code failed: %v", err)
+	}
+
+	err = acceptTotpCode(&record, code)
+	if err == nil {
+		t.Error("second use of the same code was accepted")
+	}
+
+	// the record as it would be read back after a restart
+	content, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := totpRecord{}
+	err = json.Unmarshal(content, &reloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = acceptTotpCode(&reloaded, code)
+	if err == nil {
+		t.Error("code was accepted again after the record was reloaded")
+	}
+
+	err = acceptTotpCode(&reloaded, generateTotpCode(secret, currentStep-1))
+	if err == nil {
+		t.Error("code from an earlier step was accepted after a later one")
+	}
+
+	err = acceptTotpCode(&reloaded, generateTotpCode(secret, currentStep+1))
+	if err != nil {
+		t.Errorf("code from a later step failed: %v", err)
+	}
+
+	err = acceptTotpCode(&totpRecord{Secret: record.Secret}, code)
+	if err != nil {
+		t.Errorf("the same code for another user failed: %v", err)
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	record := totpRecord{RecoveryCodes: []string{hashRecoveryCode("0123456789"), hashRecoveryCode("abcdef0123")}}
+
+	err := useRecoveryCode(&record, "abcdef0123")
+	if err != nil {
+		t.Fatalf("recovery code was not accepted: %v", err)
+	}
+
+	err = useRecoveryCode(&record, "abcdef0123")
+	if err == nil {
+		t.Error("recovery code was accepted twice")
+	}
+
+	if len(record.RecoveryCodes) != 1 || record.RecoveryCodes[0] != hashRecoveryCode("0123456789") {
+		t.Errorf("remaining recovery codes = %v, want only the unused one", record.RecoveryCodes)
+	}
+}
@@ -0,0 +1,619 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const passkeysDirPath string = "/etc/ground/passkeys"
+const passkeyRpName string = "Ground"
+const passkeyChallengeLength int = 32
+const passkeyChallengeExpiry time.Duration = 5 * time.Minute
+const passkeyMaxPendingChallenges int = 1000
+const passkeyMaxPendingChallengesPerIp int = 10
+const passkeyTimeoutMilliseconds int = 120000
+const passkeyMaxCredentialIdLength int = 1023
+const passkeyMaxNameLength int = 64
+const displayTimeLayout string = "2006-01-02 03:04:05 PM"
+
+const coseAlgorithmEs256 int64 = -7
+const coseAlgorithmEdDsa int64 = -8
+const coseAlgorithmRs256 int64 = -257
+
+const authenticatorFlagUserPresent byte = 0x01
+const authenticatorFlagUserVerified byte = 0x04
+const authenticatorFlagAttestedCredential byte = 0x40
+
+var ErrPasskeyChallengeLimit = errors.New("too many pending challenges")
+
+var webauthnEncoding = base64.RawURLEncoding
+
+var passkeyMutex sync.Mutex
+var passkeyChallenges map[string]passkeyChallenge = make(map[string]passkeyChallenge)
+
+type Passkey struct {
+	Id        string
+	Name      string
+	Created   string
+	algorithm int64
+	publicKey []byte
+	signCount uint32
+	createdAt int64
+}
+
+// options for navigator.credentials.create, binary values are base64url encoded
+type PasskeyCreationOptions struct {
+	Challenge            string   `json:"challenge"`
+	RpId                 string   `json:"rpId"`
+	RpName               string   `json:"rpName"`
+	UserId               string   `json:"userId"`
+	UserName             string   `json:"userName"`
+	Algorithms           []int64  `json:"algorithms"`
+	ExcludeCredentialIds []string `json:"excludeCredentialIds"`
+	Timeout              int      `json:"timeout"`
+}
+
+// options for navigator.credentials.get, binary values are base64url encoded
+type PasskeyRequestOptions struct {
+	Challenge          string   `json:"challenge"`
+	RpId               string   `json:"rpId"`
+	AllowCredentialIds []string `json:"allowCredentialIds"`
+	Timeout            int      `json:"timeout"`
+}
+
+type PasskeyAssertion struct {
+	CredentialId      []byte
+	ClientDataJson    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+}
+
+type passkeyChallenge struct {
+	ip           string
+	username     string
+	registration bool
+	expiry       time.Time
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIdHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialId []byte
+	publicKey    map[any]any
+}
+
+func GetPasskeys(username string) ([]Passkey, error) {
+	content, err := os.ReadFile(path.Join(passkeysDirPath, username))
+	if errors.Is(err, os.ErrNotExist) {
+		return []Passkey{}, nil
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read passkeys"), err)
+	}
+
+	passkeys := []Passkey{}
+	for line := range strings.Lines(string(content)) {
+		passkey, ok := parsePasskeyLine(strings.TrimSpace(line))
+		if !ok {
+			continue
+		}
+		passkeys = append(passkeys, passkey)
+	}
+
+	return passkeys, nil
+}
+
+func BeginPasskeyRegistration(ip string, username string, rpId string) (PasskeyCreationOptions, error) {
+	passkeys, err := GetPasskeys(username)
+	if err != nil {
+		return PasskeyCreationOptions{}, errors.Join(errors.New("failed to get passkeys"), err)
+	}
+
+	challenge, err := newPasskeyChallenge(ip, username, true)
+	if err != nil {
+		return PasskeyCreationOptions{}, errors.Join(errors.New("failed to create challenge"), err)
+	}
+
+	excludeCredentialIds := []string{}
+	for _, passkey := range passkeys {
+		excludeCredentialIds = append(excludeCredentialIds, passkey.Id)
+	}
+
+	return PasskeyCreationOptions{
+		Challenge:            challenge,
+		RpId:                 rpId,
+		RpName:               passkeyRpName,
+		UserId:               webauthnEncoding.EncodeToString([]byte(username)),
+		UserName:             username,
+		Algorithms:           []int64{coseAlgorithmEs256, coseAlgorithmEdDsa, coseAlgorithmRs256},
+		ExcludeCredentialIds: excludeCredentialIds,
+		Timeout:              passkeyTimeoutMilliseconds,
+	}, nil
+}
+
+// verifies the attestation from navigator.credentials.create and saves the credential public key
+// attestation statements are not checked, ground asks for none and trusts any authenticator the user chooses
+func FinishPasskeyRegistration(username string, origin string, rpId string, name string, clientDataJson []byte, attestationObject []byte) error {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > passkeyMaxNameLength || strings.ContainsAny(name, "\r\n\x00") {
+		return errors.New("name is not valid")
+	}
+
+	err := verifyClientData(clientDataJson, "webauthn.create", origin, username, true)
+	if err != nil {
+		return errors.Join(errors.New("failed to verify client data"), err)
+	}
+
+	attestation, _, err := cborDecode(attestationObject)
+	if err != nil {
+		return errors.Join(errors.New("failed to decode attestation object"), err)
+	}
+
+	attestationMap, ok := attestation.(map[any]any)
+	if !ok {
+		return errors.New("attestation object is not a map")
+	}
+
+	authData, ok := attestationMap["authData"].([]byte)
+	if !ok {
+		return errors.New("attestation object has no authenticator data")
+	}
+
+	data, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return errors.Join(errors.New("failed to parse authenticator data"), err)
+	}
+
+	err = verifyAuthenticatorData(data, rpId)
+	if err != nil {
+		return err
+	}
+
+	if data.credentialId == nil {
+		return errors.New("authenticator data has no credential")
+	}
+
+	algorithm, publicKey, err := parseCosePublicKey(data.publicKey)
+	if err != nil {
+		return errors.Join(errors.New("failed to parse public key"), err)
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return errors.Join(errors.New("failed to encode public key"), err)
+	}
+
+	passkeyMutex.Lock()
+	defer passkeyMutex.Unlock()
+
+	passkeys, err := GetPasskeys(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to get passkeys"), err)
+	}
+
+	id := webauthnEncoding.EncodeToString(data.credentialId)
+	for _, passkey := range passkeys {
+		if passkey.Id == id {
+			return errors.New("passkey is already registered")
+		}
+	}
+
+	passkeys = append(passkeys, Passkey{
+		Id:        id,
+		Name:      name,
+		algorithm: algorithm,
+		publicKey: publicKeyBytes,
+		signCount: data.signCount,
+		createdAt: time.Now().Unix(),
+	})
+
+	return writePasskeys(username, passkeys)
+}
+
+// the username is optional, without it the authenticator offers its discoverable credentials
+func BeginPasskeyLogin(ip string, username string, rpId string) (PasskeyRequestOptions, error) {
+	allowCredentialIds := []string{}
+	if username != "" {
+		passkeys, err := GetPasskeys(username)
+		if err != nil {
+			return PasskeyRequestOptions{}, errors.Join(errors.New("failed to get passkeys"), err)
+		}
+		for _, passkey := range passkeys {
+			allowCredentialIds = append(allowCredentialIds, passkey.Id)
+		}
+	}
+
+	challenge, err := newPasskeyChallenge(ip, username, false)
+	if err != nil {
+		return PasskeyRequestOptions{}, errors.Join(errors.New("failed to create challenge"), err)
+	}
+
+	return PasskeyRequestOptions{
+		Challenge:          challenge,
+		RpId:               rpId,
+		AllowCredentialIds: allowCredentialIds,
+		Timeout:            passkeyTimeoutMilliseconds,
+	}, nil
+}
+
+// verifies the assertion from navigator.credentials.get, returns whether the authenticator verified the user
+func FinishPasskeyLogin(username string, origin string, rpId string, assertion PasskeyAssertion) (bool, error) {
+	err := verifyClientData(assertion.ClientDataJson, "webauthn.get", origin, username, false)
+	if err != nil {
+		return false, errors.Join(errors.New("failed to verify client data"), err)
+	}
+
+	data, err := parseAuthenticatorData(assertion.AuthenticatorData)
+	if err != nil {
+		return false, errors.Join(errors.New("failed to parse authenticator data"), err)
+	}
+
+	err = verifyAuthenticatorData(data, rpId)
+	if err != nil {
+		return false, err
+	}
+
+	passkeyMutex.Lock()
+	defer passkeyMutex.Unlock()
+
+	passkeys, err := GetPasskeys(username)
+	if err != nil {
+		return false, errors.Join(errors.New("failed to get passkeys"), err)
+	}
+
+	id := webauthnEncoding.EncodeToString(assertion.CredentialId)
+	index := -1
+	for i, passkey := range passkeys {
+		if passkey.Id == id {
+			index = i
+			break
+		}
+	}
+
+	if index < 0 {
+		return false, errors.New("passkey is not registered")
+	}
+	passkey := passkeys[index]
+
+	clientDataHash := sha256.Sum256(assertion.ClientDataJson)
+	signedData := append(append([]byte{}, assertion.AuthenticatorData...), clientDataHash[:]...)
+	err = verifyPasskeySignature(passkey, signedData, assertion.Signature)
+	if err != nil {
+		return false, errors.Join(errors.New("failed to verify signature"), err)
+	}
+
+	// a counter that does not move forward means the authenticator may have been cloned
+	if (data.signCount != 0 || passkey.signCount != 0) && data.signCount <= passkey.signCount {
+		return false, errors.New("signature counter did not increase")
+	}
+
+	if data.signCount != passkey.signCount {
+		passkeys[index].signCount = data.signCount
+		err = writePasskeys(username, passkeys)
+		if err != nil {
+			return false, errors.Join(errors.New("failed to update signature counter"), err)
+		}
+	}
+
+	return data.flags&authenticatorFlagUserVerified != 0, nil
+}
+
+func DeletePasskey(username string, id string) error {
+	passkeyMutex.Lock()
+	defer passkeyMutex.Unlock()
+
+	passkeys, err := GetPasskeys(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to get passkeys"), err)
+	}
+
+	remaining := []Passkey{}
+	for _, passkey := range passkeys {
+		if passkey.Id != id {
+			remaining = append(remaining, passkey)
+		}
+	}
+
+	if len(remaining) == len(passkeys) {
+		return errors.New("passkey not found")
+	}
+
+	return writePasskeys(username, remaining)
+}
+
+func RemovePasskeys(username string) error {
+	passkeyMutex.Lock()
+	defer passkeyMutex.Unlock()
+
+	err := os.Remove(path.Join(passkeysDirPath, username))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func newPasskeyChallenge(ip string, username string, registration bool) (string, error) {
+	challengeBytes := make([]byte, passkeyChallengeLength)
+	_, err := rand.Read(challengeBytes)
+	if err != nil {
+		return "", errors.Join(errors.New("failed to generate challenge"), err)
+	}
+	challenge := webauthnEncoding.EncodeToString(challengeBytes)
+
+	passkeyMutex.Lock()
+	defer passkeyMutex.Unlock()
+
+	now := time.Now()
+	ipPendingChallenges := 0
+	for key, pending := range passkeyChallenges {
+		if now.After(pending.expiry) {
+			delete(passkeyChallenges, key)
+		} else if pending.ip == ip {
+			ipPendingChallenges++
+		}
+	}
+
+	// login challenges are handed out before authentication, keep one client from using up the rest
+	if len(passkeyChallenges) >= passkeyMaxPendingChallenges || ipPendingChallenges >= passkeyMaxPendingChallengesPerIp {
+		return "", ErrPasskeyChallengeLimit
+	}
+
+	passkeyChallenges[challenge] = passkeyChallenge{
+		ip:           ip,
+		username:     username,
+		registration: registration,
+		expiry:       now.Add(passkeyChallengeExpiry),
+	}
+
+	return challenge, nil
+}
+
+// checks the ceremony type, origin, and that the challenge was issued by this server, each challenge is used once
+func verifyClientData(clientDataJson []byte, ceremonyType string, origin string, username string, registration bool) error {
+	var data clientData
+	err := json.Unmarshal(clientDataJson, &data)
+	if err != nil {
+		return errors.Join(errors.New("failed to decode client data"), err)
+	}
+
+	if data.Type != ceremonyType {
+		return errors.New("ceremony type does not match")
+	}
+
+	if data.Origin != origin {
+		return fmt.Errorf("origin '%s' does not match '%s'", data.Origin, origin)
+	}
+
+	passkeyMutex.Lock()
+	pending, ok := passkeyChallenges[data.Challenge]
+	delete(passkeyChallenges, data.Challenge)
+	passkeyMutex.Unlock()
+
+	if !ok || time.Now().After(pending.expiry) || pending.registration != registration {
+		return errors.New("challenge is not valid")
+	}
+
+	// login challenges without a username can be answered by any user
+	if pending.username != "" && pending.username != username {
+		return errors.New("challenge was issued for another user")
+	}
+
+	return nil
+}
+
+func verifyAuthenticatorData(data authenticatorData, rpId string) error {
+	rpIdHash := sha256.Sum256([]byte(rpId))
+	if !bytes.Equal(data.rpIdHash, rpIdHash[:]) {
+		return errors.New("relying party id does not match")
+	}
+
+	if data.flags&authenticatorFlagUserPresent == 0 {
+		return errors.New("user was not present")
+	}
+
+	return nil
+}
+
+func parseAuthenticatorData(b []byte) (authenticatorData, error) {
+	// rp id hash, flags, and signature counter
+	if len(b) < 37 {
+		return authenticatorData{}, errors.New("authenticator data is truncated")
+	}
+
+	data := authenticatorData{
+		rpIdHash:  b[:32],
+		flags:     b[32],
+		signCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+
+	if data.flags&authenticatorFlagAttestedCredential == 0 {
+		return data, nil
+	}
+
+	// aaguid and credential id length
+	rest := b[37:]
+	if len(rest) < 18 {
+		return authenticatorData{}, errors.New("attested credential data is truncated")
+	}
+
+	credentialIdLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if credentialIdLength == 0 || credentialIdLength > passkeyMaxCredentialIdLength || len(rest) < credentialIdLength {
+		return authenticatorData{}, errors.New("credential id is not valid")
+	}
+	data.credentialId = rest[:credentialIdLength]
+
+	publicKey, _, err := cborDecode(rest[credentialIdLength:])
+	if err != nil {
+		return authenticatorData{}, errors.Join(errors.New("failed to decode public key"), err)
+	}
+
+	publicKeyMap, ok := publicKey.(map[any]any)
+	if !ok {
+		return authenticatorData{}, errors.New("public key is not a map")
+	}
+	data.publicKey = publicKeyMap
+
+	return data, nil
+}
+
+// converts a cose key to a go public key, only the algorithms offered at registration are accepted
+func parseCosePublicKey(coseKey map[any]any) (int64, crypto.PublicKey, error) {
+	keyType, _ := coseKey[int64(1)].(int64)
+	algorithm, _ := coseKey[int64(3)].(int64)
+
+	switch algorithm {
+	case coseAlgorithmEs256:
+		curve, _ := coseKey[int64(-1)].(int64)
+		x, _ := coseKey[int64(-2)].([]byte)
+		y, _ := coseKey[int64(-3)].([]byte)
+		if keyType != 2 || curve != 1 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, errors.New("es256 key is not valid")
+		}
+
+		point := append(append([]byte{0x04}, x...), y...)
+		publicKey, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point)
+		if err != nil {
+			return 0, nil, errors.Join(errors.New("es256 key is not on the curve"), err)
+		}
+		return algorithm, publicKey, nil
+	case coseAlgorithmEdDsa:
+		curve, _ := coseKey[int64(-1)].(int64)
+		x, _ := coseKey[int64(-2)].([]byte)
+		if keyType != 1 || curve != 6 || len(x) != ed25519.PublicKeySize {
+			return 0, nil, errors.New("ed25519 key is not valid")
+		}
+		return algorithm, ed25519.PublicKey(x), nil
+	case coseAlgorithmRs256:
+		n, _ := coseKey[int64(-1)].([]byte)
+		e, _ := coseKey[int64(-2)].([]byte)
+		if keyType != 3 || len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return 0, nil, errors.New("rsa key is not valid")
+		}
+
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return algorithm, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+	}
+
+	return 0, nil, fmt.Errorf("algorithm %d is not supported", algorithm)
+}
+
+func verifyPasskeySignature(passkey Passkey, signedData []byte, signature []byte) error {
+	publicKey, err := x509.ParsePKIXPublicKey(passkey.publicKey)
+	if err != nil {
+		return errors.Join(errors.New("failed to parse public key"), err)
+	}
+
+	hash := sha256.Sum256(signedData)
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if passkey.algorithm != coseAlgorithmEs256 || !ecdsa.VerifyASN1(key, hash[:], signature) {
+			return errors.New("es256 signature is not valid")
+		}
+	case ed25519.PublicKey:
+		if passkey.algorithm != coseAlgorithmEdDsa || !ed25519.Verify(key, signedData, signature) {
+			return errors.New("ed25519 signature is not valid")
+		}
+	case *rsa.PublicKey:
+		if passkey.algorithm != coseAlgorithmRs256 {
+			return errors.New("rsa algorithm does not match")
+		}
+		err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature)
+		if err != nil {
+			return errors.Join(errors.New("rsa signature is not valid"), err)
+		}
+	default:
+		return errors.New("public key type is not supported")
+	}
+
+	return nil
+}
+
+// one 'id algorithm key counter created name' entry per line, like authorized_keys the name is last so it may contain spaces
+func parsePasskeyLine(line string) (Passkey, bool) {
+	fields := strings.SplitN(line, " ", 6)
+	if len(fields) != 6 {
+		return Passkey{}, false
+	}
+
+	algorithm, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return Passkey{}, false
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return Passkey{}, false
+	}
+
+	signCount, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return Passkey{}, false
+	}
+
+	createdAt, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return Passkey{}, false
+	}
+
+	return Passkey{
+		Id:        fields[0],
+		Name:      fields[5],
+		Created:   time.Unix(createdAt, 0).Format(displayTimeLayout),
+		algorithm: algorithm,
+		publicKey: publicKey,
+		signCount: uint32(signCount),
+		createdAt: createdAt,
+	}, true
+}
+
+func writePasskeys(username string, passkeys []Passkey) error {
+	var content strings.Builder
+	for _, passkey := range passkeys {
+		fmt.Fprintf(&content, "%s %d %s %d %d %s\n",
+			passkey.Id,
+			passkey.algorithm,
+			base64.StdEncoding.EncodeToString(passkey.publicKey),
+			passkey.signCount,
+			passkey.createdAt,
+			passkey.Name,
+		)
+	}
+
+	err := writeRootFile(path.Join(passkeysDirPath, username), []byte(content.String()))
+	if err != nil {
+		return errors.Join(errors.New("failed to write passkeys"), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+// recorded from webauthn.io, a registration with none attestation and an assertion from macos touch id
+const registrationCredentialId string = "6xrtBhJQW6QU4tOaB4rrHaS2Ks0yDDL_q8jDC16DEjZ-VLVf4kCRkvl2xp2D71sTPYns-exsHQHTy3G-zJRK8g"
+const registrationClientDataJson string = "eyJjaGFsbGVuZ2UiOiJXOEd6RlU4cEdqaG9SYldyTERsYW1BZnFfeTRTMUNaRzFWdW9lUkxBUnJFIiwib3JpZ2luIjoiaHR0cHM6Ly93ZWJhdXRobi5pbyIsInR5cGUiOiJ3ZWJhdXRobi5jcmVhdGUifQ"
+const registrationAttestationObject string = "o2NmbXRkbm9uZWdhdHRTdG10oGhhdXRoRGF0YVjEdKbqkhPJnC90siSSsyDPQCYqlMGpUKA5fyklC2CEHvBBAAAAAAAAAAAAAAAAAAAAAAAAAAAAQOsa7QYSUFukFOLTmgeK6x2ktirNMgwy_6vIwwtegxI2flS1X-JAkZL5dsadg-9bEz2J7PnsbB0B08txvsyUSvKlAQIDJiABIVggLKF5xS0_BntttUIrm2Z2tgZ4uQDwllbdIfrrBMABCNciWCDHwin8Zdkr56iSIh0MrB5qZiEzYLQpEOREhMUkY6q4Vw"
+const assertionCredentialId string = "AI7D5q2P0LS-Fal9ZT7CHM2N5BLbUunF92T8b6iYC199bO2kagSuU05-5dZGqb1SP0A0lyTWng"
+const assertionClientDataJson string = "eyJjaGFsbGVuZ2UiOiJFNFBUY0lIX0hmWDFwQzZTaWdrMVNDOU5BbGdlenROMDQzOXZpOHpfYzlrIiwibmV3X2tleXNfbWF5X2JlX2FkZGVkX2hlcmUiOiJkbyBub3QgY29tcGFyZSBjbGllbnREYXRhSlNPTiBhZ2FpbnN0IGEgdGVtcGxhdGUuIFNlZSBodHRwczovL2dvby5nbC95YWJQZXgiLCJvcmlnaW4iOiJodHRwczovL3dlYmF1dGhuLmlvIiwidHlwZSI6IndlYmF1dGhuLmdldCJ9"
+const assertionAuthenticatorData string = "dKbqkhPJnC90siSSsyDPQCYqlMGpUKA5fyklC2CEHvBFXJJiGa3OAAI1vMYKZIsLJfHwVQMANwCOw-atj9C0vhWpfWU-whzNjeQS21Lpxfdk_G-omAtffWztpGoErlNOfuXWRqm9Uj9ANJck1p6lAQIDJiABIVggKAhfsdHcBIc0KPgAcRyAIK_-Vi-nCXHkRHPNaCMBZ-4iWCBxB8fGYQSBONi9uvq0gv95dGWlhJrBwCsj_a4LJQKVHQ"
+const assertionSignature string = "MEUCIBtIVOQxzFYdyWQyxaLR0tik1TnuPhGVhXVSNgFwLmN5AiEAnxXdCq0UeAVGWxOaFcjBZ_mEZoXqNboY5IkQDdlWZYc"
+
+func decodeFixture(t *testing.T, value string) []byte {
+	t.Helper()
+	decoded, err := webauthnEncoding.DecodeString(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestParseRegistrationAttestation(t *testing.T) {
+	attestation, rest, err := cborDecode(decodeFixture(t, registrationAttestationObject))
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("cborDecode = %x, %v", rest, err)
+	}
+
+	attestationMap, ok := attestation.(map[any]any)
+	if !ok || attestationMap["fmt"] != "none" {
+		t.Fatalf("attestation object = %#v, want a map with none format", attestation)
+	}
+
+	authData, ok := attestationMap["authData"].([]byte)
+	if !ok {
+		t.Fatal("attestation object has no authenticator data")
+	}
+
+	data, err := parseAuthenticatorData(authData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = verifyAuthenticatorData(data, "webauthn.io")
+	if err != nil {
+		t.Errorf("verifyAuthenticatorData failed: %v", err)
+	}
+
+	err = verifyAuthenticatorData(data, "example.com")
+	if err == nil {
+		t.Error("verifyAuthenticatorData accepted another relying party")
+	}
+
+	if data.flags != authenticatorFlagUserPresent|authenticatorFlagAttestedCredential || data.signCount != 0 {
+		t.Errorf("flags = %#x, sign count = %d", data.flags, data.signCount)
+	}
+
+	if !bytes.Equal(data.credentialId, decodeFixture(t, registrationCredentialId)) {
+		t.Errorf("credential id = %x, want the raw id", data.credentialId)
+	}
+
+	algorithm, publicKey, err := parseCosePublicKey(data.publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := publicKey.(*ecdsa.PublicKey); algorithm != coseAlgorithmEs256 || !ok {
+		t.Errorf("public key = %d %T, want es256", algorithm, publicKey)
+	}
+}
+
+func TestParseAuthenticatorDataRejectsMalformed(t *testing.T) {
+	authData := decodeFixture(t, assertionAuthenticatorData)
+
+	tests := map[string][]byte{
+		"empty":                   {},
+		"truncated counter":       authData[:36],
+		"truncated aaguid":        authData[:50],
+		"truncated credential id": authData[:60],
+		"truncated public key":    authData[:len(authData)-1],
+		"zero length credential":  append(append([]byte{}, authData[:53]...), 0x00, 0x00),
+	}
+
+	for name, b := range tests {
+		_, err := parseAuthenticatorData(b)
+		if err == nil {
+			t.Errorf("%s: parseAuthenticatorData accepted malformed data", name)
+		}
+	}
+
+	data, err := parseAuthenticatorData(authData[:37])
+	if err == nil {
+		t.Error("parseAuthenticatorData accepted a missing credential while the attested credential flag is set")
+	}
+
+	withoutCredential := append([]byte{}, authData[:37]...)
+	withoutCredential[32] &^= authenticatorFlagAttestedCredential
+	data, err = parseAuthenticatorData(withoutCredential)
+	if err != nil || data.credentialId != nil || data.publicKey != nil {
+		t.Errorf("parseAuthenticatorData without a credential = %#v, %v", data, err)
+	}
+}
+
+func TestVerifyRecordedAssertion(t *testing.T) {
+	authData := decodeFixture(t, assertionAuthenticatorData)
+	clientDataJson := decodeFixture(t, assertionClientDataJson)
+
+	data, err := parseAuthenticatorData(authData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data.flags&authenticatorFlagUserVerified == 0 || data.signCount != 1553097241 {
+		t.Errorf("flags = %#x, sign count = %d", data.flags, data.signCount)
+	}
+
+	if !bytes.Equal(data.credentialId, decodeFixture(t, assertionCredentialId)) {
+		t.Errorf("credential id = %x, want the raw id", data.credentialId)
+	}
+
+	// touch id includes the credential in its assertions, which gives the key the signature was made with
+	algorithm, publicKey, err := parseCosePublicKey(data.publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passkey := Passkey{algorithm: algorithm, publicKey: publicKeyBytes}
+
+	clientDataHash := sha256.Sum256(clientDataJson)
+	signedData := append(append([]byte{}, authData...), clientDataHash[:]...)
+	signature := decodeFixture(t, assertionSignature)
+
+	err = verifyPasskeySignature(passkey, signedData, signature)
+	if err != nil {
+		t.Errorf("verifyPasskeySignature failed: %v", err)
+	}
+
+	tamperedData := append([]byte{}, signedData...)
+	tamperedData[33]++
+	err = verifyPasskeySignature(passkey, tamperedData, signature)
+	if err == nil {
+		t.Error("verifyPasskeySignature accepted a changed signature counter")
+	}
+
+	passkey.algorithm = coseAlgorithmRs256
+	err = verifyPasskeySignature(passkey, signedData, signature)
+	if err == nil {
+		t.Error("verifyPasskeySignature accepted an algorithm that does not match the key")
+	}
+}
+
+func TestVerifyRecordedClientData(t *testing.T) {
+	t.Cleanup(func() { passkeyChallenges = make(map[string]passkeyChallenge) })
+	expiry := time.Now().Add(passkeyChallengeExpiry)
+
+	passkeyChallenges["W8GzFU8pGjhoRbWrLDlamAfq_y4S1CZG1VuoeRLARrE"] = passkeyChallenge{username: "alice", registration: true, expiry: expiry}
+	err := verifyClientData(decodeFixture(t, registrationClientDataJson), "webauthn.create", "https://webauthn.io", "alice", true)
+	if err != nil {
+		t.Errorf("verifyClientData for registration failed: %v", err)
+	}
+
+	err = verifyClientData(decodeFixture(t, registrationClientDataJson), "webauthn.create", "https://webauthn.io", "alice", true)
+	if err == nil {
+		t.Error("verifyClientData accepted a challenge twice")
+	}
+
+	tests := []struct {
+		name      string
+		challenge passkeyChallenge
+		origin    string
+		username  string
+	}{
+		{"other origin", passkeyChallenge{registration: false, expiry: expiry}, "https://example.com", "alice"},
+		{"other user", passkeyChallenge{username: "bob", registration: false, expiry: expiry}, "https://webauthn.io", "alice"},
+		{"registration challenge", passkeyChallenge{registration: true, expiry: expiry}, "https://webauthn.io", "alice"},
+		{"expired", passkeyChallenge{registration: false, expiry: time.Now().Add(-time.Second)}, "https://webauthn.io", "alice"},
+	}
+
+	for _, test := range tests {
+		passkeyChallenges["E4PTcIH_HfX1pC6Sigk1SC9NAlgeztN0439vi8z_c9k"] = test.challenge
+		err = verifyClientData(decodeFixture(t, assertionClientDataJson), "webauthn.get", test.origin, test.username, false)
+		if err == nil {
+			t.Errorf("%s: verifyClientData accepted the assertion", test.name)
+		}
+	}
+
+	passkeyChallenges["E4PTcIH_HfX1pC6Sigk1SC9NAlgeztN0439vi8z_c9k"] = passkeyChallenge{registration: false, expiry: expiry}
+	err = verifyClientData(decodeFixture(t, assertionClientDataJson), "webauthn.get", "https://webauthn.io", "alice", false)
+	if err != nil {
+		t.Errorf("verifyClientData for a login without a username failed: %v", err)
+	}
+}
+
+func TestParseCosePublicKey(t *testing.T) {
+	edPublicKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	algorithm, publicKey, err := parseCosePublicKey(map[any]any{int64(1): int64(1), int64(3): coseAlgorithmEdDsa, int64(-1): int64(6), int64(-2): []byte(edPublicKey)})
+	if err != nil || algorithm != coseAlgorithmEdDsa || !edPublicKey.Equal(publicKey) {
+		t.Errorf("parseCosePublicKey for ed25519 = %d, %v, %v", algorithm, publicKey, err)
+	}
+
+	modulus := bytes.Repeat([]byte{0xff}, 256)
+	algorithm, publicKey, err = parseCosePublicKey(map[any]any{int64(1): int64(3), int64(3): coseAlgorithmRs256, int64(-1): modulus, int64(-2): []byte{0x01, 0x00, 0x01}})
+	if rsaKey, ok := publicKey.(*rsa.PublicKey); err != nil || algorithm != coseAlgorithmRs256 || !ok || rsaKey.E != 65537 {
+		t.Errorf("parseCosePublicKey for rsa = %d, %v, %v", algorithm, publicKey, err)
+	}
+
+	point := bytes.Repeat([]byte{0x01}, 32)
+	tests := map[string]map[any]any{
+		"unsupported algorithm":  {int64(1): int64(2), int64(3): int64(-35)},
+		"missing algorithm":      {int64(1): int64(2)},
+		"es256 wrong key type":   {int64(1): int64(1), int64(3): coseAlgorithmEs256, int64(-1): int64(1), int64(-2): point, int64(-3): point},
+		"es256 wrong curve":      {int64(1): int64(2), int64(3): coseAlgorithmEs256, int64(-1): int64(2), int64(-2): point, int64(-3): point},
+		"es256 short coordinate": {int64(1): int64(2), int64(3): coseAlgorithmEs256, int64(-1): int64(1), int64(-2): point[:31], int64(-3): point},
+		"es256 not on curve":     {int64(1): int64(2), int64(3): coseAlgorithmEs256, int64(-1): int64(1), int64(-2): point, int64(-3): point},
+		"ed25519 wrong curve":    {int64(1): int64(1), int64(3): coseAlgorithmEdDsa, int64(-1): int64(1), int64(-2): []byte(edPublicKey)},
+		"rsa short modulus":      {int64(1): int64(3), int64(3): coseAlgorithmRs256, int64(-1): modulus[:128], int64(-2): []byte{0x01, 0x00, 0x01}},
+		"rsa long exponent":      {int64(1): int64(3), int64(3): coseAlgorithmRs256, int64(-1): modulus, int64(-2): []byte{1, 0, 0, 0, 1}},
+	}
+
+	for name, coseKey := range tests {
+		_, _, err := parseCosePublicKey(coseKey)
+		if err == nil {
+			t.Errorf("%s: parseCosePublicKey accepted the key", name)
+		}
+	}
+}
+
+func TestNewPasskeyChallengeLimitsPerIp(t *testing.T) {
+	t.Cleanup(func() { passkeyChallenges = make(map[string]passkeyChallenge) })
+
+	for range passkeyMaxPendingChallengesPerIp {
+		_, err := newPasskeyChallenge("192.0.2.1", "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := newPasskeyChallenge("192.0.2.1", "", false)
+	if err != ErrPasskeyChallengeLimit {
+		t.Errorf("challenge past the per ip limit = %v, want ErrPasskeyChallengeLimit", err)
+	}
+
+	_, err = newPasskeyChallenge("192.0.2.2", "", false)
+	if err != nil {
+		t.Errorf("challenge for another ip failed: %v", err)
+	}
+
+	for challenge, pending := range passkeyChallenges {
+		if pending.ip == "192.0.2.1" {
+			pending.expiry = time.Now().Add(-time.Second)
+			passkeyChallenges[challenge] = pending
+		}
+	}
+
+	_, err = newPasskeyChallenge("192.0.2.1", "", false)
+	if err != nil {
+		t.Errorf("challenge after the pending ones expired failed: %v", err)
+	}
+}
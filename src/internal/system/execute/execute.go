@@ -8,11 +8,32 @@ import (
 	"os/exec"
 	"os/user"
 	"path"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
+	"unsafe"
 )
 
+var sharedRootPath string
+var homeRootPath string = "/home"
+
+func SetupSharedRootPath(rootPath string) {
+	sharedRootPath = path.Clean(rootPath)
+}
+
+func SetupHomeRootPath(rootPath string) {
+	homeRootPath = path.Clean(rootPath)
+}
+
+func GetHomeRootPath() string {
+	return homeRootPath
+}
+
+func GetHomePath(username string) string {
+	return path.Join(homeRootPath, username)
+}
+
 func Reboot() error {
 	cmd := exec.Command("systemctl", "reboot")
 	err := cmd.Run()
@@ -33,6 +54,43 @@ func Poweroff() error {
 	return nil
 }
 
+// properties of each unit as name=value lines, units are separated by a blank line
+func SystemctlShow(units []string, properties []string) (string, error) {
+	args := []string{"show", "--property=" + strings.Join(properties, ","), "--"}
+	cmd := exec.Command("systemctl", append(args, units...)...)
+	outputBytes, err := cmd.Output()
+	if err != nil {
+		return "", errors.Join(errors.New("failed to run systemctl show"), err)
+	}
+
+	return string(outputBytes), nil
+}
+
+// without waiting, the job is only queued, which is needed when the unit is the one running ground
+func SystemctlUnitAction(action string, unit string, wait bool) error {
+	args := []string{action}
+	if !wait {
+		args = append(args, "--no-block")
+	}
+	cmd := exec.Command("systemctl", append(args, "--", unit)...)
+	outputBytes, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to %s unit", action), errors.New(strings.TrimSpace(string(outputBytes))), err)
+	}
+
+	return nil
+}
+
+func JournalLines(unit string, lines uint) (string, error) {
+	cmd := exec.Command("journalctl", "--unit="+unit, "--lines="+strconv.FormatUint(uint64(lines), 10), "--no-pager", "--quiet", "--output=short-iso")
+	outputBytes, err := cmd.Output()
+	if err != nil {
+		return "", errors.Join(errors.New("failed to run journalctl"), err)
+	}
+
+	return string(outputBytes), nil
+}
+
 func GetUptime() (string, error) {
 	cmd := exec.Command("uptime", "--pretty")
 	outputBytes, err := cmd.Output()
@@ -44,7 +102,7 @@ func GetUptime() (string, error) {
 }
 
 func GetDiskSize() (string, error) {
-	cmd := exec.Command("df", "--human-readable", "--portability", "/home")
+	cmd := exec.Command("df", "--human-readable", "--portability", homeRootPath)
 	outputBytes, err := cmd.Output()
 	if err != nil {
 		return "", errors.Join(errors.New("failed to run df"), err)
@@ -63,19 +121,17 @@ func GetDiskSize() (string, error) {
 	return fields[1], nil
 }
 
-func GetDirectorySize(dirPath string) (string, error) {
+func GetDirectorySize(username string, dirPath string) (string, error) {
 	dirPath = path.Clean(dirPath)
 
-	dirInfo, err := os.Stat(dirPath)
-	if err != nil {
-		return "", errors.Join(errors.New("dir path not found"), err)
-	}
-
-	if !dirInfo.IsDir() {
-		return "", errors.New("path is not a directory")
+	cmd := exec.Command("du", "--summarize", "--human-readable", "--", dirPath)
+	if username != "" {
+		err := executeAs(cmd, username)
+		if err != nil {
+			return "", errors.Join(errors.New("failed to set command executor"), err)
+		}
 	}
 
-	cmd := exec.Command("du", "--summarize", "--human-readable", dirPath)
 	outputBytes, err := cmd.Output()
 	if err != nil {
 		return "", errors.Join(errors.New("failed to run du"), err)
@@ -99,40 +155,64 @@ func FileSearch(filePath string, searchRegex string) error {
 	return nil
 }
 
-func FileLineDelete(filePath string, indexString string) error {
-	filePath = path.Clean(filePath)
-	_, err := os.Stat(filePath)
+func GetGroups(username string) ([]string, error) {
+	cmd := exec.Command("groups", username)
+	outputBytes, err := cmd.Output()
 	if err != nil {
-		return errors.Join(errors.New("file path not found"), err)
+		return nil, errors.Join(errors.New("failed get groups output"), err)
 	}
 
-	index, err := strconv.Atoi(indexString)
+	return strings.Fields(string(outputBytes)), nil
+}
+
+func GetGroupMembers(groupname string) ([]string, error) {
+	cmd := exec.Command("getent", "group", groupname)
+	outputBytes, err := cmd.Output()
 	if err != nil {
-		return errors.Join(errors.New("index is not a number"), err)
+		return nil, errors.Join(errors.New("failed get group output"), err)
 	}
 
-	if index < 0 {
-		return errors.New("index is less than zero")
+	fields := strings.Split(strings.TrimSpace(string(outputBytes)), ":")
+	if len(fields) != 4 {
+		return nil, errors.New("group output does not have four fields")
 	}
 
-	cmd := exec.Command("sed", "--in-place", fmt.Sprintf("%dd", index+1), filePath)
+	if fields[3] == "" {
+		return []string{}, nil
+	}
 
-	err = cmd.Run()
+	return strings.Split(fields[3], ","), nil
+}
+
+func GroupIsPrimary(gid int) (bool, error) {
+	cmd := exec.Command("getent", "passwd")
+	outputBytes, err := cmd.Output()
 	if err != nil {
-		return errors.Join(errors.New("failed run sed"), err)
+		return false, errors.Join(errors.New("failed get passwd output"), err)
 	}
 
-	return nil
+	for line := range strings.Lines(string(outputBytes)) {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != 7 {
+			continue
+		}
+
+		if fields[3] == strconv.Itoa(gid) {
+			return true, nil
+		}
+	}
+
+	return false, nil
 }
 
-func GetGroups(username string) ([]string, error) {
-	cmd := exec.Command("groups", username)
-	outputBytes, err := cmd.Output()
+func GroupCreate(groupname string) error {
+	cmd := exec.Command("groupadd", "--force", groupname)
+	err := cmd.Run()
 	if err != nil {
-		return nil, errors.Join(errors.New("failed get groups output"), err)
+		return errors.Join(errors.New("failed to create group"), err)
 	}
 
-	return strings.Fields(string(outputBytes)), nil
+	return nil
 }
 
 func GroupAdd(username string, groupname string) error {
@@ -156,24 +236,19 @@ func GroupDelete(username string, groupname string) error {
 }
 
 func UserAdd(username string) error {
-	homePath := path.Join("/home", username)
+	homePath := GetHomePath(username)
 	_, err := os.Stat(homePath)
 	if err == nil {
 		return errors.New("user already exists")
 	}
 
-	cmd := exec.Command("useradd", "--create-home", username)
+	cmd := exec.Command("useradd", "--create-home", "--base-dir", homeRootPath, username)
 
 	err = cmd.Run()
 	if err != nil {
 		return errors.Join(errors.New("failed to create user"), err)
 	}
 
-	err = PasswordSet(username, "password")
-	if err != nil {
-		return errors.Join(errors.New("failed to set user password"), err)
-	}
-
 	return nil
 }
 
@@ -213,6 +288,33 @@ func PasswordSet(username string, password string) error {
 	return nil
 }
 
+// expires the password so it has to be changed at the next login, for ssh as well as ground
+func PasswordExpire(username string) error {
+	cmd := exec.Command("chage", "--lastday", "0", username)
+	err := cmd.Run()
+	if err != nil {
+		return errors.Join(errors.New("failed to run chage"), err)
+	}
+
+	return nil
+}
+
+func PasswordIsExpired(username string) (bool, error) {
+	cmd := exec.Command("getent", "shadow", username)
+	outputBytes, err := cmd.Output()
+	if err != nil {
+		return false, errors.Join(errors.New("failed get shadow output"), err)
+	}
+
+	fields := strings.Split(strings.TrimSpace(string(outputBytes)), ":")
+	if len(fields) != 9 {
+		return false, errors.New("shadow output does not have nine fields")
+	}
+
+	// a last change day of zero means the change is forced
+	return fields[2] == "0", nil
+}
+
 func TestRunAs(username string, password string) error {
 	if strings.ContainsAny(password, "\n") {
 		return errors.New("password is not valid")
@@ -241,8 +343,8 @@ func TestRunAs(username string, password string) error {
 func Move(username string, sourcePath string, destinationPath string) error {
 	sourcePath = path.Clean(sourcePath)
 
-	if !strings.HasPrefix(sourcePath, path.Join("/home", username)) {
-		return errors.New("source path is not in home directory")
+	if !isAllowedPath(username, sourcePath) {
+		return errors.New("source path is not in an allowed directory")
 	}
 
 	_, err := os.Stat(sourcePath)
@@ -252,8 +354,8 @@ func Move(username string, sourcePath string, destinationPath string) error {
 
 	destinationPath = path.Clean(destinationPath)
 
-	if !strings.HasPrefix(destinationPath, path.Join("/home", username)) {
-		return errors.New("destination path is not in home directory")
+	if !isAllowedPath(username, destinationPath) {
+		return errors.New("destination path is not in an allowed directory")
 	}
 
 	_, err = os.Stat(destinationPath)
@@ -267,7 +369,7 @@ func Move(username string, sourcePath string, destinationPath string) error {
 		return errors.Join(errors.New("failed to create parent directory"), err)
 	}
 
-	cmd := exec.Command("mv", sourcePath, destinationPath)
+	cmd := newCommand(destinationPath, "mv", sourcePath, destinationPath)
 
 	err = executeAs(cmd, username)
 	if err != nil {
@@ -285,8 +387,8 @@ func Move(username string, sourcePath string, destinationPath string) error {
 func TouchFile(username string, filePath string) error {
 	filePath = path.Clean(filePath)
 
-	if !strings.HasPrefix(filePath, path.Join("/home", username)) {
-		return errors.New("file path is not in home directory")
+	if !isAllowedPath(username, filePath) {
+		return errors.New("file path is not in an allowed directory")
 	}
 
 	_, err := os.Stat(filePath)
@@ -301,7 +403,7 @@ func TouchFile(username string, filePath string) error {
 		return errors.Join(errors.New("failed to create parent directory"), err)
 	}
 
-	cmd := exec.Command("touch", filePath)
+	cmd := newCommand(filePath, "touch", filePath)
 
 	err = executeAs(cmd, username)
 	if err != nil {
@@ -319,11 +421,11 @@ func TouchFile(username string, filePath string) error {
 func MakeDirectory(username string, dirPath string) error {
 	dirPath = path.Clean(dirPath)
 
-	if !strings.HasPrefix(dirPath, path.Join("/home", username)) {
-		return errors.New("dir path is not in home directory")
+	if !isAllowedPath(username, dirPath) {
+		return errors.New("dir path is not in an allowed directory")
 	}
 
-	cmd := exec.Command("mkdir", "-p", dirPath)
+	cmd := newCommand(dirPath, "mkdir", "-p", dirPath)
 
 	err := executeAs(cmd, username)
 	if err != nil {
@@ -341,8 +443,8 @@ func MakeDirectory(username string, dirPath string) error {
 func TarCompressDirectory(username string, dirPath string, filePath string) error {
 	dirPath = path.Clean(dirPath)
 
-	if !strings.HasPrefix(dirPath, path.Join("/home", username)) {
-		return errors.New("dir path is not in home directory")
+	if !isAllowedPath(username, dirPath) {
+		return errors.New("dir path is not in an allowed directory")
 	}
 
 	dirInfo, err := os.Stat(dirPath)
@@ -356,8 +458,8 @@ func TarCompressDirectory(username string, dirPath string, filePath string) erro
 
 	filePath = path.Clean(filePath)
 
-	if !strings.HasPrefix(filePath, path.Join("/home", username)) {
-		return errors.New("file path is not in home directory")
+	if !isAllowedPath(username, filePath) {
+		return errors.New("file path is not in an allowed directory")
 	}
 
 	if !strings.HasSuffix(filePath, ".tar.gz") {
@@ -369,7 +471,7 @@ func TarCompressDirectory(username string, dirPath string, filePath string) erro
 		return errors.Join(errors.New("file path already exists"), err)
 	}
 
-	cmd := exec.Command("tar", "-zchf", filePath, "--directory", dirPath, ".")
+	cmd := newCommand(filePath, "tar", "-zchf", filePath, "--directory", dirPath, ".")
 
 	err = executeAs(cmd, username)
 	if err != nil {
@@ -387,8 +489,8 @@ func TarCompressDirectory(username string, dirPath string, filePath string) erro
 func TarExtractFile(username string, filePath string, dirPath string) error {
 	filePath = path.Clean(filePath)
 
-	if !strings.HasPrefix(filePath, path.Join("/home", username)) {
-		return errors.New("file path is not in home directory")
+	if !isAllowedPath(username, filePath) {
+		return errors.New("file path is not in an allowed directory")
 	}
 
 	if !strings.HasSuffix(filePath, ".tar.gz") {
@@ -409,7 +511,7 @@ func TarExtractFile(username string, filePath string, dirPath string) error {
 		return errors.Join(errors.New("failed to create extract directory"), err)
 	}
 
-	cmd := exec.Command("tar", "-xzf", filePath, "--directory", dirPath)
+	cmd := newCommand(dirPath, "tar", "-xzf", filePath, "--directory", dirPath)
 
 	err = executeAs(cmd, username)
 	if err != nil {
@@ -424,27 +526,156 @@ func TarExtractFile(username string, filePath string, dirPath string) error {
 	return nil
 }
 
+func isAllowedPath(username string, fullPath string) bool {
+	fullPath = path.Clean(fullPath)
+	homePath := GetHomePath(username)
+	if fullPath == homePath || strings.HasPrefix(fullPath, homePath+"/") {
+		return true
+	}
+
+	return isSharedPath(fullPath)
+}
+
+func isSharedPath(fullPath string) bool {
+	return sharedRootPath != "" && strings.HasPrefix(path.Clean(fullPath), sharedRootPath+"/")
+}
+
+// space members share files through the group, so anything created in a space has to be group writable
+func newCommand(targetPath string, name string, args ...string) *exec.Cmd {
+	if !isSharedPath(targetPath) {
+		return exec.Command(name, args...)
+	}
+
+	// the umask is per process, setting it in ground would race with every other request
+	return exec.Command("sh", append([]string{"-c", `umask 002 && exec "$@"`, "sh", name}, args...)...)
+}
+
 func executeAs(cmd *exec.Cmd, username string) error {
+	credential, err := lookupCredential(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to lookup credential"), err)
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: credential,
+	}
+
+	return nil
+}
+
+// runs fn with the filesystem uid, gid, and supplementary groups of the user
+// the credentials only apply to the locked os thread, fn must not hand file work to other goroutines
+func AsUser(username string, fn func() error) error {
+	credential, err := lookupCredential(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to lookup credential"), err)
+	}
+
+	runtime.LockOSThread()
+
+	rootGroups, err := syscall.Getgroups()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return errors.Join(errors.New("failed to get groups"), err)
+	}
+
+	err = setThreadCredential(credential.Uid, credential.Gid, credential.Groups)
+	if err != nil {
+		// thread credentials are unknown, leave it locked so it exits with the goroutine
+		return errors.Join(errors.New("failed to set thread credential"), err)
+	}
+
+	defer func() {
+		var groups []uint32
+		for _, group := range rootGroups {
+			groups = append(groups, uint32(group))
+		}
+
+		if setThreadCredential(0, 0, groups) == nil {
+			runtime.UnlockOSThread()
+		}
+	}()
+
+	return fn()
+}
+
+func lookupCredential(username string) (*syscall.Credential, error) {
 	user, err := user.Lookup(username)
 	if err != nil {
-		return errors.Join(errors.New("failed to lookup user"), err)
+		return nil, errors.Join(errors.New("failed to lookup user"), err)
 	}
 
 	uid64, err := strconv.ParseUint(user.Uid, 10, 32)
 	if err != nil {
-		return errors.Join(errors.New("failed to parse uid"), err)
+		return nil, errors.Join(errors.New("failed to parse uid"), err)
 	}
 
 	gid64, err := strconv.ParseUint(user.Gid, 10, 32)
 	if err != nil {
-		return errors.Join(errors.New("failed to parse gid"), err)
+		return nil, errors.Join(errors.New("failed to parse gid"), err)
 	}
 
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Credential: &syscall.Credential{
-			Uid: uint32(uid64),
-			Gid: uint32(gid64),
-		},
+	groupIds, err := user.GroupIds()
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to lookup groups"), err)
+	}
+
+	var groups []uint32
+	for _, groupId := range groupIds {
+		groupId64, err := strconv.ParseUint(groupId, 10, 32)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to parse group id"), err)
+		}
+		groups = append(groups, uint32(groupId64))
+	}
+
+	return &syscall.Credential{
+		Uid:    uint32(uid64),
+		Gid:    uint32(gid64),
+		Groups: groups,
+	}, nil
+}
+
+// raw syscalls only change the calling thread, unlike syscall.Setgroups which changes every thread
+func setThreadCredential(uid uint32, gid uint32, groups []uint32) error {
+	var groupsPtr uintptr
+	if len(groups) > 0 {
+		groupsPtr = uintptr(unsafe.Pointer(&groups[0]))
+	}
+
+	// regain root filesystem capabilities before changing groups
+	if uid == 0 {
+		err := setThreadFsId(syscall.SYS_SETFSUID, uid)
+		if err != nil {
+			return errors.Join(errors.New("failed to set fsuid"), err)
+		}
+	}
+
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SETGROUPS, uintptr(len(groups)), groupsPtr, 0)
+	if errno != 0 {
+		return errors.Join(errors.New("failed to set groups"), errno)
+	}
+
+	err := setThreadFsId(syscall.SYS_SETFSGID, gid)
+	if err != nil {
+		return errors.Join(errors.New("failed to set fsgid"), err)
+	}
+
+	err = setThreadFsId(syscall.SYS_SETFSUID, uid)
+	if err != nil {
+		return errors.Join(errors.New("failed to set fsuid"), err)
+	}
+
+	return nil
+}
+
+func setThreadFsId(trap uintptr, id uint32) error {
+	syscall.RawSyscall(trap, uintptr(id), 0, 0)
+
+	// setfsuid/setfsgid never report errors, an invalid id returns the current value instead
+	current, _, _ := syscall.RawSyscall(trap, ^uintptr(0), 0, 0)
+	if uint32(current) != id {
+		return fmt.Errorf("id is %d instead of %d", uint32(current), id)
 	}
 
 	return nil
@@ -8,13 +8,14 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/grantfbarnes/ground/internal/system/execute"
 )
 
-func UploadFile(r *http.Request, dirPath string, username string) error {
+func UploadFile(r *http.Request, resolver PathResolver, relDirPath string, username string, overwrite bool) error {
 	mediaType, contentParams, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
 	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
 		return errors.Join(errors.New("failed to pares media type"), err)
@@ -35,7 +36,7 @@ func UploadFile(r *http.Request, dirPath string, username string) error {
 			return errors.Join(errors.New("failed to get next file part"), err)
 		}
 
-		err = createFileFromPart(part, dirPath, username)
+		err = createFileFromPart(part, resolver, relDirPath, username, overwrite)
 		if err != nil {
 			return errors.Join(errors.New("failed to create file"), err)
 		}
@@ -44,7 +45,7 @@ func UploadFile(r *http.Request, dirPath string, username string) error {
 	return nil
 }
 
-func createFileFromPart(part *multipart.Part, dirPath string, username string) error {
+func createFileFromPart(part *multipart.Part, resolver PathResolver, relDirPath string, username string, overwrite bool) error {
 	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
 	if err != nil {
 		return errors.Join(errors.New("failed to get content disposition"), err)
@@ -54,19 +55,35 @@ func createFileFromPart(part *multipart.Part, dirPath string, username string) e
 	if !ok {
 		return errors.New("filename not found in content disposition")
 	}
-	fileDirRelPath, fileName := path.Split(fileRelPath)
-	fileDirPath := path.Join(dirPath, fileDirRelPath)
+	fileDirRelPath, fileName := path.Split(path.Join("/", relDirPath, fileRelPath))
+	fileDirPath, err := resolver.Resolve(fileDirRelPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to resolve parent directory"), err)
+	}
 
 	err = execute.MakeDirectory(username, fileDirPath)
 	if err != nil {
 		return errors.Join(errors.New("failed to create parent directory"), err)
 	}
 
-	fileName, err = getAvailableFileName(fileDirPath, fileName)
+	filePath, err := resolver.Resolve(path.Join(fileDirRelPath, fileName))
 	if err != nil {
-		return errors.Join(errors.New("failed to find available file name"), err)
+		return errors.Join(errors.New("failed to resolve file path"), err)
+	}
+
+	fileInfo, err := os.Stat(filePath)
+	if err == nil && overwrite && !fileInfo.IsDir() {
+		err = saveVersion(username, filePath)
+		if err != nil {
+			return errors.Join(errors.New("failed to save previous version"), err)
+		}
+	} else {
+		fileName, err = getAvailableFileName(fileDirPath, fileName)
+		if err != nil {
+			return errors.Join(errors.New("failed to find available file name"), err)
+		}
+		filePath = path.Join(fileDirPath, fileName)
 	}
-	filePath := path.Join(fileDirPath, fileName)
 
 	err = createMultipartFile(part, filePath, username)
 	if err != nil {
@@ -82,22 +99,35 @@ func createMultipartFile(part *multipart.Part, filePath string, username string)
 		return errors.Join(errors.New("failed to create file"), err)
 	}
 
-	osFile, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
+	return execute.AsUser(username, func() error {
+		osFile, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return errors.Join(errors.New("failed to open file"), err)
+		}
+		defer osFile.Close()
+
+		_, err = io.Copy(osFile, part)
+		if err != nil {
+			// an interrupted or oversized upload should not leave half a file behind
+			_ = os.Remove(filePath)
+			return errors.Join(errors.New("failed to copy file data"), err)
+		}
+
+		return nil
+	})
+}
+
+func CreateDirectory(username string, resolver PathResolver, relPath string, dirName string) error {
+	rootDirPath, err := resolver.Resolve(relPath)
 	if err != nil {
-		return errors.Join(errors.New("failed to open file"), err)
+		return errors.Join(errors.New("failed to resolve path"), err)
 	}
-	defer osFile.Close()
 
-	_, err = io.Copy(osFile, part)
+	dirPath, err := resolver.Resolve(path.Join(relPath, dirName))
 	if err != nil {
-		return errors.Join(errors.New("failed to copy file data"), err)
+		return errors.Join(errors.New("failed to resolve directory path"), err)
 	}
 
-	return nil
-}
-
-func CreateDirectory(username string, relHomePath string, dirName string) error {
-	rootDirPath := path.Join("/home", username, relHomePath)
 	dirInfo, err := os.Stat(rootDirPath)
 	if err != nil {
 		return errors.Join(errors.New("failed to get path stat"), err)
@@ -107,7 +137,7 @@ func CreateDirectory(username string, relHomePath string, dirName string) error
 		return errors.New("path is not a directory")
 	}
 
-	err = execute.MakeDirectory(username, path.Join(rootDirPath, dirName))
+	err = execute.MakeDirectory(username, dirPath)
 	if err != nil {
 		return errors.Join(errors.New("failed to create directory"), err)
 	}
@@ -115,8 +145,12 @@ func CreateDirectory(username string, relHomePath string, dirName string) error
 	return nil
 }
 
-func CompressDirectory(username string, relHomePath string) error {
-	dirPath := path.Join("/home", username, relHomePath)
+func CompressDirectory(username string, resolver PathResolver, relPath string) error {
+	dirPath, err := resolver.Resolve(relPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to resolve path"), err)
+	}
+
 	dirParentPath, dirName := path.Split(dirPath)
 	fileName, err := getAvailableFileName(dirParentPath, dirName+".tar.gz")
 	if err != nil {
@@ -132,8 +166,12 @@ func CompressDirectory(username string, relHomePath string) error {
 	return nil
 }
 
-func ExtractFile(username string, relHomePath string) error {
-	filePath := path.Join("/home", username, relHomePath)
+func ExtractFile(username string, resolver PathResolver, relPath string) error {
+	filePath, err := resolver.Resolve(relPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to resolve path"), err)
+	}
+
 	fileParentPath, fileName := path.Split(filePath)
 	fileNameNoExt, _ := getFileExtension(fileName)
 	dirName, err := getAvailableFileName(fileParentPath, fileNameNoExt)
@@ -151,7 +189,7 @@ func ExtractFile(username string, relHomePath string) error {
 }
 
 func CreateRequiredFiles(username string) error {
-	homePath := path.Join("/home", username)
+	homePath := execute.GetHomePath(username)
 
 	err := execute.MakeDirectory(username, path.Join(homePath, TRASH_HOME_PATH))
 	if err != nil {
@@ -166,28 +204,38 @@ func CreateRequiredFiles(username string) error {
 	return nil
 }
 
-func Move(username string, sourceRelHomePath string, destinationRelHomePath string) error {
-	sourcePath := path.Join("/home", username, sourceRelHomePath)
-	_, err := os.Stat(sourcePath)
+func Move(username string, resolver PathResolver, sourceRelPath string, destinationRelPath string, conflictResolution string) error {
+	sourcePath, err := resolver.ResolveLink(sourceRelPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to resolve source path"), err)
+	}
+
+	_, err = os.Lstat(sourcePath)
 	if err != nil {
 		return errors.Join(errors.New("failed to get source path stat"), err)
 	}
 
-	destinationPath := path.Join("/home", username, destinationRelHomePath)
-	_, err = os.Stat(destinationPath)
-	if err == nil {
-		return errors.New("destination already exists")
+	destinationPath, err := resolver.ResolveLink(destinationRelPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to resolve destination path"), err)
 	}
 
-	sourceParentPath, sourceName := path.Split(sourcePath)
-	destinationParentPath, destinationName := path.Split(destinationPath)
+	if sourcePath == destinationPath {
+		return errors.New("source and destination are the same")
+	}
 
-	if sourceName != destinationName {
-		return errors.New("source and destination names do not match")
+	if strings.HasPrefix(destinationPath, sourcePath+"/") {
+		return errors.New("destination is inside of source")
 	}
 
-	if sourceParentPath == destinationParentPath {
-		return errors.New("source and destination are the same")
+	destinationPath, err = resolveConflict(username, resolver, sourcePath, destinationPath, conflictResolution)
+	if err != nil {
+		return errors.Join(errors.New("failed to resolve destination conflict"), err)
+	}
+
+	if destinationPath == "" {
+		// skip conflicting item
+		return nil
 	}
 
 	err = execute.Move(username, sourcePath, destinationPath)
@@ -198,23 +246,44 @@ func Move(username string, sourceRelHomePath string, destinationRelHomePath stri
 	return nil
 }
 
-func Rename(username string, relHomePath string, oldName string, newName string) error {
-	parentDirPath := path.Join("/home", username, relHomePath)
-	_, err := os.Stat(parentDirPath)
+func Rename(username string, resolver PathResolver, relPath string, oldName string, newName string, conflictResolution string) error {
+	if strings.Contains(oldName, "/") || strings.Contains(newName, "/") {
+		return errors.New("name cannot contain a path separator")
+	}
+
+	parentDirPath, err := resolver.Resolve(relPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to resolve parent dir path"), err)
+	}
+
+	_, err = os.Stat(parentDirPath)
 	if err != nil {
 		return errors.Join(errors.New("parent dir path not found"), err)
 	}
 
-	oldPath := path.Join(parentDirPath, oldName)
-	_, err = os.Stat(oldPath)
+	oldPath, err := resolver.ResolveLink(path.Join(relPath, oldName))
+	if err != nil {
+		return errors.Join(errors.New("failed to resolve old path"), err)
+	}
+
+	_, err = os.Lstat(oldPath)
 	if err != nil {
 		return errors.Join(errors.New("old path not found"), err)
 	}
 
-	newPath := path.Join(parentDirPath, newName)
-	_, err = os.Stat(newPath)
-	if err == nil {
-		return errors.Join(errors.New("new path already exists"), err)
+	newPath, err := resolver.ResolveLink(path.Join(relPath, newName))
+	if err != nil {
+		return errors.Join(errors.New("failed to resolve new path"), err)
+	}
+
+	newPath, err = resolveConflict(username, resolver, oldPath, newPath, conflictResolution)
+	if err != nil {
+		return errors.Join(errors.New("failed to resolve new path conflict"), err)
+	}
+
+	if newPath == "" {
+		// skip conflicting item
+		return nil
 	}
 
 	err = execute.Move(username, oldPath, newPath)
@@ -225,14 +294,41 @@ func Rename(username string, relHomePath string, oldName string, newName string)
 	return nil
 }
 
-func Trash(username string, relHomePath string) error {
-	rootDirPath := path.Join("/home", username, relHomePath)
-	_, err := os.Stat(rootDirPath)
+func Trash(username string, resolver PathResolver, relPath string) error {
+	rootDirPath, err := resolver.ResolveLink(relPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to resolve path"), err)
+	}
+
+	if rootDirPath == resolver.RootPath() {
+		return errors.New("cannot trash root directory")
+	}
+
+	err = trashPath(username, rootDirPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to trash path"), err)
+	}
+
+	return nil
+}
+
+// trashed items go to the trash of the space they are in, otherwise to the trash in the user's home
+func getTrashRootPath(username string, fullPath string) string {
+	spaceRootPath := getSpaceRootPath(fullPath)
+	if spaceRootPath != "" {
+		return path.Join(spaceRootPath, SPACE_TRASH_PATH)
+	}
+
+	return path.Join(execute.GetHomePath(username), TRASH_HOME_PATH)
+}
+
+func trashPath(username string, rootDirPath string) error {
+	_, err := os.Lstat(rootDirPath)
 	if err != nil {
 		return errors.Join(errors.New("failed to get path stat"), err)
 	}
 
-	trashRootPath := path.Join("/home", username, TRASH_HOME_PATH)
+	trashRootPath := getTrashRootPath(username, rootDirPath)
 	trashTimestamp := time.Now().Format(systemTimeLayout)
 	trashTimestampPath := path.Join(trashRootPath, trashTimestamp)
 	err = execute.MakeDirectory(username, trashTimestampPath)
@@ -257,7 +353,7 @@ func Trash(username string, relHomePath string) error {
 		return errors.Join(errors.New("failed to create restore path file"), err)
 	}
 
-	err = os.WriteFile(trashRestorePathFilePath, []byte(restorePath), 0644)
+	err = writeFileAs(username, trashRestorePathFilePath, []byte(restorePath), 0644)
 	if err != nil {
 		return errors.Join(errors.New("failed to write to restore path file"), err)
 	}
@@ -265,30 +361,41 @@ func Trash(username string, relHomePath string) error {
 	return nil
 }
 
-func Restore(username string, trashDirName string) error {
+func Restore(username string, resolver PathResolver, trashDirName string, destinationRelPath string) error {
 	if !trashDirNameRegex.MatchString(trashDirName) {
 		return errors.New("trash dir name is not valid")
 	}
 
-	trashDirPath := path.Join("/home", username, TRASH_HOME_PATH, trashDirName)
+	trashDirPath := path.Join(getTrashRootPath(username, resolver.RootPath()), trashDirName)
 	_, err := os.Stat(trashDirPath)
 	if err != nil {
 		return errors.Join(errors.New("failed to find trash dir"), err)
 	}
 
-	restoreFilePath := path.Join(trashDirPath, trashRestorePathFileName)
-	restorePathBytes, err := os.ReadFile(restoreFilePath)
-	if err != nil {
-		return errors.Join(errors.New("failed to read restore path"), err)
+	var restorePath string
+	if destinationRelPath != "" {
+		restorePath, err = resolver.Resolve(destinationRelPath)
+		if err != nil {
+			return errors.Join(errors.New("failed to resolve destination"), err)
+		}
+	} else {
+		restorePath, err = getTrashRestorePath(username, trashDirPath)
+		if err != nil {
+			return errors.Join(errors.New("failed to get restore path"), err)
+		}
+	}
+
+	// the restore path file can be edited by anyone who can write to the trash
+	if !resolver.Contains(restorePath) {
+		return ErrPathOutsideRoot
 	}
-	restorePath := string(restorePathBytes)
 
 	err = execute.MakeDirectory(username, restorePath)
 	if err != nil {
 		return errors.Join(errors.New("failed to create restore path"), err)
 	}
 
-	dirEntries, err := os.ReadDir(trashDirPath)
+	dirEntries, err := readDirAs(username, trashDirPath)
 	if err != nil {
 		return errors.Join(errors.New("failed to read directory"), err)
 	}
@@ -309,7 +416,7 @@ func Restore(username string, trashDirName string) error {
 		}
 	}
 
-	err = os.RemoveAll(trashDirPath)
+	err = removeAllAs(username, trashDirPath)
 	if err != nil {
 		return errors.Join(errors.New("failed to remove dir path"), err)
 	}
@@ -317,17 +424,50 @@ func Restore(username string, trashDirName string) error {
 	return nil
 }
 
-func EmptyTrash(username string) error {
-	trashRootPath := path.Join("/home", username, TRASH_HOME_PATH)
+func DeleteTrash(username string, resolver PathResolver, trashDirName string) error {
+	if !trashDirNameRegex.MatchString(trashDirName) {
+		return errors.New("trash dir name is not valid")
+	}
 
-	dirEntries, err := os.ReadDir(trashRootPath)
+	trashDirPath := path.Join(getTrashRootPath(username, resolver.RootPath()), trashDirName)
+	_, err := os.Stat(trashDirPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to find trash dir"), err)
+	}
+
+	err = removeAllAs(username, trashDirPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to remove dir path"), err)
+	}
+
+	return nil
+}
+
+func getTrashRestorePath(username string, trashDirPath string) (string, error) {
+	restoreFilePath := path.Join(trashDirPath, trashRestorePathFileName)
+	var restorePathBytes []byte
+	err := execute.AsUser(username, func() error {
+		var err error
+		restorePathBytes, err = os.ReadFile(restoreFilePath)
+		return err
+	})
+	if err != nil {
+		return "", errors.Join(errors.New("failed to read restore path"), err)
+	}
+	return string(restorePathBytes), nil
+}
+
+func EmptyTrash(username string, resolver PathResolver) error {
+	trashRootPath := getTrashRootPath(username, resolver.RootPath())
+
+	dirEntries, err := readDirAs(username, trashRootPath)
 	if err != nil {
 		return errors.Join(errors.New("failed to read directory"), err)
 	}
 
 	for _, entry := range dirEntries {
 		entryFullPath := path.Join(trashRootPath, entry.Name())
-		err = os.RemoveAll(entryFullPath)
+		err = removeAllAs(username, entryFullPath)
 		if err != nil {
 			return errors.Join(errors.New("failed to remove all files"), err)
 		}
@@ -335,3 +475,76 @@ func EmptyTrash(username string) error {
 
 	return nil
 }
+
+func PurgeTrash(username string) error {
+	return purgeTrashRoot(username, path.Join(execute.GetHomePath(username), TRASH_HOME_PATH))
+}
+
+// space trash is purged as one of the members, a space without members is left alone
+func PurgeSpaceTrash(space Space) error {
+	if len(space.Members) == 0 {
+		return nil
+	}
+
+	return purgeTrashRoot(space.Members[0], path.Join(space.RootPath, SPACE_TRASH_PATH))
+}
+
+func purgeTrashRoot(username string, trashRootPath string) error {
+	dirEntries, err := readDirAs(username, trashRootPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return errors.Join(errors.New("failed to read directory"), err)
+	}
+
+	// timestamp names sort oldest to newest
+	var trashDirNames []string
+	for _, entry := range dirEntries {
+		if entry.IsDir() && trashDirNameRegex.MatchString(entry.Name()) {
+			trashDirNames = append(trashDirNames, entry.Name())
+		}
+	}
+	sort.Strings(trashDirNames)
+
+	maxAge := time.Duration(trashMaxAge.Load())
+	maxSize := trashMaxSize.Load()
+
+	if maxAge > 0 {
+		expiry := time.Now().Add(-maxAge)
+		for len(trashDirNames) > 0 {
+			trashedTime, err := time.ParseInLocation(systemTimeLayout, trashDirNames[0], time.Local)
+			if err != nil || trashedTime.After(expiry) {
+				break
+			}
+
+			err = removeAllAs(username, path.Join(trashRootPath, trashDirNames[0]))
+			if err != nil {
+				return errors.Join(errors.New("failed to remove expired trash dir"), err)
+			}
+			trashDirNames = trashDirNames[1:]
+		}
+	}
+
+	if maxSize > 0 {
+		var totalSize int64
+		trashDirSizes := make([]int64, len(trashDirNames))
+		for i, trashDirName := range trashDirNames {
+			trashDirSizes[i], err = getDirectorySizeAs(username, path.Join(trashRootPath, trashDirName))
+			if err != nil {
+				return errors.Join(errors.New("failed to get trash dir size"), err)
+			}
+			totalSize += trashDirSizes[i]
+		}
+
+		for i := 0; i < len(trashDirNames) && totalSize > maxSize; i++ {
+			err = removeAllAs(username, path.Join(trashRootPath, trashDirNames[i]))
+			if err != nil {
+				return errors.Join(errors.New("failed to remove oldest trash dir"), err)
+			}
+			totalSize -= trashDirSizes[i]
+		}
+	}
+
+	return nil
+}
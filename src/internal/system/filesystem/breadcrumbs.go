@@ -13,14 +13,18 @@ type FilePathBreadcrumb struct {
 }
 
 func GetFileBreadcrumbs(relPath string) []FilePathBreadcrumb {
-	return getBreadcrumbs("home", relPath)
+	return getBreadcrumbs("home", relPath, false)
 }
 
 func GetTrashBreadcrumbs(relPath string) []FilePathBreadcrumb {
-	return getBreadcrumbs("trash", relPath)
+	return getBreadcrumbs("trash", relPath, true)
 }
 
-func getBreadcrumbs(homeName string, relPath string) []FilePathBreadcrumb {
+func GetSharedBreadcrumbs(rootName string, relPath string) []FilePathBreadcrumb {
+	return getBreadcrumbs(rootName, relPath, false)
+}
+
+func getBreadcrumbs(homeName string, relPath string, skipTopDir bool) []FilePathBreadcrumb {
 	breadcrumbPath := "/"
 	FilePathBreadcrumbs := []FilePathBreadcrumb{
 		{
@@ -35,7 +39,7 @@ func getBreadcrumbs(homeName string, relPath string) []FilePathBreadcrumb {
 			continue
 		}
 
-		if homeName == "trash" && breadcrumbPath == "/" {
+		if skipTopDir && breadcrumbPath == "/" {
 			breadcrumbPath = path.Join(breadcrumbPath, breadcrumbDir)
 		} else {
 			breadcrumbPath = path.Join(breadcrumbPath, breadcrumbDir)
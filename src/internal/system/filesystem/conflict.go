@@ -0,0 +1,123 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/grantfbarnes/ground/internal/system/execute"
+)
+
+const CONFLICT_OVERWRITE string = "overwrite"
+const CONFLICT_KEEP_BOTH string = "keep-both"
+const CONFLICT_SKIP string = "skip"
+
+type ConflictItem struct {
+	Name         string `json:"name"`
+	Path         string `json:"path"`
+	IsDir        bool   `json:"isDir"`
+	Size         int64  `json:"size"`
+	HumanSize    string `json:"humanSize"`
+	LastModified string `json:"lastModified"`
+}
+
+type Conflict struct {
+	Source      ConflictItem `json:"source"`
+	Destination ConflictItem `json:"destination"`
+}
+
+type ConflictError struct {
+	Conflict Conflict
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("destination '%s' already exists", e.Conflict.Destination.Path)
+}
+
+func ConflictResolutionIsValid(resolution string) bool {
+	switch resolution {
+	case "", CONFLICT_OVERWRITE, CONFLICT_KEEP_BOTH, CONFLICT_SKIP:
+		return true
+	}
+	return false
+}
+
+// returns the destination path to use, or an empty path if the item should be skipped
+func resolveConflict(username string, resolver PathResolver, sourcePath string, destinationPath string, resolution string) (string, error) {
+	err := execute.AsUser(username, func() error {
+		_, err := os.Lstat(destinationPath)
+		return err
+	})
+	if err != nil {
+		// destination does not exist, no conflict
+		return destinationPath, nil
+	}
+
+	switch resolution {
+	case "":
+		return "", newConflictError(username, resolver, sourcePath, destinationPath)
+	case CONFLICT_SKIP:
+		return "", nil
+	case CONFLICT_KEEP_BOTH:
+		destinationParentPath, destinationName := path.Split(destinationPath)
+		destinationName, err = getAvailableFileName(destinationParentPath, destinationName)
+		if err != nil {
+			return "", errors.Join(errors.New("failed to find available file name"), err)
+		}
+		return path.Join(destinationParentPath, destinationName), nil
+	case CONFLICT_OVERWRITE:
+		// trashing a destination that holds the source would trash the source with it
+		if pathIsWithin(destinationPath, sourcePath) {
+			return "", errors.New("destination is or contains the source")
+		}
+
+		err = trashPath(username, destinationPath)
+		if err != nil {
+			return "", errors.Join(errors.New("failed to trash existing destination"), err)
+		}
+		return destinationPath, nil
+	}
+
+	return "", errors.New("conflict resolution is not valid")
+}
+
+func newConflictError(username string, resolver PathResolver, sourcePath string, destinationPath string) error {
+	source, err := getConflictItem(username, resolver, sourcePath)
+	if err != nil {
+		return errors.Join(errors.New("failed to get source info"), err)
+	}
+
+	destination, err := getConflictItem(username, resolver, destinationPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to get destination info"), err)
+	}
+
+	return &ConflictError{
+		Conflict: Conflict{
+			Source:      source,
+			Destination: destination,
+		},
+	}
+}
+
+func getConflictItem(username string, resolver PathResolver, fullPath string) (ConflictItem, error) {
+	var info os.FileInfo
+	err := execute.AsUser(username, func() error {
+		var err error
+		info, err = os.Lstat(fullPath)
+		return err
+	})
+	if err != nil {
+		return ConflictItem{}, errors.Join(errors.New("failed to get path stat"), err)
+	}
+
+	return ConflictItem{
+		Name:         info.Name(),
+		Path:         resolver.RelPath(fullPath),
+		IsDir:        info.IsDir(),
+		Size:         info.Size(),
+		HumanSize:    getHumanSize(info.IsDir(), info.Size()),
+		LastModified: info.ModTime().Format(displayTimeLayout),
+	}, nil
+}
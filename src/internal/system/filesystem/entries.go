@@ -24,8 +24,14 @@ type DirectoryEntryData struct {
 	UrlPath      string
 }
 
+type DirectoryTreeItem struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
 type TrashEntryData struct {
 	DirName      string
+	RestorePath  string
 	IsDir        bool
 	IsCompressed bool
 	IconName     string
@@ -38,8 +44,13 @@ type TrashEntryData struct {
 	UrlPath      string
 }
 
-func GetDirectoryEntries(relDirPath string, rootDirPath string, searchFilter string, showDotfiles string, sortBy string, sortOrder string) ([]DirectoryEntryData, error) {
-	dirEntries, err := os.ReadDir(rootDirPath)
+func GetDirectoryEntries(username string, resolver PathResolver, dirUrlPath string, fileUrlPath string, relDirPath string, searchFilter string, showDotfiles string, sortBy string, sortOrder string) ([]DirectoryEntryData, error) {
+	dirPath, err := resolver.Resolve(relDirPath)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to resolve directory"), err)
+	}
+
+	dirEntries, err := readDirAs(username, dirPath)
 	if err != nil {
 		return nil, errors.Join(errors.New("failed to read directory"), err)
 	}
@@ -59,7 +70,7 @@ func GetDirectoryEntries(relDirPath string, rootDirPath string, searchFilter str
 			continue
 		}
 
-		entry, err := getDirectoryEntry(entry, relDirPath, rootDirPath)
+		entry, err := getDirectoryEntry(resolver, entry, dirUrlPath, fileUrlPath, relDirPath, dirPath)
 		if err != nil {
 			continue
 		}
@@ -70,7 +81,46 @@ func GetDirectoryEntries(relDirPath string, rootDirPath string, searchFilter str
 	return sortDirectoryEntries(entries, sortBy, sortOrder), nil
 }
 
-func getDirectoryEntry(dirEntry os.DirEntry, relDirPath string, rootDirPath string) (DirectoryEntryData, error) {
+func GetDirectoryTreeItems(username string, resolver PathResolver, relDirPath string, showDotfiles string) ([]DirectoryTreeItem, error) {
+	dirPath, err := resolver.Resolve(relDirPath)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to resolve directory"), err)
+	}
+
+	dirEntries, err := readDirAs(username, dirPath)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read directory"), err)
+	}
+
+	showDotfilesBool := showDotfiles != "" && showDotfiles != "0" && showDotfiles != "false"
+
+	items := []DirectoryTreeItem{}
+	for _, entry := range dirEntries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		if !showDotfilesBool {
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+		}
+
+		items = append(items, DirectoryTreeItem{
+			Name: entry.Name(),
+			Path: path.Join("/", relDirPath, entry.Name()),
+		})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		res, _ := sortEntriesByName(items[i].Name, items[j].Name, false)
+		return res
+	})
+
+	return items, nil
+}
+
+func getDirectoryEntry(resolver PathResolver, dirEntry os.DirEntry, dirUrlPath string, fileUrlPath string, relDirPath string, dirPath string) (DirectoryEntryData, error) {
 	entryInfo, err := dirEntry.Info()
 	if err != nil {
 		return DirectoryEntryData{}, errors.Join(errors.New("failed to get entry info"), err)
@@ -86,54 +136,40 @@ func getDirectoryEntry(dirEntry os.DirEntry, relDirPath string, rootDirPath stri
 		LastModified: entryInfo.ModTime().Format(displayTimeLayout),
 	}
 
-	entry.UrlPath, err = entry.getUrlPath()
-	if err != nil {
-		return entry, errors.Join(errors.New("failed to get url path"), err)
+	symLinkPath, isSymLinkDir, visible := resolver.getSymLinkInfo(path.Join(dirPath, entry.Name))
+	if !visible {
+		return entry, errors.New("symbolic link is blocked")
 	}
 
-	symLinkPath, isSymLinkDir := entry.getSymLinkInfo(rootDirPath)
 	entry.SymLinkPath = symLinkPath
 	if isSymLinkDir {
 		entry.IsDir = true
 	}
 
+	entry.UrlPath, err = entry.getUrlPath(dirUrlPath, fileUrlPath)
+	if err != nil {
+		return entry, errors.Join(errors.New("failed to get url path"), err)
+	}
+
 	entry.HumanSize = getHumanSize(entry.IsDir, entry.size)
 	entry.IconName = getEntryIconName(entry.IsDir, entry.Name)
 
 	return entry, nil
 }
 
-func (entry DirectoryEntryData) getUrlPath() (string, error) {
+func (entry DirectoryEntryData) getUrlPath(dirUrlPath string, fileUrlPath string) (string, error) {
 	_, err := url.ParseRequestURI(entry.Path)
 	if err != nil {
 		return "", errors.Join(errors.New("failed to parse path to uri"), err)
 	}
 
 	if entry.IsDir {
-		return url.JoinPath("/files", entry.Path)
+		return url.JoinPath(dirUrlPath, entry.Path)
 	} else {
-		return url.JoinPath("/file", entry.Path)
+		return url.JoinPath(fileUrlPath, entry.Path)
 	}
 }
 
-func (entry DirectoryEntryData) getSymLinkInfo(rootPath string) (string, bool) {
-	linkPath, err := os.Readlink(path.Join(rootPath, entry.Name))
-	if err != nil {
-		return "", false
-	}
-
-	if !strings.HasPrefix(linkPath, "/") {
-		linkPath = path.Join(rootPath, linkPath)
-	}
-
-	linkInfo, err := os.Stat(linkPath)
-	if err != nil {
-		return "", false
-	}
-
-	return strings.TrimPrefix(linkPath, rootPath), linkInfo.IsDir()
-}
-
 func sortDirectoryEntries(entries []DirectoryEntryData, sortBy string, sortOrder string) []DirectoryEntryData {
 	sortOrderDesc := strings.ToLower(sortOrder) == "desc"
 	sort.Slice(entries, func(i, j int) bool {
@@ -197,25 +233,25 @@ func sortDirectoryEntries(entries []DirectoryEntryData, sortBy string, sortOrder
 	return entries
 }
 
-func GetTrashEntries(username string, relTrashPath string, sortBy string, sortOrder string) ([]TrashEntryData, error) {
+func GetTrashEntries(username string, resolver PathResolver, trashUrlPath string, fileUrlPath string, relTrashPath string, sortBy string, sortOrder string) ([]TrashEntryData, error) {
 	var entries []TrashEntryData
 	var err error
 
 	if relTrashPath == "/" {
-		dirEntries, err := os.ReadDir(path.Join("/home", username, TRASH_HOME_PATH))
+		dirEntries, err := readDirAs(username, getTrashRootPath(username, resolver.RootPath()))
 		if err != nil {
 			return entries, errors.Join(errors.New("failed to read directory"), err)
 		}
 
 		for _, entry := range dirEntries {
-			subEntries, err := getTrashPathEntries(username, entry.Name())
+			subEntries, err := getTrashPathEntries(username, resolver, trashUrlPath, fileUrlPath, entry.Name())
 			if err != nil {
 				return entries, errors.Join(errors.New("failed to get trash path entries"), err)
 			}
 			entries = append(entries, subEntries...)
 		}
 	} else {
-		entries, err = getTrashPathEntries(username, relTrashPath)
+		entries, err = getTrashPathEntries(username, resolver, trashUrlPath, fileUrlPath, relTrashPath)
 		if err != nil {
 			return entries, errors.Join(errors.New("failed to get trash path entries"), err)
 		}
@@ -224,7 +260,7 @@ func GetTrashEntries(username string, relTrashPath string, sortBy string, sortOr
 	return sortTrashEntries(entries, sortBy, sortOrder), err
 }
 
-func getTrashPathEntries(username string, relTrashPath string) ([]TrashEntryData, error) {
+func getTrashPathEntries(username string, resolver PathResolver, trashUrlPath string, fileUrlPath string, relTrashPath string) ([]TrashEntryData, error) {
 	var entries []TrashEntryData
 
 	trashDirName := getTopLevelDirName(relTrashPath)
@@ -238,7 +274,13 @@ func getTrashPathEntries(username string, relTrashPath string) ([]TrashEntryData
 	}
 	trashedOn := trashedTime.Format(displayTimeLayout)
 
-	dirEntries, err := os.ReadDir(path.Join("/home", username, TRASH_HOME_PATH, relTrashPath))
+	trashRootPath := getTrashRootPath(username, resolver.RootPath())
+	restorePath, err := getTrashRestorePath(username, path.Join(trashRootPath, trashDirName))
+	if err == nil {
+		restorePath = resolver.RelPath(restorePath)
+	}
+
+	dirEntries, err := readDirAs(username, path.Join(trashRootPath, relTrashPath))
 	if err != nil {
 		return nil, errors.Join(errors.New("failed to read directory"), err)
 	}
@@ -248,12 +290,13 @@ func getTrashPathEntries(username string, relTrashPath string) ([]TrashEntryData
 			continue
 		}
 
-		entry, err := getTrashEntry(entry, relTrashPath)
+		entry, err := getTrashEntry(entry, trashUrlPath, fileUrlPath, resolver.RelPath(trashRootPath), relTrashPath)
 		if err != nil {
 			continue
 		}
 
 		entry.DirName = trashDirName
+		entry.RestorePath = restorePath
 		entry.trashedTime = trashedTime
 		entry.TrashedOn = trashedOn
 
@@ -263,7 +306,7 @@ func getTrashPathEntries(username string, relTrashPath string) ([]TrashEntryData
 	return entries, nil
 }
 
-func getTrashEntry(dirEntry os.DirEntry, relTrashPath string) (TrashEntryData, error) {
+func getTrashEntry(dirEntry os.DirEntry, trashUrlPath string, fileUrlPath string, trashRelPath string, relTrashPath string) (TrashEntryData, error) {
 	entryInfo, err := dirEntry.Info()
 	if err != nil {
 		return TrashEntryData{}, errors.Join(errors.New("failed to get entry info"), err)
@@ -279,25 +322,25 @@ func getTrashEntry(dirEntry os.DirEntry, relTrashPath string) (TrashEntryData, e
 		HumanSize:    getHumanSize(dirEntry.IsDir(), entryInfo.Size()),
 	}
 
-	entry.UrlPath, err = entry.getUrlPath()
+	entry.UrlPath, err = entry.getUrlPath(trashUrlPath, fileUrlPath)
 	if err != nil {
 		return entry, errors.Join(errors.New("failed to get url path"), err)
 	}
-	entry.Path = path.Join("/", TRASH_HOME_PATH, entry.Path)
+	entry.Path = path.Join(trashRelPath, entry.Path)
 
 	return entry, nil
 }
 
-func (entry TrashEntryData) getUrlPath() (string, error) {
+func (entry TrashEntryData) getUrlPath(trashUrlPath string, fileUrlPath string) (string, error) {
 	_, err := url.ParseRequestURI(entry.Path)
 	if err != nil {
 		return "", errors.Join(errors.New("failed to parse path to uri"), err)
 	}
 
 	if entry.IsDir {
-		return url.JoinPath("/trash", entry.Path)
+		return url.JoinPath(trashUrlPath, entry.Path)
 	} else {
-		return url.JoinPath("/file", TRASH_HOME_PATH, entry.Path)
+		return url.JoinPath(fileUrlPath, entry.Path)
 	}
 }
 
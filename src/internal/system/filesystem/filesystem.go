@@ -4,20 +4,51 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/grantfbarnes/ground/internal/system/execute"
 )
 
 const TRASH_HOME_PATH string = ".local/share/ground/trash"
 const trashRestorePathFileName string = ".ground-trash-restore-path"
 const displayTimeLayout string = "2006-01-02 03:04:05 PM"
 const systemTimeLayout string = "20060102150405.000"
+const userContentSecurityPolicy string = "sandbox; default-src 'none'; img-src 'self' data:; media-src 'self'; style-src 'unsafe-inline'"
 
 var fileCopyNameRegex *regexp.Regexp
 var trashDirNameRegex *regexp.Regexp
+var trashMaxAge atomic.Int64
+var trashMaxSize atomic.Int64
+
+// user homes are expected directly under this path, it is also where new users are created
+func SetupHomeRootPath(rootPath string) error {
+	rootPath = path.Clean(rootPath)
+	if !path.IsAbs(rootPath) || rootPath == "/" {
+		return errors.New("home root path is not valid")
+	}
+
+	info, err := os.Stat(rootPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to find home root path"), err)
+	}
+
+	if !info.IsDir() {
+		return errors.New("home root path is not a directory")
+	}
+
+	execute.SetupHomeRootPath(rootPath)
+	return nil
+}
 
 func SetupFileCopyNameRegex() error {
 	re, err := regexp.Compile(`(.*)\(([0-9]+)\)$`)
@@ -37,6 +68,11 @@ func SetupTrashNameDirRegex() error {
 	return nil
 }
 
+func SetupTrashLimits(maxAge time.Duration, maxSize int64) {
+	trashMaxAge.Store(int64(maxAge))
+	trashMaxSize.Store(maxSize)
+}
+
 func getTopLevelDirName(fullPath string) string {
 	parts := strings.SplitSeq(fullPath, string(os.PathSeparator))
 	for p := range parts {
@@ -130,6 +166,32 @@ func getFileExtension(fileName string) (string, string) {
 	return coreFileName, fileExtension
 }
 
+func getDirectorySize(dirPath string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dirPath, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		entryInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		size += entryInfo.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Join(errors.New("failed to walk directory"), err)
+	}
+
+	return size, nil
+}
+
 func getHumanSize(isDir bool, size int64) string {
 	if isDir {
 		return "-"
@@ -149,3 +211,59 @@ func getHumanSize(isDir bool, size int64) string {
 
 	return fmt.Sprintf("%d B", size)
 }
+
+// user files are sandboxed without scripts or the app's origin, so an uploaded page cannot act as the viewer
+func ServeFile(w http.ResponseWriter, r *http.Request, username string, filePath string) error {
+	w.Header().Set("Content-Security-Policy", userContentSecurityPolicy)
+
+	contentType := w.Header().Get("Content-Type")
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(filePath))
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if w.Header().Get("Content-Disposition") == "" && (mediaType == "text/html" || mediaType == "application/xhtml+xml") {
+		// version files are stored under their own names, the url has the name the user knows
+		SetAttachmentHeader(w, path.Base(r.URL.Path))
+	}
+
+	return execute.AsUser(username, func() error {
+		http.ServeFile(w, r, filePath)
+		return nil
+	})
+}
+
+func SetAttachmentHeader(w http.ResponseWriter, fileName string) {
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+}
+
+func readDirAs(username string, dirPath string) ([]os.DirEntry, error) {
+	var dirEntries []os.DirEntry
+	err := execute.AsUser(username, func() error {
+		var err error
+		dirEntries, err = os.ReadDir(dirPath)
+		return err
+	})
+	return dirEntries, err
+}
+
+func getDirectorySizeAs(username string, dirPath string) (int64, error) {
+	var size int64
+	err := execute.AsUser(username, func() error {
+		var err error
+		size, err = getDirectorySize(dirPath)
+		return err
+	})
+	return size, err
+}
+
+func writeFileAs(username string, filePath string, data []byte, perm os.FileMode) error {
+	return execute.AsUser(username, func() error {
+		return os.WriteFile(filePath, data, perm)
+	})
+}
+
+func removeAllAs(username string, fullPath string) error {
+	return execute.AsUser(username, func() error {
+		return os.RemoveAll(fullPath)
+	})
+}
@@ -0,0 +1,219 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/grantfbarnes/ground/internal/system/execute"
+)
+
+const SYMLINK_POLICY_SHOW string = "show"
+const SYMLINK_POLICY_FOLLOW string = "follow"
+const SYMLINK_POLICY_BLOCK string = "block"
+
+var ErrPathOutsideRoot = errors.New("path is outside of the root directory")
+
+var symlinkPolicy string = SYMLINK_POLICY_SHOW
+
+type PathResolver struct {
+	rootPath     string
+	realRootPath string
+	home         bool
+	// full and real paths that cannot be reached even though they are under the root
+	excludedPaths []string
+}
+
+func SetupSymlinkPolicy(policy string) error {
+	switch policy {
+	case SYMLINK_POLICY_SHOW, SYMLINK_POLICY_FOLLOW, SYMLINK_POLICY_BLOCK:
+		symlinkPolicy = policy
+		return nil
+	}
+	return errors.New("symlink policy is not valid")
+}
+
+func NewPathResolver(rootPath string) (PathResolver, error) {
+	rootPath = path.Clean(rootPath)
+	if !path.IsAbs(rootPath) {
+		return PathResolver{}, errors.New("root path is not absolute")
+	}
+
+	realRootPath, err := filepath.EvalSymlinks(rootPath)
+	if err != nil {
+		return PathResolver{}, errors.Join(errors.New("failed to evaluate root path"), err)
+	}
+
+	return PathResolver{
+		rootPath:     rootPath,
+		realRootPath: realRootPath,
+	}, nil
+}
+
+func NewHomePathResolver(username string) (PathResolver, error) {
+	resolver, err := NewPathResolver(execute.GetHomePath(username))
+	if err != nil {
+		return PathResolver{}, err
+	}
+
+	resolver.home = true
+	return resolver, nil
+}
+
+// a share cannot reach the files that hold the owner's logins, even through links
+func NewSharePathResolver(owner string, rootPath string) (PathResolver, error) {
+	resolver, err := NewPathResolver(rootPath)
+	if err != nil {
+		return PathResolver{}, err
+	}
+
+	homePath := execute.GetHomePath(owner)
+	realHomePath, err := filepath.EvalSymlinks(homePath)
+	if err != nil {
+		return PathResolver{}, errors.Join(errors.New("failed to evaluate home path"), err)
+	}
+
+	for _, protectedPath := range protectedHomePaths {
+		resolver.excludedPaths = append(resolver.excludedPaths, path.Join(homePath, protectedPath), path.Join(realHomePath, protectedPath))
+	}
+
+	return resolver, nil
+}
+
+func (resolver PathResolver) RootPath() string {
+	return resolver.rootPath
+}
+
+// returns the full path for accessing the target of relPath, following symbolic links
+func (resolver PathResolver) Resolve(relPath string) (string, error) {
+	fullPath := path.Join(resolver.rootPath, relPath)
+	if !pathIsWithin(resolver.rootPath, fullPath) {
+		return "", ErrPathOutsideRoot
+	}
+
+	if resolver.followsSymlinks() && len(resolver.excludedPaths) == 0 {
+		return fullPath, nil
+	}
+
+	realPath, err := evalExistingSymlinks(fullPath)
+	if err != nil {
+		return "", errors.Join(ErrPathOutsideRoot, err)
+	}
+
+	if !resolver.followsSymlinks() && !pathIsWithin(resolver.realRootPath, realPath) {
+		return "", ErrPathOutsideRoot
+	}
+
+	for _, excludedPath := range resolver.excludedPaths {
+		if pathIsWithin(excludedPath, fullPath) || pathIsWithin(excludedPath, realPath) {
+			return "", ErrPathOutsideRoot
+		}
+	}
+
+	return fullPath, nil
+}
+
+// returns the full path for acting on relPath itself, the last element is not followed if it is a symbolic link
+func (resolver PathResolver) ResolveLink(relPath string) (string, error) {
+	fullPath := path.Join(resolver.rootPath, relPath)
+	if !pathIsWithin(resolver.rootPath, fullPath) {
+		return "", ErrPathOutsideRoot
+	}
+
+	if fullPath == resolver.rootPath {
+		return fullPath, nil
+	}
+
+	parentPath, err := resolver.Resolve(path.Dir(resolver.RelPath(fullPath)))
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(parentPath, path.Base(fullPath)), nil
+}
+
+func (resolver PathResolver) Contains(fullPath string) bool {
+	if !pathIsWithin(resolver.rootPath, fullPath) {
+		return false
+	}
+
+	_, err := resolver.Resolve(resolver.RelPath(fullPath))
+	return err == nil
+}
+
+func (resolver PathResolver) RelPath(fullPath string) string {
+	return path.Join("/", strings.TrimPrefix(path.Clean(fullPath), resolver.rootPath))
+}
+
+// returns the link target to display, if the target is a directory, and if the link is visible under the symlink policy
+func (resolver PathResolver) getSymLinkInfo(fullPath string) (string, bool, bool) {
+	linkPath, err := os.Readlink(fullPath)
+	if err != nil {
+		// not a symbolic link
+		return "", false, true
+	}
+
+	if !path.IsAbs(linkPath) {
+		linkPath = path.Join(path.Dir(fullPath), linkPath)
+	}
+
+	linkInfo, statErr := os.Stat(fullPath)
+	realPath, err := filepath.EvalSymlinks(fullPath)
+	if err == nil && statErr == nil && pathIsWithin(resolver.realRootPath, realPath) {
+		return path.Join("/", strings.TrimPrefix(realPath, resolver.realRootPath)), linkInfo.IsDir(), true
+	}
+
+	switch {
+	case resolver.followsSymlinks():
+		if statErr != nil {
+			return "", false, true
+		}
+		return linkPath, linkInfo.IsDir(), true
+	case symlinkPolicy != SYMLINK_POLICY_BLOCK:
+		return "(outside of root directory)", false, true
+	}
+
+	return "", false, false
+}
+
+// links out of the root are only followed in a user's own home, a share or space never reaches past its root
+func (resolver PathResolver) followsSymlinks() bool {
+	return symlinkPolicy == SYMLINK_POLICY_FOLLOW && resolver.home
+}
+
+func pathIsWithin(rootPath string, fullPath string) bool {
+	rootPath = path.Clean(rootPath)
+	fullPath = path.Clean(fullPath)
+	return fullPath == rootPath || strings.HasPrefix(fullPath, strings.TrimSuffix(rootPath, "/")+"/")
+}
+
+func evalExistingSymlinks(fullPath string) (string, error) {
+	realPath, err := filepath.EvalSymlinks(fullPath)
+	if err == nil {
+		return realPath, nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	_, err = os.Lstat(fullPath)
+	if err == nil {
+		return "", errors.New("symbolic link target does not exist")
+	}
+
+	parentPath := path.Dir(fullPath)
+	if parentPath == fullPath {
+		return fullPath, nil
+	}
+
+	realParentPath, err := evalExistingSymlinks(parentPath)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(realParentPath, path.Base(fullPath)), nil
+}
@@ -0,0 +1,268 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/grantfbarnes/ground/internal/system/execute"
+)
+
+// builds the home of user foo with a sibling sharing its name as a prefix:
+//
+//	base/foo/dir/file
+//	base/foo/link-in -> dir
+//	base/foo/link-out -> ../foobar
+//	base/foo/link-dangling -> missing
+//	base/foobar/secret
+func setupResolverTree(t *testing.T) (string, PathResolver) {
+	t.Helper()
+	basePath := t.TempDir()
+	rootPath := path.Join(basePath, "foo")
+
+	for _, dirPath := range []string{path.Join(rootPath, "dir"), path.Join(basePath, "foobar")} {
+		err := os.MkdirAll(dirPath, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, filePath := range []string{path.Join(rootPath, "dir", "file"), path.Join(basePath, "foobar", "secret")} {
+		err := os.WriteFile(filePath, []byte("data"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"link-in":       "dir",
+		"link-out":      "../foobar",
+		"link-dangling": "missing",
+	}
+	for name, target := range links {
+		err := os.Symlink(target, path.Join(rootPath, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previousHomeRootPath := execute.GetHomePath("")
+	execute.SetupHomeRootPath(basePath)
+	t.Cleanup(func() { execute.SetupHomeRootPath(previousHomeRootPath) })
+
+	resolver, err := NewHomePathResolver("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rootPath, resolver
+}
+
+func setSymlinkPolicy(t *testing.T, policy string) {
+	t.Helper()
+	previousPolicy := symlinkPolicy
+	err := SetupSymlinkPolicy(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { symlinkPolicy = previousPolicy })
+}
+
+func TestResolve(t *testing.T) {
+	rootPath, resolver := setupResolverTree(t)
+
+	tests := []struct {
+		relPath string
+		// whether the path is allowed under the show, block, and follow policies
+		allowed map[string]bool
+	}{
+		{"/", map[string]bool{SYMLINK_POLICY_SHOW: true, SYMLINK_POLICY_BLOCK: true, SYMLINK_POLICY_FOLLOW: true}},
+		{"/dir/file", map[string]bool{SYMLINK_POLICY_SHOW: true, SYMLINK_POLICY_BLOCK: true, SYMLINK_POLICY_FOLLOW: true}},
+		{"/dir/not-yet-created", map[string]bool{SYMLINK_POLICY_SHOW: true, SYMLINK_POLICY_BLOCK: true, SYMLINK_POLICY_FOLLOW: true}},
+		{"/dir/../dir/file", map[string]bool{SYMLINK_POLICY_SHOW: true, SYMLINK_POLICY_BLOCK: true, SYMLINK_POLICY_FOLLOW: true}},
+		{"/link-in/file", map[string]bool{SYMLINK_POLICY_SHOW: true, SYMLINK_POLICY_BLOCK: true, SYMLINK_POLICY_FOLLOW: true}},
+		{"..", map[string]bool{}},
+		{"../foobar/secret", map[string]bool{}},
+		{"/dir/../../foobar/secret", map[string]bool{}},
+		{"../../etc/passwd", map[string]bool{}},
+		{"/link-out", map[string]bool{SYMLINK_POLICY_FOLLOW: true}},
+		{"/link-out/secret", map[string]bool{SYMLINK_POLICY_FOLLOW: true}},
+		{"/link-out/not-yet-created", map[string]bool{SYMLINK_POLICY_FOLLOW: true}},
+		{"/link-dangling", map[string]bool{SYMLINK_POLICY_FOLLOW: true}},
+	}
+
+	for _, policy := range []string{SYMLINK_POLICY_SHOW, SYMLINK_POLICY_BLOCK, SYMLINK_POLICY_FOLLOW} {
+		setSymlinkPolicy(t, policy)
+		for _, test := range tests {
+			fullPath, err := resolver.Resolve(test.relPath)
+			if test.allowed[policy] {
+				if err != nil {
+					t.Errorf("%s: Resolve(%q) failed: %v", policy, test.relPath, err)
+				} else if want := path.Join(rootPath, test.relPath); fullPath != want {
+					t.Errorf("%s: Resolve(%q) = %q, want %q", policy, test.relPath, fullPath, want)
+				}
+			} else if !errors.Is(err, ErrPathOutsideRoot) {
+				t.Errorf("%s: Resolve(%q) = %q, %v, want ErrPathOutsideRoot", policy, test.relPath, fullPath, err)
+			}
+		}
+	}
+}
+
+func TestResolveLink(t *testing.T) {
+	rootPath, resolver := setupResolverTree(t)
+
+	tests := []struct {
+		relPath string
+		allowed map[string]bool
+	}{
+		// the link itself is in the root even when its target is not
+		{"/link-out", map[string]bool{SYMLINK_POLICY_SHOW: true, SYMLINK_POLICY_BLOCK: true, SYMLINK_POLICY_FOLLOW: true}},
+		{"/link-dangling", map[string]bool{SYMLINK_POLICY_SHOW: true, SYMLINK_POLICY_BLOCK: true, SYMLINK_POLICY_FOLLOW: true}},
+		{"/link-in/file", map[string]bool{SYMLINK_POLICY_SHOW: true, SYMLINK_POLICY_BLOCK: true, SYMLINK_POLICY_FOLLOW: true}},
+		{"/link-out/secret", map[string]bool{SYMLINK_POLICY_FOLLOW: true}},
+		{"../foobar", map[string]bool{}},
+		{"/dir/../../foobar/secret", map[string]bool{}},
+	}
+
+	for _, policy := range []string{SYMLINK_POLICY_SHOW, SYMLINK_POLICY_BLOCK, SYMLINK_POLICY_FOLLOW} {
+		setSymlinkPolicy(t, policy)
+		for _, test := range tests {
+			fullPath, err := resolver.ResolveLink(test.relPath)
+			if test.allowed[policy] {
+				if err != nil {
+					t.Errorf("%s: ResolveLink(%q) failed: %v", policy, test.relPath, err)
+				} else if want := path.Join(rootPath, test.relPath); fullPath != want {
+					t.Errorf("%s: ResolveLink(%q) = %q, want %q", policy, test.relPath, fullPath, want)
+				}
+			} else if !errors.Is(err, ErrPathOutsideRoot) {
+				t.Errorf("%s: ResolveLink(%q) = %q, %v, want ErrPathOutsideRoot", policy, test.relPath, fullPath, err)
+			}
+		}
+	}
+}
+
+func TestResolveOutsideHomeNeverFollows(t *testing.T) {
+	rootPath, _ := setupResolverTree(t)
+	setSymlinkPolicy(t, SYMLINK_POLICY_FOLLOW)
+
+	spaceResolver, err := NewPathResolver(rootPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a writable share recipient can create links anywhere under the shared directory
+	err = os.Symlink("../../foobar", path.Join(rootPath, "dir", "link-up"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shareResolver, err := NewSharePathResolver("foo", path.Join(rootPath, "dir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		resolver PathResolver
+		relPath  string
+		allowed  bool
+	}{
+		{"space", spaceResolver, "/link-in/file", true},
+		{"space", spaceResolver, "/link-out", false},
+		{"space", spaceResolver, "/link-out/secret", false},
+		{"space", spaceResolver, "/link-dangling", false},
+		{"share", shareResolver, "/file", true},
+		{"share", shareResolver, "/link-up", false},
+		{"share", shareResolver, "/link-up/secret", false},
+		{"share", shareResolver, "/link-up/not-yet-created", false},
+	}
+
+	for _, test := range tests {
+		_, err := test.resolver.Resolve(test.relPath)
+		if test.allowed && err != nil {
+			t.Errorf("%s: Resolve(%q) failed: %v", test.name, test.relPath, err)
+		} else if !test.allowed && !errors.Is(err, ErrPathOutsideRoot) {
+			t.Errorf("%s: Resolve(%q) = %v, want ErrPathOutsideRoot", test.name, test.relPath, err)
+		}
+	}
+}
+
+func TestContainsSiblingPrefix(t *testing.T) {
+	rootPath, resolver := setupResolverTree(t)
+	setSymlinkPolicy(t, SYMLINK_POLICY_SHOW)
+
+	tests := []struct {
+		fullPath string
+		want     bool
+	}{
+		{rootPath, true},
+		{rootPath + "/dir", true},
+		{rootPath + "bar", false},
+		{rootPath + "bar/secret", false},
+		{path.Dir(rootPath), false},
+	}
+
+	for _, test := range tests {
+		got := resolver.Contains(test.fullPath)
+		if got != test.want {
+			t.Errorf("Contains(%q) = %v, want %v", test.fullPath, got, test.want)
+		}
+	}
+}
+
+func TestEvalExistingSymlinks(t *testing.T) {
+	rootPath, resolver := setupResolverTree(t)
+	realRootPath := resolver.realRootPath
+
+	tests := []struct {
+		fullPath string
+		want     string
+		wantErr  bool
+	}{
+		{path.Join(rootPath, "dir", "file"), path.Join(realRootPath, "dir", "file"), false},
+		{path.Join(rootPath, "link-in", "file"), path.Join(realRootPath, "dir", "file"), false},
+		// missing elements are kept as given under the real path of what exists
+		{path.Join(rootPath, "link-in", "missing", "deeper"), path.Join(realRootPath, "dir", "missing", "deeper"), false},
+		{path.Join(rootPath, "link-out", "missing"), path.Join(path.Dir(realRootPath), "foobar", "missing"), false},
+		{path.Join(rootPath, "link-dangling"), "", true},
+		{path.Join(rootPath, "link-dangling", "child"), "", true},
+	}
+
+	for _, test := range tests {
+		got, err := evalExistingSymlinks(test.fullPath)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("evalExistingSymlinks(%q) = %q, want error", test.fullPath, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("evalExistingSymlinks(%q) = %q, %v, want %q", test.fullPath, got, err, test.want)
+		}
+	}
+}
+
+func TestPathIsWithin(t *testing.T) {
+	tests := []struct {
+		rootPath string
+		fullPath string
+		want     bool
+	}{
+		{"/srv/shared/foo", "/srv/shared/foo", true},
+		{"/srv/shared/foo", "/srv/shared/foo/", true},
+		{"/srv/shared/foo", "/srv/shared/foo/bar", true},
+		{"/srv/shared/foo/", "/srv/shared/foo/bar", true},
+		{"/srv/shared/foo", "/srv/shared/foobar", false},
+		{"/srv/shared/foo", "/srv/shared/foobar/baz", false},
+		{"/srv/shared/foo", "/srv/shared/foo/../foobar", false},
+		{"/srv/shared/foo", "/srv/shared", false},
+		{"/", "/anything", true},
+	}
+
+	for _, test := range tests {
+		got := pathIsWithin(test.rootPath, test.fullPath)
+		if got != test.want {
+			t.Errorf("pathIsWithin(%q, %q) = %v, want %v", test.rootPath, test.fullPath, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package filesystem
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/grantfbarnes/ground/internal/system/execute"
+)
+
+const SHARES_HOME_PATH string = ".local/share/ground/shares"
+const shareAccessRead string = "read"
+const shareAccessWrite string = "write"
+
+var ErrSharePathProtected = errors.New("share path holds login files")
+
+// a recipient who could write to these would be able to log in as the owner
+var protectedHomePaths []string = []string{".ssh", ".local/share/ground"}
+
+var shareIdRegex *regexp.Regexp
+
+type Share struct {
+	Id        string
+	Owner     string
+	Recipient string
+	Path      string
+	Name      string
+	Writable  bool
+}
+
+func SetupShareIdRegex() error {
+	re, err := regexp.Compile(`^[0-9a-f]{16}$`)
+	if err != nil {
+		return errors.Join(errors.New("failed to compile regex"), err)
+	}
+	shareIdRegex = re
+	return nil
+}
+
+func GetOwnerShares(owner string) ([]Share, error) {
+	var lines []string
+	err := execute.AsUser(owner, func() error {
+		var err error
+		lines, err = getFileLines(path.Join(execute.GetHomePath(owner), SHARES_HOME_PATH))
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Share{}, nil
+		}
+		return nil, errors.Join(errors.New("failed to read shares file"), err)
+	}
+
+	shares := []Share{}
+	for _, line := range lines {
+		share, ok := parseShareLine(owner, line)
+		if !ok {
+			continue
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, nil
+}
+
+func GetRecipientShares(recipient string, owners []string) ([]Share, error) {
+	shares := []Share{}
+	for _, owner := range owners {
+		if owner == recipient {
+			continue
+		}
+
+		ownerShares, err := GetOwnerShares(owner)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to get owner shares"), err)
+		}
+
+		for _, share := range ownerShares {
+			if share.Recipient == recipient {
+				shares = append(shares, share)
+			}
+		}
+	}
+
+	return shares, nil
+}
+
+func GetShare(owner string, id string) (Share, error) {
+	if !shareIdRegex.MatchString(id) {
+		return Share{}, errors.New("share id is not valid")
+	}
+
+	shares, err := GetOwnerShares(owner)
+	if err != nil {
+		return Share{}, errors.Join(errors.New("failed to get owner shares"), err)
+	}
+
+	for _, share := range shares {
+		if share.Id == id {
+			return share, nil
+		}
+	}
+
+	return Share{}, errors.New("share not found")
+}
+
+// access is granted by ground acting as the owner, never by widening home checks for the recipient
+func GetShareAccess(recipient string, owner string, id string) (string, bool, bool) {
+	share, err := GetShare(owner, id)
+	if err != nil || share.Recipient != recipient || sharePathIsProtected(share.Path) {
+		return "", false, false
+	}
+
+	resolver, err := NewHomePathResolver(owner)
+	if err != nil {
+		return "", false, false
+	}
+
+	rootPath, err := resolver.Resolve(share.Path)
+	if err != nil || rootPath == resolver.RootPath() {
+		return "", false, false
+	}
+
+	rootInfo, err := os.Stat(rootPath)
+	if err != nil || !rootInfo.IsDir() {
+		return "", false, false
+	}
+
+	return rootPath, true, share.Writable
+}
+
+func CreateShare(owner string, relHomePath string, recipient string, writable bool) error {
+	if owner == recipient {
+		return errors.New("cannot share with yourself")
+	}
+
+	relHomePath = path.Join("/", relHomePath)
+	if relHomePath == "/" {
+		return errors.New("cannot share home directory")
+	}
+
+	if strings.ContainsAny(relHomePath, "\t\n") {
+		return errors.New("share path is not valid")
+	}
+
+	if sharePathIsProtected(relHomePath) {
+		return ErrSharePathProtected
+	}
+
+	resolver, err := NewHomePathResolver(owner)
+	if err != nil {
+		return errors.Join(errors.New("failed to resolve home directory"), err)
+	}
+
+	dirPath, err := resolver.Resolve(relHomePath)
+	if err != nil {
+		return errors.Join(errors.New("failed to resolve share path"), err)
+	}
+
+	// a link to a protected directory is checked by where it leads
+	realDirPath, err := filepath.EvalSymlinks(dirPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to evaluate share path"), err)
+	}
+
+	if pathIsWithin(resolver.realRootPath, realDirPath) && sharePathIsProtected(strings.TrimPrefix(realDirPath, resolver.realRootPath)) {
+		return ErrSharePathProtected
+	}
+
+	dirInfo, err := os.Stat(dirPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to get path stat"), err)
+	}
+
+	if !dirInfo.IsDir() {
+		return errors.New("share path is not a directory")
+	}
+
+	shares, err := GetOwnerShares(owner)
+	if err != nil {
+		return errors.Join(errors.New("failed to get owner shares"), err)
+	}
+
+	found := false
+	for i, share := range shares {
+		if share.Recipient == recipient && share.Path == relHomePath {
+			shares[i].Writable = writable
+			found = true
+		}
+	}
+
+	if !found {
+		idBytes := make([]byte, 8)
+		_, err = rand.Read(idBytes)
+		if err != nil {
+			return errors.Join(errors.New("failed to generate share id"), err)
+		}
+
+		shares = append(shares, Share{
+			Id:        hex.EncodeToString(idBytes),
+			Owner:     owner,
+			Recipient: recipient,
+			Path:      relHomePath,
+			Writable:  writable,
+		})
+	}
+
+	err = writeOwnerShares(owner, shares)
+	if err != nil {
+		return errors.Join(errors.New("failed to write shares"), err)
+	}
+
+	return nil
+}
+
+func DeleteShare(owner string, id string) error {
+	shares, err := GetOwnerShares(owner)
+	if err != nil {
+		return errors.Join(errors.New("failed to get owner shares"), err)
+	}
+
+	remainingShares := []Share{}
+	for _, share := range shares {
+		if share.Id != id {
+			remainingShares = append(remainingShares, share)
+		}
+	}
+
+	if len(remainingShares) == len(shares) {
+		return errors.New("share not found")
+	}
+
+	err = writeOwnerShares(owner, remainingShares)
+	if err != nil {
+		return errors.Join(errors.New("failed to write shares"), err)
+	}
+
+	return nil
+}
+
+func writeOwnerShares(owner string, shares []Share) error {
+	sharesFilePath := path.Join(execute.GetHomePath(owner), SHARES_HOME_PATH)
+	_, err := os.Stat(sharesFilePath)
+	if err != nil {
+		err = execute.TouchFile(owner, sharesFilePath)
+		if err != nil {
+			return errors.Join(errors.New("failed to create missing file"), err)
+		}
+	}
+
+	var content strings.Builder
+	for _, share := range shares {
+		access := shareAccessRead
+		if share.Writable {
+			access = shareAccessWrite
+		}
+		content.WriteString(strings.Join([]string{share.Id, share.Recipient, access, share.Path}, "\t") + "\n")
+	}
+
+	err = writeFileAs(owner, sharesFilePath, []byte(content.String()), 0600)
+	if err != nil {
+		return errors.Join(errors.New("failed to write to file"), err)
+	}
+
+	return nil
+}
+
+// shares cannot be, contain, or sit under a protected directory
+func sharePathIsProtected(relHomePath string) bool {
+	for _, protectedPath := range protectedHomePaths {
+		protectedPath = path.Join("/", protectedPath)
+		if pathIsWithin(relHomePath, protectedPath) || pathIsWithin(protectedPath, relHomePath) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseShareLine(owner string, line string) (Share, bool) {
+	fields := strings.SplitN(line, "\t", 4)
+	if len(fields) != 4 || !shareIdRegex.MatchString(fields[0]) {
+		return Share{}, false
+	}
+
+	if fields[2] != shareAccessRead && fields[2] != shareAccessWrite {
+		return Share{}, false
+	}
+
+	sharePath := path.Join("/", fields[3])
+	return Share{
+		Id:        fields[0],
+		Owner:     owner,
+		Recipient: fields[1],
+		Path:      sharePath,
+		Name:      path.Base(sharePath),
+		Writable:  fields[2] == shareAccessWrite,
+	}, true
+}
@@ -0,0 +1,364 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/user"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/grantfbarnes/ground/internal/system/execute"
+)
+
+const spaceDirModeRead os.FileMode = 0750 | os.ModeSetgid
+const spaceDirModeWrite os.FileMode = 0770 | os.ModeSetgid
+
+// system groups carry privileges such as sudo, handing out their membership through a space would grant them
+const spaceGroupIdMin int = 1000
+
+// items trashed in a space stay in the space so any member can restore them
+const SPACE_TRASH_PATH string = ".trash"
+
+var ErrSpaceGroupReserved = errors.New("system groups and primary groups cannot back a space")
+
+var sharedRootPath string
+var spaceNameRegex *regexp.Regexp
+
+type Space struct {
+	Name     string
+	Group    string
+	Writable bool
+	Members  []string
+	RootPath string
+}
+
+func SetupSharedRootPath(rootPath string) error {
+	rootPath = path.Clean(rootPath)
+	if !path.IsAbs(rootPath) || rootPath == "/" {
+		return errors.New("shared root path is not valid")
+	}
+
+	err := os.MkdirAll(rootPath, 0755)
+	if err != nil {
+		return errors.Join(errors.New("failed to create shared root path"), err)
+	}
+
+	sharedRootPath = rootPath
+	execute.SetupSharedRootPath(rootPath)
+	return nil
+}
+
+func SetupSpaceNameRegex() error {
+	// contains only letters, numbers, or ._-
+	// cannot start with . or -
+	// length between 1 and 64
+	re, err := regexp.Compile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,63}$`)
+	if err != nil {
+		return errors.Join(errors.New("failed to compile regex"), err)
+	}
+	spaceNameRegex = re
+	return nil
+}
+
+func SpaceNameIsValid(name string) bool {
+	return spaceNameRegex.MatchString(name)
+}
+
+func GetSpaces() ([]Space, error) {
+	dirEntries, err := os.ReadDir(sharedRootPath)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read directory"), err)
+	}
+
+	spaces := []Space{}
+	for _, entry := range dirEntries {
+		if !entry.IsDir() || !SpaceNameIsValid(entry.Name()) {
+			continue
+		}
+
+		space, err := GetSpace(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		spaces = append(spaces, space)
+	}
+
+	return spaces, nil
+}
+
+func GetUserSpaces(username string) ([]Space, error) {
+	spaces, err := GetSpaces()
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to get spaces"), err)
+	}
+
+	userSpaces := []Space{}
+	for _, space := range spaces {
+		if slices.Contains(space.Members, username) {
+			userSpaces = append(userSpaces, space)
+		}
+	}
+
+	return userSpaces, nil
+}
+
+func GetSpace(name string) (Space, error) {
+	if !SpaceNameIsValid(name) {
+		return Space{}, errors.New("space name is not valid")
+	}
+
+	rootPath := path.Join(sharedRootPath, name)
+	info, err := os.Stat(rootPath)
+	if err != nil {
+		return Space{}, errors.Join(errors.New("failed to find space directory"), err)
+	}
+
+	if !info.IsDir() {
+		return Space{}, errors.New("space path is not a directory")
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return Space{}, errors.New("failed to get space directory owner")
+	}
+
+	group, err := user.LookupGroupId(strconv.FormatUint(uint64(stat.Gid), 10))
+	if err != nil {
+		return Space{}, errors.Join(errors.New("failed to lookup space group"), err)
+	}
+
+	members, err := execute.GetGroupMembers(group.Name)
+	if err != nil {
+		return Space{}, errors.Join(errors.New("failed to get space members"), err)
+	}
+
+	return Space{
+		Name:     name,
+		Group:    group.Name,
+		Writable: info.Mode().Perm()&0020 != 0,
+		Members:  members,
+		RootPath: rootPath,
+	}, nil
+}
+
+func GetSpaceAccess(username string, name string) (string, bool, bool) {
+	space, err := GetSpace(name)
+	if err != nil {
+		return "", false, false
+	}
+
+	if !slices.Contains(space.Members, username) {
+		return "", false, false
+	}
+
+	return space.RootPath, true, space.Writable
+}
+
+func CreateSpace(name string, groupname string, writable bool) error {
+	if !SpaceNameIsValid(name) {
+		return errors.New("space name is not valid")
+	}
+
+	if groupname == "" {
+		groupname = "ground-" + name
+	}
+
+	rootPath := path.Join(sharedRootPath, name)
+	_, err := os.Stat(rootPath)
+	if err == nil {
+		return errors.New("space already exists")
+	}
+
+	_, err = user.LookupGroup(groupname)
+	if err == nil {
+		_, err = lookupSpaceGroupId(groupname)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = execute.GroupCreate(groupname)
+	if err != nil {
+		return errors.Join(errors.New("failed to create group"), err)
+	}
+
+	gid, err := lookupSpaceGroupId(groupname)
+	if err != nil {
+		return err
+	}
+
+	err = os.Mkdir(rootPath, 0700)
+	if err != nil {
+		return errors.Join(errors.New("failed to create space directory"), err)
+	}
+
+	err = os.Chown(rootPath, 0, gid)
+	if err != nil {
+		return errors.Join(errors.New("failed to set space directory group"), err)
+	}
+
+	err = SetSpaceWritable(name, writable)
+	if err != nil {
+		return errors.Join(errors.New("failed to set space access"), err)
+	}
+
+	return nil
+}
+
+func DeleteSpace(name string) error {
+	space, err := GetSpace(name)
+	if err != nil {
+		return errors.Join(errors.New("failed to get space"), err)
+	}
+
+	// only empty spaces are removed so shared files are never lost
+	err = os.Remove(space.RootPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to remove space directory"), err)
+	}
+
+	return nil
+}
+
+func SetSpaceWritable(name string, writable bool) error {
+	if !SpaceNameIsValid(name) {
+		return errors.New("space name is not valid")
+	}
+
+	mode := spaceDirModeRead
+	if writable {
+		mode = spaceDirModeWrite
+	}
+
+	err := os.Chmod(path.Join(sharedRootPath, name), mode)
+	if err != nil {
+		return errors.Join(errors.New("failed to set space directory mode"), err)
+	}
+
+	err = setSpaceContentWritable(path.Join(sharedRootPath, name), writable)
+	if err != nil {
+		return errors.Join(errors.New("failed to set space content mode"), err)
+	}
+
+	return nil
+}
+
+// members can reach the files without ground, so the group write bit has to change on everything in the space
+// the walk stays inside of an os.Root so a link planted by a member cannot point the chmod outside of the space
+func setSpaceContentWritable(rootPath string, writable bool) error {
+	root, err := os.OpenRoot(rootPath)
+	if err != nil {
+		return errors.Join(errors.New("failed to open space directory"), err)
+	}
+	defer root.Close()
+
+	return fs.WalkDir(root.FS(), ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if name == "." || entry.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		currentMode := info.Mode() & (fs.ModePerm | fs.ModeSetgid | fs.ModeSetuid | fs.ModeSticky)
+		mode := currentMode
+		if writable {
+			mode |= 0020
+		} else {
+			mode &^= 0020
+		}
+
+		if mode == currentMode {
+			return nil
+		}
+
+		return root.Chmod(name, mode)
+	})
+}
+
+func AddSpaceMember(name string, username string) error {
+	space, err := GetSpace(name)
+	if err != nil {
+		return errors.Join(errors.New("failed to get space"), err)
+	}
+
+	_, err = lookupSpaceGroupId(space.Group)
+	if err != nil {
+		return err
+	}
+
+	err = execute.GroupAdd(username, space.Group)
+	if err != nil {
+		return errors.Join(errors.New("failed to add user to group"), err)
+	}
+
+	return nil
+}
+
+func RemoveSpaceMember(name string, username string) error {
+	space, err := GetSpace(name)
+	if err != nil {
+		return errors.Join(errors.New("failed to get space"), err)
+	}
+
+	err = execute.GroupDelete(username, space.Group)
+	if err != nil {
+		return errors.Join(errors.New("failed to remove user from group"), err)
+	}
+
+	return nil
+}
+
+func lookupSpaceGroupId(groupname string) (int, error) {
+	group, err := user.LookupGroup(groupname)
+	if err != nil {
+		return 0, errors.Join(errors.New("failed to lookup group"), err)
+	}
+
+	gid, err := strconv.Atoi(group.Gid)
+	if err != nil {
+		return 0, errors.Join(errors.New("failed to parse gid"), err)
+	}
+
+	if gid < spaceGroupIdMin {
+		return 0, ErrSpaceGroupReserved
+	}
+
+	// members of a user's primary group could reach that user's home
+	primary, err := execute.GroupIsPrimary(gid)
+	if err != nil {
+		return 0, errors.Join(errors.New("failed to check primary groups"), err)
+	}
+
+	if primary {
+		return 0, ErrSpaceGroupReserved
+	}
+
+	return gid, nil
+}
+
+// the space a path is in, or an empty name if it is not in one
+func getSpaceRootPath(fullPath string) string {
+	if sharedRootPath == "" || !pathIsWithin(sharedRootPath, fullPath) {
+		return ""
+	}
+
+	name, _, _ := strings.Cut(strings.TrimPrefix(path.Clean(fullPath), sharedRootPath+"/"), "/")
+	if !SpaceNameIsValid(name) {
+		return ""
+	}
+
+	return path.Join(sharedRootPath, name)
+}
@@ -0,0 +1,74 @@
+package filesystem
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSetSpaceContentWritable(t *testing.T) {
+	basePath := t.TempDir()
+	rootPath := path.Join(basePath, "space")
+	outsidePath := path.Join(basePath, "outside")
+
+	err := os.MkdirAll(path.Join(rootPath, "dir"), 0775)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filePath := range []string{path.Join(rootPath, "dir", "file"), outsidePath} {
+		err = os.WriteFile(filePath, []byte("data"), 0664)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the umask of the test process would otherwise decide the starting modes
+	for filePath, mode := range map[string]os.FileMode{path.Join(rootPath, "dir"): 0775, path.Join(rootPath, "dir", "file"): 0664, outsidePath: 0664} {
+		err = os.Chmod(filePath, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a member could plant a link to make the chmod reach outside of the space
+	err = os.Symlink(outsidePath, path.Join(rootPath, "link-out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkModes := func(expected map[string]os.FileMode) {
+		t.Helper()
+		for filePath, mode := range expected {
+			info, err := os.Stat(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != mode {
+				t.Errorf("%s has mode %o instead of %o", filePath, info.Mode().Perm(), mode)
+			}
+		}
+	}
+
+	err = setSpaceContentWritable(rootPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkModes(map[string]os.FileMode{
+		path.Join(rootPath, "dir"):         0755,
+		path.Join(rootPath, "dir", "file"): 0644,
+		outsidePath:                        0664,
+	})
+
+	err = setSpaceContentWritable(rootPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkModes(map[string]os.FileMode{
+		path.Join(rootPath, "dir"):         0775,
+		path.Join(rootPath, "dir", "file"): 0664,
+		outsidePath:                        0664,
+	})
+}
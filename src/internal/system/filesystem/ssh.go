@@ -5,6 +5,8 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"slices"
+	"strconv"
 
 	"github.com/grantfbarnes/ground/internal/system/execute"
 )
@@ -21,8 +23,13 @@ func SetupSshKeyRegex() error {
 }
 
 func GetUserSshKeys(username string) ([]string, error) {
-	sshKeyPath := path.Join("/home", username, ".ssh", "authorized_keys")
-	sshKeys, err := getFileLines(sshKeyPath)
+	sshKeyPath := path.Join(execute.GetHomePath(username), ".ssh", "authorized_keys")
+	var sshKeys []string
+	err := execute.AsUser(username, func() error {
+		var err error
+		sshKeys, err = getFileLines(sshKeyPath)
+		return err
+	})
 	if err != nil {
 		return nil, errors.Join(errors.New("failed to read file lines"), err)
 	}
@@ -34,7 +41,7 @@ func AddUserSshKey(username string, sshKey string) error {
 		return errors.New("ssh key is not valid")
 	}
 
-	homePath := path.Join("/home", username)
+	homePath := execute.GetHomePath(username)
 	sshKeyPath := path.Join(homePath, ".ssh", "authorized_keys")
 	_, err := os.Stat(sshKeyPath)
 	if err != nil {
@@ -44,22 +51,53 @@ func AddUserSshKey(username string, sshKey string) error {
 		}
 	}
 
-	sshKeyFile, err := os.OpenFile(sshKeyPath, os.O_APPEND|os.O_WRONLY, 0644)
+	return execute.AsUser(username, func() error {
+		sshKeyFile, err := os.OpenFile(sshKeyPath, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return errors.Join(errors.New("failed to open file"), err)
+		}
+		defer sshKeyFile.Close()
+
+		_, err = sshKeyFile.WriteString(sshKey + "\n")
+		if err != nil {
+			return errors.Join(errors.New("failed to write to file"), err)
+		}
+
+		return nil
+	})
+}
+
+func DeleteUserSshKey(username string, indexString string) error {
+	index, err := strconv.Atoi(indexString)
 	if err != nil {
-		return errors.Join(errors.New("failed to open file"), err)
+		return errors.Join(errors.New("index is not a number"), err)
 	}
-	defer sshKeyFile.Close()
 
-	_, err = sshKeyFile.WriteString(sshKey + "\n")
+	if index < 0 {
+		return errors.New("index is less than zero")
+	}
+
+	sshKeyPath := path.Join(execute.GetHomePath(username), ".ssh", "authorized_keys")
+	var sshKeys []string
+	err = execute.AsUser(username, func() error {
+		var err error
+		sshKeys, err = getFileLines(sshKeyPath)
+		return err
+	})
 	if err != nil {
-		return errors.Join(errors.New("failed to write to file"), err)
+		return errors.Join(errors.New("failed to read file lines"), err)
 	}
 
-	return nil
-}
+	if index >= len(sshKeys) {
+		return errors.New("index is past the last line")
+	}
 
-func DeleteUserSshKey(username string, indexString string) error {
-	err := execute.FileLineDelete(path.Join("/home", username, ".ssh", "authorized_keys"), indexString)
+	var content string
+	for _, sshKey := range slices.Delete(sshKeys, index, index+1) {
+		content += sshKey + "\n"
+	}
+
+	err = writeFileAs(username, sshKeyPath, []byte(content), 0644)
 	if err != nil {
 		return errors.Join(errors.New("failed to remove line from file"), err)
 	}
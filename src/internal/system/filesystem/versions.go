@@ -0,0 +1,257 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/grantfbarnes/ground/internal/system/execute"
+)
+
+const VERSIONS_HOME_PATH string = ".local/share/ground/versions"
+
+var versionNameRegex *regexp.Regexp
+var versionMaxCount atomic.Int64
+var versionMaxAge atomic.Int64
+
+type VersionEntryData struct {
+	Name      string
+	size      int64
+	HumanSize string
+	savedTime time.Time
+	SavedOn   string
+}
+
+func SetupVersionNameRegex() error {
+	re, err := regexp.Compile(`^[0-9]{14}\.[0-9]{3}$`)
+	if err != nil {
+		return errors.Join(errors.New("failed to compile regex"), err)
+	}
+	versionNameRegex = re
+	return nil
+}
+
+func SetupVersionLimits(maxCount uint, maxAge time.Duration) {
+	versionMaxCount.Store(int64(maxCount))
+	versionMaxAge.Store(int64(maxAge))
+}
+
+func GetVersionEntries(username string, relHomePath string) ([]VersionEntryData, error) {
+	versionDirPath := getVersionDirPath(username, relHomePath)
+
+	err := pruneVersionDir(username, versionDirPath)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to prune versions"), err)
+	}
+
+	dirEntries, err := readDirAs(username, versionDirPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Join(errors.New("failed to read directory"), err)
+	}
+
+	var entries []VersionEntryData
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || !versionNameRegex.MatchString(dirEntry.Name()) {
+			continue
+		}
+
+		entryInfo, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+
+		savedTime, err := time.Parse(systemTimeLayout, dirEntry.Name())
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, VersionEntryData{
+			Name:      dirEntry.Name(),
+			size:      entryInfo.Size(),
+			HumanSize: getHumanSize(false, entryInfo.Size()),
+			savedTime: savedTime,
+			SavedOn:   savedTime.Format(displayTimeLayout),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].savedTime.After(entries[j].savedTime)
+	})
+
+	return entries, nil
+}
+
+func GetVersionFilePath(username string, relHomePath string, versionName string) (string, error) {
+	if !versionNameRegex.MatchString(versionName) {
+		return "", errors.New("version name is not valid")
+	}
+
+	versionFilePath := path.Join(getVersionDirPath(username, relHomePath), versionName)
+	versionFileInfo, err := os.Stat(versionFilePath)
+	if err != nil {
+		return "", errors.Join(errors.New("failed to find version file"), err)
+	}
+
+	if versionFileInfo.IsDir() {
+		return "", errors.New("version file is a directory")
+	}
+
+	return versionFilePath, nil
+}
+
+func RestoreVersion(username string, relHomePath string, versionName string) error {
+	versionFilePath, err := GetVersionFilePath(username, relHomePath, versionName)
+	if err != nil {
+		return errors.Join(errors.New("failed to get version file path"), err)
+	}
+
+	filePath := path.Join(execute.GetHomePath(username), relHomePath)
+	fileInfo, err := os.Stat(filePath)
+	if err == nil {
+		if fileInfo.IsDir() {
+			return errors.New("file path is a directory")
+		}
+
+		err = moveToVersions(username, filePath)
+		if err != nil {
+			return errors.Join(errors.New("failed to save current version"), err)
+		}
+	}
+
+	err = execute.Move(username, versionFilePath, filePath)
+	if err != nil {
+		return errors.Join(errors.New("failed to move version file"), err)
+	}
+
+	err = pruneVersionDir(username, getVersionDirPath(username, relHomePath))
+	if err != nil {
+		return errors.Join(errors.New("failed to prune versions"), err)
+	}
+
+	return nil
+}
+
+func PruneVersions(username string) error {
+	var versionDirPaths []string
+	err := execute.AsUser(username, func() error {
+		return filepath.WalkDir(path.Join(execute.GetHomePath(username), VERSIONS_HOME_PATH), func(entryPath string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+
+			if !entry.IsDir() && versionNameRegex.MatchString(entry.Name()) {
+				versionDirPath := path.Dir(entryPath)
+				if !slices.Contains(versionDirPaths, versionDirPath) {
+					versionDirPaths = append(versionDirPaths, versionDirPath)
+				}
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return errors.Join(errors.New("failed to walk versions directory"), err)
+	}
+
+	for _, versionDirPath := range versionDirPaths {
+		err = pruneVersionDir(username, versionDirPath)
+		if err != nil {
+			return errors.Join(errors.New("failed to prune versions"), err)
+		}
+	}
+
+	return nil
+}
+
+func saveVersion(username string, filePath string) error {
+	err := moveToVersions(username, filePath)
+	if err != nil {
+		return errors.Join(errors.New("failed to save version"), err)
+	}
+
+	relHomePath := strings.TrimPrefix(path.Clean(filePath), execute.GetHomePath(username))
+	err = pruneVersionDir(username, getVersionDirPath(username, relHomePath))
+	if err != nil {
+		return errors.Join(errors.New("failed to prune versions"), err)
+	}
+
+	return nil
+}
+
+func moveToVersions(username string, filePath string) error {
+	filePath = path.Clean(filePath)
+	homePath := execute.GetHomePath(username)
+	if !pathIsWithin(homePath, filePath) {
+		return errors.New("file path is not in home directory")
+	}
+
+	relHomePath := strings.TrimPrefix(filePath, homePath)
+	versionFilePath := path.Join(getVersionDirPath(username, relHomePath), time.Now().Format(systemTimeLayout))
+
+	err := execute.Move(username, filePath, versionFilePath)
+	if err != nil {
+		return errors.Join(errors.New("failed to move file to versions"), err)
+	}
+
+	return nil
+}
+
+func pruneVersionDir(username string, versionDirPath string) error {
+	dirEntries, err := readDirAs(username, versionDirPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return errors.Join(errors.New("failed to read directory"), err)
+	}
+
+	var versionNames []string
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() && versionNameRegex.MatchString(dirEntry.Name()) {
+			versionNames = append(versionNames, dirEntry.Name())
+		}
+	}
+
+	// timestamp names sort oldest to newest
+	sort.Strings(versionNames)
+
+	maxCount := int(versionMaxCount.Load())
+	maxAge := time.Duration(versionMaxAge.Load())
+	expiry := time.Now().Add(-maxAge)
+	for i, versionName := range versionNames {
+		keep := len(versionNames)-i <= maxCount
+		if keep && maxAge > 0 {
+			savedTime, err := time.ParseInLocation(systemTimeLayout, versionName, time.Local)
+			keep = err == nil && savedTime.After(expiry)
+		}
+
+		if keep {
+			continue
+		}
+
+		err = removeAllAs(username, path.Join(versionDirPath, versionName))
+		if err != nil {
+			return errors.Join(errors.New("failed to remove version file"), err)
+		}
+	}
+
+	return nil
+}
+
+func getVersionDirPath(username string, relHomePath string) string {
+	return path.Join(execute.GetHomePath(username), VERSIONS_HOME_PATH, relHomePath)
+}
@@ -0,0 +1,155 @@
+package monitor
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const sampleInterval time.Duration = 10 * time.Second
+const historyDuration time.Duration = time.Hour
+const historyLength int = int(historyDuration / sampleInterval)
+
+// network rates are in bytes per second
+type Sample struct {
+	Time                int64   `json:"time"`
+	CpuPercent          float64 `json:"cpuPercent"`
+	MemoryUsedBytes     uint64  `json:"memoryUsedBytes"`
+	MemoryTotalBytes    uint64  `json:"memoryTotalBytes"`
+	SwapUsedBytes       uint64  `json:"swapUsedBytes"`
+	SwapTotalBytes      uint64  `json:"swapTotalBytes"`
+	Load1               float64 `json:"load1"`
+	Load5               float64 `json:"load5"`
+	Load15              float64 `json:"load15"`
+	NetworkReceiveRate  float64 `json:"networkReceiveRate"`
+	NetworkTransmitRate float64 `json:"networkTransmitRate"`
+}
+
+var historyMutex sync.RWMutex
+var history [historyLength]Sample
+var historyNext int
+var historyCount int
+var latestFilesystems []Filesystem = []Filesystem{}
+
+// reads the counters on an interval and keeps the last hour, rates are worked out from the change since the previous read
+func RunSampler() {
+	previousCpu, _ := readCpuTimes()
+	previousNetwork, _ := readNetworkBytes()
+	previousTime := time.Now()
+
+	// a hung network mount only holds up its own loop, not the counters or the pages asking for the result
+	go func() {
+		for {
+			sampleFilesystems()
+			time.Sleep(sampleInterval)
+		}
+	}()
+
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		cpu, network, err := takeSample(now, previousTime, previousCpu, previousNetwork)
+		if err != nil {
+			slog.Error("failed to sample system stats", "error", err)
+			continue
+		}
+		previousCpu, previousNetwork, previousTime = cpu, network, now
+	}
+}
+
+// oldest first
+func GetHistory() []Sample {
+	historyMutex.RLock()
+	defer historyMutex.RUnlock()
+
+	samples := make([]Sample, 0, historyCount)
+	start := (historyNext - historyCount + historyLength) % historyLength
+	for i := range historyCount {
+		samples = append(samples, history[(start+i)%historyLength])
+	}
+	return samples
+}
+
+func GetLatestFilesystems() []Filesystem {
+	historyMutex.RLock()
+	defer historyMutex.RUnlock()
+	return latestFilesystems
+}
+
+func takeSample(now time.Time, previousTime time.Time, previousCpu cpuTimes, previousNetwork networkBytes) (cpuTimes, networkBytes, error) {
+	cpu, err := readCpuTimes()
+	if err != nil {
+		return cpu, networkBytes{}, err
+	}
+
+	network, err := readNetworkBytes()
+	if err != nil {
+		return cpu, network, err
+	}
+
+	memory, err := readMemoryUsage()
+	if err != nil {
+		return cpu, network, err
+	}
+
+	loads, err := readLoadAverages()
+	if err != nil {
+		return cpu, network, err
+	}
+
+	seconds := now.Sub(previousTime).Seconds()
+	if seconds <= 0 {
+		return cpu, network, errors.New("sample taken before the previous one")
+	}
+
+	sample := Sample{
+		Time:                now.UnixMilli(),
+		CpuPercent:          getPercent(cpu.busy, previousCpu.busy, cpu.total, previousCpu.total),
+		MemoryUsedBytes:     memory.totalBytes - memory.availableBytes,
+		MemoryTotalBytes:    memory.totalBytes,
+		SwapUsedBytes:       memory.swapTotalBytes - memory.swapFreeBytes,
+		SwapTotalBytes:      memory.swapTotalBytes,
+		Load1:               loads[0],
+		Load5:               loads[1],
+		Load15:              loads[2],
+		NetworkReceiveRate:  getRate(network.received, previousNetwork.received, seconds),
+		NetworkTransmitRate: getRate(network.transmitted, previousNetwork.transmitted, seconds),
+	}
+
+	historyMutex.Lock()
+	history[historyNext] = sample
+	historyNext = (historyNext + 1) % historyLength
+	historyCount = min(historyCount+1, historyLength)
+	historyMutex.Unlock()
+
+	return cpu, network, nil
+}
+
+func sampleFilesystems() {
+	filesystems, err := getFilesystems()
+	if err != nil {
+		slog.Error("failed to sample filesystems", "error", err)
+		return
+	}
+
+	historyMutex.Lock()
+	latestFilesystems = filesystems
+	historyMutex.Unlock()
+}
+
+func getPercent(busy uint64, previousBusy uint64, total uint64, previousTotal uint64) float64 {
+	if total <= previousTotal || busy < previousBusy {
+		return 0
+	}
+	return float64(busy-previousBusy) / float64(total-previousTotal) * 100
+}
+
+// counters go back to zero when an interface is recreated, that interval is reported as idle
+func getRate(current uint64, previous uint64, seconds float64) float64 {
+	if current < previous {
+		return 0
+	}
+	return float64(current-previous) / seconds
+}
@@ -3,6 +3,7 @@ package monitor
 import (
 	"errors"
 	"fmt"
+	"syscall"
 
 	"github.com/grantfbarnes/ground/internal/system/execute"
 )
@@ -28,11 +29,24 @@ func GetUptime() string {
 	return uptime
 }
 
-func GetDirectoryDiskUsage(dirPath string) (string, error) {
-	directorySize, err := execute.GetDirectorySize(dirPath)
+func GetDirectoryDiskUsage(username string, dirPath string) (string, error) {
+	directorySize, err := execute.GetDirectorySize(username, dirPath)
 	if err != nil {
 		return "", errors.Join(errors.New("failed to get directory size"), err)
 	}
 
 	return fmt.Sprintf("%s/%s", directorySize, diskSize), nil
 }
+
+// read straight from the filesystem, cheap enough to ask for on every metrics scrape
+func GetHomeDiskUsage() (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(execute.GetHomeRootPath(), &stat)
+	if err != nil {
+		return 0, 0, errors.Join(errors.New("failed to stat home filesystem"), err)
+	}
+
+	sizeBytes := stat.Blocks * uint64(stat.Bsize)
+	usedBytes := sizeBytes - stat.Bfree*uint64(stat.Bsize)
+	return usedBytes, sizeBytes, nil
+}
@@ -0,0 +1,244 @@
+package monitor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// pseudo filesystems that are mounted everywhere but hold no user data
+var skippedFilesystemTypes []string = []string{
+	"autofs", "bpf", "binfmt_misc", "cgroup", "cgroup2", "configfs", "debugfs", "devpts", "devtmpfs", "efivarfs",
+	"fusectl", "hugetlbfs", "mqueue", "nsfs", "proc", "pstore", "securityfs", "squashfs", "sysfs", "tracefs",
+}
+
+type Filesystem struct {
+	MountPoint string `json:"mountPoint"`
+	Device     string `json:"device"`
+	Type       string `json:"type"`
+	SizeBytes  uint64 `json:"sizeBytes"`
+	UsedBytes  uint64 `json:"usedBytes"`
+}
+
+type cpuTimes struct {
+	busy  uint64
+	total uint64
+}
+
+type networkBytes struct {
+	received    uint64
+	transmitted uint64
+}
+
+type memoryUsage struct {
+	totalBytes     uint64
+	availableBytes uint64
+	swapTotalBytes uint64
+	swapFreeBytes  uint64
+}
+
+// every mounted filesystem with a size, one mounted in several places is listed once
+func getFilesystems() ([]Filesystem, error) {
+	file, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to open mounts"), err)
+	}
+	defer file.Close()
+
+	filesystems := []Filesystem{}
+	seenFilesystems := make(map[syscall.Fsid]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		device, mountPoint, fsType := fields[0], unescapeMountField(fields[1]), fields[2]
+		if slices.Contains(skippedFilesystemTypes, fsType) {
+			continue
+		}
+
+		var stat syscall.Statfs_t
+		err = syscall.Statfs(mountPoint, &stat)
+		if err != nil || stat.Blocks == 0 || seenFilesystems[stat.Fsid] {
+			continue
+		}
+		seenFilesystems[stat.Fsid] = true
+
+		sizeBytes := stat.Blocks * uint64(stat.Bsize)
+		filesystems = append(filesystems, Filesystem{
+			MountPoint: mountPoint,
+			Device:     device,
+			Type:       fsType,
+			SizeBytes:  sizeBytes,
+			UsedBytes:  sizeBytes - stat.Bfree*uint64(stat.Bsize),
+		})
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read mounts"), err)
+	}
+
+	slices.SortFunc(filesystems, func(a, b Filesystem) int {
+		return strings.Compare(a.MountPoint, b.MountPoint)
+	})
+	return filesystems, nil
+}
+
+// mount points escape spaces and other whitespace as octal
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			value, err := strconv.ParseUint(field[i+1:i+4], 8, 8)
+			if err == nil {
+				b.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
+
+// the aggregate cpu line, time spent idle or waiting on io is not busy
+func readCpuTimes() (cpuTimes, error) {
+	content, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return cpuTimes{}, errors.Join(errors.New("failed to read cpu stats"), err)
+	}
+
+	line, _, _ := strings.Cut(string(content), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return cpuTimes{}, errors.New("cpu stats are not valid")
+	}
+
+	times := cpuTimes{}
+	// guest time is already counted in user time
+	for i, field := range fields[1:min(len(fields), 9)] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return cpuTimes{}, errors.Join(errors.New("cpu stats are not valid"), err)
+		}
+		times.total += value
+		if i != 3 && i != 4 {
+			times.busy += value
+		}
+	}
+	return times, nil
+}
+
+func readMemoryUsage() (memoryUsage, error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return memoryUsage{}, errors.Join(errors.New("failed to open memory info"), err)
+	}
+	defer file.Close()
+
+	usage := memoryUsage{}
+	fieldValues := map[string]*uint64{
+		"MemTotal":     &usage.totalBytes,
+		"MemAvailable": &usage.availableBytes,
+		"SwapTotal":    &usage.swapTotalBytes,
+		"SwapFree":     &usage.swapFreeBytes,
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		value, found := fieldValues[name]
+		if !ok || !found {
+			continue
+		}
+
+		kilobytes, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(rest), " kB"), 10, 64)
+		if err != nil {
+			return memoryUsage{}, errors.Join(fmt.Errorf("memory info '%s' is not valid", name), err)
+		}
+		*value = kilobytes * 1024
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return memoryUsage{}, errors.Join(errors.New("failed to read memory info"), err)
+	}
+
+	return usage, nil
+}
+
+func readLoadAverages() ([3]float64, error) {
+	loads := [3]float64{}
+	content, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return loads, errors.Join(errors.New("failed to read load averages"), err)
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) < 3 {
+		return loads, errors.New("load averages are not valid")
+	}
+
+	for i := range loads {
+		loads[i], err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return loads, errors.Join(errors.New("load averages are not valid"), err)
+		}
+	}
+	return loads, nil
+}
+
+// totals across interfaces, loopback traffic never leaves the machine so it is left out
+func readNetworkBytes() (networkBytes, error) {
+	file, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return networkBytes{}, errors.Join(errors.New("failed to open network stats"), err)
+	}
+	defer file.Close()
+
+	totals := networkBytes{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+
+		// receive has 8 columns, transmit bytes is the first one after them
+		fields := strings.Fields(rest)
+		if len(fields) < 9 {
+			continue
+		}
+
+		received, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return networkBytes{}, errors.Join(errors.New("network stats are not valid"), err)
+		}
+		transmitted, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return networkBytes{}, errors.Join(errors.New("network stats are not valid"), err)
+		}
+
+		totals.received += received
+		totals.transmitted += transmitted
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return networkBytes{}, errors.Join(errors.New("failed to read network stats"), err)
+	}
+
+	return totals, nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/grantfbarnes/ground/internal/system/execute"
+)
+
+const JournalLinesMax uint = 1000
+
+var ErrUnitNotAllowed = errors.New("unit is not in the managed list")
+
+// backslashes appear in escaped names, such as mount units of paths with dashes
+var unitNameRegex *regexp.Regexp = regexp.MustCompile(`^[A-Za-z0-9:_.@\\-]+$`)
+
+var unitActions []string = []string{"start", "stop", "restart"}
+
+var unitProperties []string = []string{"Id", "Description", "LoadState", "ActiveState", "SubState", "UnitFileState", "StateChangeTimestamp"}
+
+var unitsMutex sync.RWMutex
+var units []string = []string{}
+
+type UnitStatus struct {
+	Name          string
+	Description   string
+	LoadState     string
+	ActiveState   string
+	SubState      string
+	UnitFileState string
+	Since         string
+	IsGround      bool
+}
+
+// only units in this list can be looked at or acted on, so admins do not get a way to control everything as root
+func ValidateUnits(unitList string) error {
+	_, err := parseUnits(unitList)
+	return err
+}
+
+func SetupUnits(unitList string) error {
+	newUnits, err := parseUnits(unitList)
+	if err != nil {
+		return err
+	}
+
+	unitsMutex.Lock()
+	defer unitsMutex.Unlock()
+	units = newUnits
+	return nil
+}
+
+func parseUnits(unitList string) ([]string, error) {
+	newUnits := []string{}
+	for unit := range strings.SplitSeq(unitList, ",") {
+		unit = strings.TrimSpace(unit)
+		if unit == "" {
+			continue
+		}
+
+		if !unitNameRegex.MatchString(unit) || strings.HasPrefix(unit, "-") {
+			return nil, fmt.Errorf("unit name '%s' is not valid", unit)
+		}
+
+		// a bare name would also match a socket or timer of the same name in some commands
+		if !strings.Contains(unit, ".") {
+			unit += ".service"
+		}
+
+		if !slices.Contains(newUnits, unit) {
+			newUnits = append(newUnits, unit)
+		}
+	}
+
+	return newUnits, nil
+}
+
+func GetUnits() []string {
+	unitsMutex.RLock()
+	defer unitsMutex.RUnlock()
+	return units
+}
+
+func UnitIsManaged(unit string) bool {
+	return slices.Contains(GetUnits(), unit)
+}
+
+func UnitActionIsValid(action string) bool {
+	return slices.Contains(unitActions, action)
+}
+
+// names unit actions are recorded under in the audit log
+func GetAuditAction(action string) string {
+	return "service-" + action
+}
+
+func GetAuditActions() []string {
+	auditActions := []string{}
+	for _, action := range unitActions {
+		auditActions = append(auditActions, GetAuditAction(action))
+	}
+	return auditActions
+}
+
+func GetUnitStatuses() ([]UnitStatus, error) {
+	managedUnits := GetUnits()
+	if len(managedUnits) == 0 {
+		return []UnitStatus{}, nil
+	}
+
+	output, err := execute.SystemctlShow(managedUnits, unitProperties)
+	if err != nil {
+		return nil, err
+	}
+
+	groundUnit := getGroundUnit()
+	// systemctl shows the units in the order given, a unit that does not exist still gets a block
+	blocks := strings.Split(strings.TrimSpace(output), "\n\n")
+	if len(blocks) != len(managedUnits) {
+		return nil, errors.New("systemctl show output does not match units")
+	}
+
+	statuses := []UnitStatus{}
+	for i, block := range blocks {
+		properties := make(map[string]string)
+		for line := range strings.SplitSeq(block, "\n") {
+			name, value, ok := strings.Cut(line, "=")
+			if ok {
+				properties[name] = value
+			}
+		}
+
+		// the id of an alias is the unit it points to, actions are only allowed on the configured name
+		statuses = append(statuses, UnitStatus{
+			Name:          managedUnits[i],
+			Description:   properties["Description"],
+			LoadState:     properties["LoadState"],
+			ActiveState:   properties["ActiveState"],
+			SubState:      properties["SubState"],
+			UnitFileState: properties["UnitFileState"],
+			Since:         properties["StateChangeTimestamp"],
+			IsGround:      properties["Id"] == groundUnit,
+		})
+	}
+
+	return statuses, nil
+}
+
+func RunUnitAction(unit string, action string) error {
+	if !UnitIsManaged(unit) {
+		return ErrUnitNotAllowed
+	}
+
+	if !UnitActionIsValid(action) {
+		return fmt.Errorf("action '%s' is not valid", action)
+	}
+
+	// waiting on a stop or restart of ground itself would wait on this very request during shutdown
+	wait := unit != getGroundUnit()
+	return execute.SystemctlUnitAction(action, unit, wait)
+}
+
+func GetJournal(unit string, lines uint) (string, error) {
+	if !UnitIsManaged(unit) {
+		return "", ErrUnitNotAllowed
+	}
+
+	return execute.JournalLines(unit, min(lines, JournalLinesMax))
+}
+
+// the unit ground runs in, if it was started by systemd
+func getGroundUnit() string {
+	content, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+
+	for line := range strings.SplitSeq(string(content), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		unit := fields[2][strings.LastIndex(fields[2], "/")+1:]
+		if strings.HasSuffix(unit, ".service") {
+			return unit
+		}
+	}
+
+	return ""
+}
@@ -3,16 +3,39 @@ package users
 import (
 	"errors"
 
+	"github.com/grantfbarnes/ground/internal/system/auth"
 	"github.com/grantfbarnes/ground/internal/system/execute"
 )
 
-func CreateUser(username string) error {
+// returns the temporary password of the new user, generated when one is not provided
+// empty when passwords are managed outside of ground
+func CreateUser(username string, password string) (string, error) {
+	// checked before the user exists so a rejected password does not leave a user without one
+	if password != "" {
+		err := auth.ValidatePassword(username, password)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	err := execute.UserAdd(username)
 	if err != nil {
-		return errors.Join(errors.New("failed to add user"), err)
+		return "", errors.Join(errors.New("failed to add user"), err)
 	}
 
-	return nil
+	if password != "" {
+		err = auth.SetTemporaryPassword(username, password)
+	} else {
+		password, err = auth.ResetPassword(username)
+	}
+	if errors.Is(err, auth.ErrPasswordNotSettable) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Join(errors.New("failed to set temporary password"), err)
+	}
+
+	return password, nil
 }
 
 func DeleteUser(username string) error {
@@ -21,20 +44,39 @@ func DeleteUser(username string) error {
 		return errors.Join(errors.New("failed to delete user"), err)
 	}
 
+	err = auth.RemovePasswordRecords(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to remove password records"), err)
+	}
+
+	err = auth.DisableTotp(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to remove two-factor authentication"), err)
+	}
+
+	err = auth.RemovePasskeys(username)
+	if err != nil {
+		return errors.Join(errors.New("failed to remove passkeys"), err)
+	}
+
 	return nil
 }
 
-func ResetUserPassword(username string) error {
-	err := SetUserPassword(username, "password")
+func ResetUserPassword(username string) (string, error) {
+	password, err := auth.ResetPassword(username)
 	if err != nil {
-		return errors.Join(errors.New("failed to set user password"), err)
+		return "", errors.Join(errors.New("failed to set temporary password"), err)
 	}
 
-	return nil
+	return password, nil
+}
+
+func PasswordChangeRequired(username string) bool {
+	return auth.PasswordChangeRequired(username)
 }
 
 func SetUserPassword(username string, password string) error {
-	err := execute.PasswordSet(username, password)
+	err := auth.SetPassword(username, password)
 	if err != nil {
 		return errors.Join(errors.New("failed to change password"), err)
 	}
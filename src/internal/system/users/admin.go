@@ -2,14 +2,26 @@ package users
 
 import (
 	"errors"
+	"os/user"
 	"slices"
 
+	"github.com/grantfbarnes/ground/internal/system/auth"
 	"github.com/grantfbarnes/ground/internal/system/execute"
 )
 
 var adminGroup string
 
-func SetupAdminGroup() error {
+// an empty group picks whichever of sudo or wheel is granted sudo rights
+func SetupAdminGroup(group string) error {
+	if group != "" {
+		_, err := user.LookupGroup(group)
+		if err != nil {
+			return errors.Join(errors.New("admin group does not exist"), err)
+		}
+		adminGroup = group
+		return nil
+	}
+
 	groups := []string{"sudo", "wheel"}
 	for _, group := range groups {
 		if execute.FileSearch("/etc/sudoers", "^%"+group+".*ALL") == nil {
@@ -20,7 +32,25 @@ func SetupAdminGroup() error {
 	return errors.New("no admin group found")
 }
 
+// admin group members only get admin access once enrolled in two-factor authentication when it is required
 func IsAdmin(username string) bool {
+	if !IsAdminGroupMember(username) {
+		return false
+	}
+
+	if !auth.AdminTotpRequired() {
+		return true
+	}
+
+	enrolled, err := auth.TotpIsEnrolled(username)
+	return err == nil && enrolled
+}
+
+func IsAdminGroup(group string) bool {
+	return group == adminGroup
+}
+
+func IsAdminGroupMember(username string) bool {
 	userGroups, err := execute.GetGroups(username)
 	if err != nil {
 		return false
@@ -29,7 +59,7 @@ func IsAdmin(username string) bool {
 }
 
 func ToggleAdmin(username string) (err error) {
-	if IsAdmin(username) {
+	if IsAdminGroupMember(username) {
 		err = execute.GroupDelete(username, adminGroup)
 	} else {
 		err = execute.GroupAdd(username, adminGroup)
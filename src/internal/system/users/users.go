@@ -3,28 +3,51 @@ package users
 import (
 	"errors"
 	"os"
+
+	"github.com/grantfbarnes/ground/internal/system/auth"
+	"github.com/grantfbarnes/ground/internal/system/execute"
 )
 
 type UserListItem struct {
-	Username string
-	IsAdmin  bool
+	Username     string
+	IsAdmin      bool
+	TotpEnrolled bool
+	Locked       bool
 }
 
 func GetUserListItems() ([]UserListItem, error) {
-	homeEntries, err := os.ReadDir("/home")
+	usernames, err := GetUsernames()
 	if err != nil {
-		return nil, errors.Join(errors.New("failed to read directory"), err)
+		return nil, errors.Join(errors.New("failed to get usernames"), err)
 	}
 
 	listItems := []UserListItem{}
+	for _, username := range usernames {
+		totpEnrolled, _ := auth.TotpIsEnrolled(username)
+		_, locked := auth.AccountLockedUntil(username)
+		listItems = append(listItems, UserListItem{
+			Username:     username,
+			IsAdmin:      IsAdminGroupMember(username),
+			TotpEnrolled: totpEnrolled,
+			Locked:       locked,
+		})
+	}
+
+	return listItems, nil
+}
+
+func GetUsernames() ([]string, error) {
+	homeEntries, err := os.ReadDir(execute.GetHomeRootPath())
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read directory"), err)
+	}
+
+	usernames := []string{}
 	for _, e := range homeEntries {
 		if e.IsDir() {
-			listItems = append(listItems, UserListItem{
-				Username: e.Name(),
-				IsAdmin:  IsAdmin(e.Name()),
-			})
+			usernames = append(usernames, e.Name())
 		}
 	}
 
-	return listItems, nil
+	return usernames, nil
 }
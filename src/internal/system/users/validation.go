@@ -4,9 +4,9 @@ import (
 	"errors"
 	"os"
 	"os/user"
-	"path"
 	"regexp"
 
+	"github.com/grantfbarnes/ground/internal/system/auth"
 	"github.com/grantfbarnes/ground/internal/system/execute"
 )
 
@@ -40,7 +40,7 @@ func UserIsValid(username string) bool {
 		return false
 	}
 
-	homePath := path.Join("/home", username)
+	homePath := execute.GetHomePath(username)
 	_, err = os.Stat(homePath)
 	if err != nil {
 		return false
@@ -50,5 +50,5 @@ func UserIsValid(username string) bool {
 }
 
 func CredentialsAreValid(username string, password string) bool {
-	return execute.TestRunAs(username, password) == nil
+	return auth.CredentialsAreValid(username, password)
 }
@@ -4,13 +4,25 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/grantfbarnes/ground/internal/config"
 	"github.com/grantfbarnes/ground/internal/server"
+	"github.com/grantfbarnes/ground/internal/server/api"
+	"github.com/grantfbarnes/ground/internal/server/certificate"
+	"github.com/grantfbarnes/ground/internal/server/common"
 	"github.com/grantfbarnes/ground/internal/server/cookie"
+	"github.com/grantfbarnes/ground/internal/server/logs"
+	"github.com/grantfbarnes/ground/internal/server/metrics"
+	"github.com/grantfbarnes/ground/internal/system/auth"
 	"github.com/grantfbarnes/ground/internal/system/filesystem"
 	"github.com/grantfbarnes/ground/internal/system/monitor"
+	"github.com/grantfbarnes/ground/internal/system/services"
 	"github.com/grantfbarnes/ground/internal/system/users"
 )
 
@@ -24,7 +36,11 @@ const COLOR_RESET string = "\x1b[0m"
 
 func main() {
 	var err error
-	settings := getSettingsFromArguments()
+	settings, err := getSettingsFromArguments()
+	if err != nil {
+		printErrorMessage(errors.Join(errors.New("failed to get settings"), err).Error())
+		os.Exit(1)
+	}
 
 	if settings.version {
 		fmt.Println(VERSION)
@@ -45,36 +61,54 @@ func main() {
 		os.Exit(1)
 	}
 
-	err = healthCheck()
+	err = healthCheck(settings)
 	if err != nil {
 		printErrorMessage(errors.Join(errors.New("failed health check"), err).Error())
 		os.Exit(1)
 	}
 
-	server.Run(settings.port, settings.certFile, settings.keyFile)
+	go reloadOnHangup(settings)
+
+	server.Run(settings.server)
 }
 
 type settings struct {
-	version  bool
-	service  bool
-	run      bool
-	port     uint
-	certFile string
-	keyFile  string
+	version        bool
+	service        bool
+	run            bool
+	config         string
+	server         server.Options
+	basePath       string
+	tls            string
+	certFile       string
+	keyFile        string
+	sessionTtl     time.Duration
+	fileVersions   uint
+	fileVersionAge time.Duration
+	trashAge       time.Duration
+	trashMaxSize   uint
+	uploadMaxSize  uint
+	homeRoot       string
+	sharedRoot     string
+	symlinkPolicy  string
+	adminGroup     string
+	auth           string
+	authOptions    auth.Options
+	passwordPolicy auth.PasswordPolicy
+	loginThrottle  auth.LoginThrottle
+	trustedProxies string
+	features       common.Features
+	metricsToken   string
+	services       string
 }
 
-func getSettingsFromArguments() settings {
+func getSettingsFromArguments() (settings, error) {
 	args := settings{}
 
 	flag.BoolVar(&args.version, "v", false, "Print version")
 	flag.BoolVar(&args.version, "version", false, "Print version")
 	flag.BoolVar(&args.service, "service", false, "Print systemd service intructions")
 
-	runCmd := flag.NewFlagSet("run", flag.ExitOnError)
-	runCmd.UintVar(&args.port, "port", 3478, "Define port web server is run on")
-	runCmd.StringVar(&args.certFile, "cert-file", "", "Define https certificate file path")
-	runCmd.StringVar(&args.keyFile, "key-file", "", "Define https key file path")
-
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
 		fmt.Fprintln(os.Stderr)
@@ -86,7 +120,7 @@ func getSettingsFromArguments() settings {
 		fmt.Fprintln(os.Stderr, "Commands:")
 		fmt.Fprintln(os.Stderr, "  run")
 		fmt.Fprintln(os.Stderr, "        Run the web server")
-		runCmd.PrintDefaults()
+		newRunFlagSet(&settings{}, flag.ExitOnError).PrintDefaults()
 	}
 
 	flag.Parse()
@@ -94,29 +128,130 @@ func getSettingsFromArguments() settings {
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
 		case "run":
-			args.run = true
-			runCmd.Parse(os.Args[2:])
+			runArgs, err := getRunSettings(os.Args[2:], flag.ExitOnError)
+			if err != nil {
+				return args, err
+			}
+			runArgs.run = true
+			return runArgs, nil
+		}
+	}
+
+	return args, nil
+}
+
+func newRunFlagSet(args *settings, errorHandling flag.ErrorHandling) *flag.FlagSet {
+	runCmd := flag.NewFlagSet("run", errorHandling)
+	runCmd.StringVar(&args.config, "config", "", "Define toml or json file with run options, keys are option names and sections prefix their keys (options given on the command line take precedence)")
+	runCmd.StringVar(&args.server.Address, "address", "", "Define comma separated addresses web server listens on, as host, host:port or unix:/path/to/socket (empty for all interfaces, ignored under systemd socket activation)")
+	runCmd.StringVar(&args.server.SocketGroup, "socket-group", "", "Define group given access to unix sockets, such as the group of a reverse proxy (empty to keep the group of ground)")
+	runCmd.UintVar(&args.server.Port, "port", 3478, "Define port web server is run on")
+	runCmd.StringVar(&args.basePath, "base-path", "", "Define path ground is served under, such as /ground when a reverse proxy forwards that location (empty to serve at the root)")
+	runCmd.DurationVar(&args.server.ReadHeaderTimeout, "read-header-timeout", 10*time.Second, "Define how long a client has to send request headers")
+	runCmd.DurationVar(&args.server.ReadTimeout, "read-timeout", 0, "Define how long a client has to send a whole request, including uploads (0 for no limit)")
+	runCmd.DurationVar(&args.server.WriteTimeout, "write-timeout", 0, "Define how long sending a whole response can take, including downloads (0 for no limit)")
+	runCmd.DurationVar(&args.server.IdleTimeout, "idle-timeout", 2*time.Minute, "Define how long an idle keep-alive connection stays open")
+	runCmd.UintVar(&args.server.MaxHeaderSize, "max-header-size", 64, "Define max size in kilobytes of request headers")
+	runCmd.DurationVar(&args.server.ShutdownTimeout, "shutdown-timeout", 5*time.Minute, "Define how long requests in progress, like uploads, get to finish when stopping")
+	runCmd.StringVar(&args.certFile, "cert-file", "", "Define https certificate file path")
+	runCmd.StringVar(&args.keyFile, "key-file", "", "Define https key file path")
+	runCmd.StringVar(&args.tls, "tls", "", "Define https mode (auto to generate a certificate authority and certificate for this host, empty to use cert-file and key-file when given)")
+	runCmd.UintVar(&args.server.RedirectPort, "http-redirect-port", 0, "Define port redirecting http to https, which also serves the certificate authority in auto mode (0 for no redirect)")
+	runCmd.DurationVar(&args.sessionTtl, "session-ttl", 12*time.Hour, "Define how long a login lasts")
+	runCmd.UintVar(&args.fileVersions, "file-versions", 10, "Define number of previous versions kept per file")
+	runCmd.DurationVar(&args.fileVersionAge, "file-version-age", 30*24*time.Hour, "Define how long previous file versions are kept (0 to keep until count is exceeded)")
+	runCmd.DurationVar(&args.trashAge, "trash-age", 0, "Define how long trashed files are kept before being purged (0 to keep forever)")
+	runCmd.UintVar(&args.trashMaxSize, "trash-max-size", 0, "Define max trash size in megabytes per user, oldest purged first (0 for no limit)")
+	runCmd.UintVar(&args.uploadMaxSize, "upload-max-size", 0, "Define max size in megabytes of a single upload (0 for no limit)")
+	runCmd.StringVar(&args.homeRoot, "home-root", "/home", "Define directory containing user home directories")
+	runCmd.StringVar(&args.sharedRoot, "shared-root", "/srv/ground/shared", "Define directory containing group shared spaces")
+	runCmd.StringVar(&args.adminGroup, "admin-group", "", "Define group whose members are admins (empty to use sudo or wheel)")
+	runCmd.StringVar(&args.auth, "auth", auth.BACKEND_SYSTEM, "Define authentication backend (system, pam, htpasswd, ldap)")
+	runCmd.StringVar(&args.authOptions.PamService, "auth-pam-service", "login", "Define pam service used by the pam authentication backend")
+	runCmd.StringVar(&args.authOptions.HtpasswdFile, "auth-htpasswd-file", "/etc/ground/htpasswd", "Define bcrypt credentials file used by the htpasswd authentication backend")
+	runCmd.StringVar(&args.authOptions.LdapUrl, "auth-ldap-url", "ldap://localhost:389", "Define server used by the ldap authentication backend (ldap:// or ldaps://)")
+	runCmd.StringVar(&args.authOptions.LdapUserDn, "auth-ldap-user-dn", "uid=%s,ou=people,dc=example,dc=com", "Define user dn used by the ldap authentication backend, %s is replaced with the username")
+	runCmd.UintVar(&args.passwordPolicy.MinLength, "password-min-length", 8, "Define minimum number of characters in passwords")
+	runCmd.UintVar(&args.passwordPolicy.MinClasses, "password-min-classes", 1, "Define minimum number of character classes in passwords (lowercase, uppercase, digits, symbols)")
+	runCmd.UintVar(&args.passwordPolicy.History, "password-history", 0, "Define number of previous passwords that cannot be reused (0 to allow reuse)")
+	runCmd.DurationVar(&args.loginThrottle.BackoffMax, "login-backoff-max", 15*time.Minute, "Define longest wait between failed login attempts")
+	runCmd.UintVar(&args.loginThrottle.LockoutFailures, "login-lockout-failures", 10, "Define number of failed logins that lock an account")
+	runCmd.DurationVar(&args.loginThrottle.LockoutDuration, "login-lockout-duration", 30*time.Minute, "Define how long a locked account stays locked")
+	runCmd.StringVar(&args.trustedProxies, "trusted-proxies", "", "Define comma separated addresses or networks of reverse proxies whose X-Forwarded-For and X-Forwarded-Proto headers are trusted, unix for clients of unix socket listeners (proxies must pass the original Host header)")
+	runCmd.StringVar(&args.symlinkPolicy, "symlink-policy", filesystem.SYMLINK_POLICY_SHOW, "Define how symbolic links leaving the root directory are handled (show, follow, block)")
+	runCmd.BoolVar(&args.features.Impersonation, "allow-impersonation", true, "Define whether admins can impersonate users")
+	runCmd.BoolVar(&args.features.Shares, "allow-shares", true, "Define whether users can share directories with each other")
+	runCmd.StringVar(&args.services, "services", "", "Define comma separated systemd units admins can start, stop, restart and view logs of, such as sshd,smbd,ground (empty to hide service management)")
+	runCmd.StringVar(&args.metricsToken, "metrics-token", "", "Define bearer token required to read /metrics (empty to only serve metrics on metrics-address)")
+	runCmd.StringVar(&args.server.MetricsAddress, "metrics-address", "", "Define comma separated host:port or unix:/path/to/socket addresses that serve only /metrics, such as 127.0.0.1:9478 (empty for none)")
+	runCmd.BoolVar(&args.features.SystemPower, "allow-system-power", true, "Define whether admins can reboot and poweroff the system")
+	return runCmd
+}
+
+// parses the run options, then fills in the ones not given on the command line from the config file
+func getRunSettings(arguments []string, errorHandling flag.ErrorHandling) (settings, error) {
+	args := settings{}
+	runCmd := newRunFlagSet(&args, errorHandling)
+
+	err := runCmd.Parse(arguments)
+	if err != nil {
+		return args, err
+	}
+
+	if args.config == "" {
+		return args, nil
+	}
+
+	values, err := config.Load(args.config)
+	if err != nil {
+		return args, err
+	}
+
+	setFlags := make(map[string]bool)
+	runCmd.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	for name, value := range values {
+		if name == "config" || runCmd.Lookup(name) == nil {
+			return args, fmt.Errorf("config file option '%s' is not valid", name)
+		}
+
+		if setFlags[name] {
+			continue
+		}
+
+		err = runCmd.Set(name, value)
+		if err != nil {
+			return args, errors.Join(fmt.Errorf("config file option '%s' is not valid", name), err)
 		}
 	}
 
-	return args
+	return args, nil
 }
 
-func healthCheck() (err error) {
+func healthCheck(settings settings) (err error) {
 	if os.Getuid() != 0 {
 		return errors.New("not running as root")
 	}
 
+	err = logs.Setup()
+	if err != nil {
+		return errors.Join(errors.New("failed to setup server logs"), err)
+	}
+
 	dependencies := []string{
 		"chpasswd",
 		"df",
 		"du",
+		"getent",
 		"gpasswd",
 		"grep",
+		"groupadd",
 		"groups",
 		"mkdir",
 		"mv",
-		"sed",
+		"sh",
 		"su",
 		"systemctl",
 		"tar",
@@ -131,6 +266,25 @@ func healthCheck() (err error) {
 		}
 	}
 
+	// only system accounts can have their password expired outside of ground
+	if (settings.auth == auth.BACKEND_SYSTEM || settings.auth == auth.BACKEND_PAM) && missingRequiredDependencyProgram("chage") {
+		return errors.New("missing required dependency program 'chage'")
+	}
+
+	err = certificate.SetupTls(settings.tls, settings.certFile, settings.keyFile)
+	if err != nil {
+		return errors.Join(errors.New("failed to setup tls"), err)
+	}
+
+	if settings.server.RedirectPort != 0 && (!certificate.TlsIsEnabled() || settings.server.RedirectPort == settings.server.Port) {
+		return errors.New("http redirect port needs https on a different port")
+	}
+
+	err = common.SetupBasePath(settings.basePath)
+	if err != nil {
+		return errors.Join(errors.New("failed to setup base path"), err)
+	}
+
 	err = cookie.SetupHashSecret()
 	if err != nil {
 		return errors.Join(errors.New("failed to setup hash secret"), err)
@@ -146,6 +300,36 @@ func healthCheck() (err error) {
 		return errors.Join(errors.New("failed to setup trash dir name regex"), err)
 	}
 
+	err = filesystem.SetupVersionNameRegex()
+	if err != nil {
+		return errors.Join(errors.New("failed to setup version name regex"), err)
+	}
+
+	err = filesystem.SetupSpaceNameRegex()
+	if err != nil {
+		return errors.Join(errors.New("failed to setup space name regex"), err)
+	}
+
+	err = filesystem.SetupHomeRootPath(settings.homeRoot)
+	if err != nil {
+		return errors.Join(errors.New("failed to setup home root path"), err)
+	}
+
+	err = filesystem.SetupSharedRootPath(settings.sharedRoot)
+	if err != nil {
+		return errors.Join(errors.New("failed to setup shared root path"), err)
+	}
+
+	err = filesystem.SetupSymlinkPolicy(settings.symlinkPolicy)
+	if err != nil {
+		return errors.Join(errors.New("failed to setup symlink policy"), err)
+	}
+
+	err = filesystem.SetupShareIdRegex()
+	if err != nil {
+		return errors.Join(errors.New("failed to setup share id regex"), err)
+	}
+
 	err = filesystem.SetupSshKeyRegex()
 	if err != nil {
 		return errors.Join(errors.New("failed to setup ssh key regex"), err)
@@ -161,14 +345,166 @@ func healthCheck() (err error) {
 		return errors.Join(errors.New("failed to setup username regex"), err)
 	}
 
-	err = users.SetupAdminGroup()
+	err = users.SetupAdminGroup(settings.adminGroup)
 	if err != nil {
 		return errors.Join(errors.New("failed to setup admin group"), err)
 	}
 
+	err = auth.SetupAuthenticator(settings.auth, settings.authOptions)
+	if err != nil {
+		return errors.Join(errors.New("failed to setup authenticator"), err)
+	}
+
+	err = validateReloadableSettings(settings)
+	if err != nil {
+		return err
+	}
+
+	err = setupReloadableSettings(settings)
+	if err != nil {
+		return err
+	}
+
+	err = auth.LoadLoginFailures()
+	if err != nil {
+		return errors.Join(errors.New("failed to load login failures"), err)
+	}
+
 	return nil
 }
 
+// checks every reloadable setting, so a reload applies all of them or none
+func validateReloadableSettings(settings settings) error {
+	errs := []error{}
+
+	err := cookie.ValidateSessionLength(settings.sessionTtl)
+	if err != nil {
+		errs = append(errs, errors.Join(errors.New("session length is not valid"), err))
+	}
+
+	err = auth.ValidatePasswordPolicy(settings.passwordPolicy)
+	if err != nil {
+		errs = append(errs, errors.Join(errors.New("password policy is not valid"), err))
+	}
+
+	err = auth.ValidateLoginThrottle(settings.loginThrottle)
+	if err != nil {
+		errs = append(errs, errors.Join(errors.New("login throttle is not valid"), err))
+	}
+
+	err = common.ValidateTrustedProxies(settings.trustedProxies)
+	if err != nil {
+		errs = append(errs, errors.Join(errors.New("trusted proxies are not valid"), err))
+	}
+
+	err = services.ValidateUnits(settings.services)
+	if err != nil {
+		errs = append(errs, errors.Join(errors.New("services are not valid"), err))
+	}
+
+	if settings.services != "" && missingRequiredDependencyProgram("journalctl") {
+		errs = append(errs, errors.New("missing required dependency program 'journalctl'"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// settings that are safe to change while requests are being served, each one keeps its previous value if the new one is not valid
+func setupReloadableSettings(settings settings) error {
+	errs := []error{}
+
+	err := cookie.SetupSessionLength(settings.sessionTtl)
+	if err != nil {
+		errs = append(errs, errors.Join(errors.New("failed to setup session length"), err))
+	}
+
+	filesystem.SetupVersionLimits(settings.fileVersions, settings.fileVersionAge)
+
+	filesystem.SetupTrashLimits(settings.trashAge, int64(settings.trashMaxSize)*1000000)
+
+	api.SetupUploadMaxSize(int64(settings.uploadMaxSize) * 1000000)
+
+	err = auth.SetupPasswordPolicy(settings.passwordPolicy)
+	if err != nil {
+		errs = append(errs, errors.Join(errors.New("failed to setup password policy"), err))
+	}
+
+	err = auth.SetupLoginThrottle(settings.loginThrottle)
+	if err != nil {
+		errs = append(errs, errors.Join(errors.New("failed to setup login throttle"), err))
+	}
+
+	err = common.SetupTrustedProxies(settings.trustedProxies)
+	if err != nil {
+		errs = append(errs, errors.Join(errors.New("failed to setup trusted proxies"), err))
+	}
+
+	common.SetupFeatures(settings.features)
+
+	metrics.SetupToken(settings.metricsToken)
+
+	err = services.SetupUnits(settings.services)
+	if err != nil {
+		errs = append(errs, errors.Join(errors.New("failed to setup services"), err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// re-reads the command line and config file on SIGHUP, settings that need a restart are left as they are
+func reloadOnHangup(current settings) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		reloaded, err := getRunSettings(os.Args[2:], flag.ContinueOnError)
+		if err != nil {
+			slog.Error("failed to reload settings", "error", err)
+			continue
+		}
+
+		restartSettings := map[string]bool{
+			"address":            reloaded.server.Address != current.server.Address,
+			"port":               reloaded.server.Port != current.server.Port,
+			"base-path":          reloaded.basePath != current.basePath,
+			"tls":                reloaded.tls != current.tls || reloaded.certFile != current.certFile || reloaded.keyFile != current.keyFile,
+			"http-redirect-port": reloaded.server.RedirectPort != current.server.RedirectPort,
+			"timeouts": reloaded.server.ReadHeaderTimeout != current.server.ReadHeaderTimeout ||
+				reloaded.server.ReadTimeout != current.server.ReadTimeout ||
+				reloaded.server.WriteTimeout != current.server.WriteTimeout ||
+				reloaded.server.IdleTimeout != current.server.IdleTimeout ||
+				reloaded.server.MaxHeaderSize != current.server.MaxHeaderSize ||
+				reloaded.server.ShutdownTimeout != current.server.ShutdownTimeout,
+			"metrics-address": reloaded.server.MetricsAddress != current.server.MetricsAddress,
+			"socket-group":    reloaded.server.SocketGroup != current.server.SocketGroup,
+			"auth":            reloaded.auth != current.auth || reloaded.authOptions != current.authOptions,
+			"home-root":       reloaded.homeRoot != current.homeRoot,
+			"shared-root":     reloaded.sharedRoot != current.sharedRoot,
+			"symlink-policy":  reloaded.symlinkPolicy != current.symlinkPolicy,
+			"admin-group":     reloaded.adminGroup != current.adminGroup,
+		}
+		for name, changed := range restartSettings {
+			if changed {
+				slog.Warn("setting change needs a restart", "setting", name)
+			}
+		}
+
+		err = validateReloadableSettings(reloaded)
+		if err != nil {
+			slog.Error("failed to reload settings, the previous values were kept", "error", err)
+			continue
+		}
+
+		err = setupReloadableSettings(reloaded)
+		if err != nil {
+			slog.Error("failed to apply reloaded settings", "error", err)
+			continue
+		}
+
+		slog.Info("reloaded settings", "config", reloaded.config)
+	}
+}
+
 func missingRequiredDependencyProgram(name string) bool {
 	_, err := exec.LookPath(name)
 	return err != nil
@@ -206,7 +542,9 @@ After=network.target
 [Service]
 User=root
 ExecStart=%s run
+ExecReload=/bin/kill -HUP $MAINPID
 Restart=always
+TimeoutStopSec=5min
 
 [Install]
 WantedBy=multi-user.target